@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/sha256"
@@ -11,21 +12,22 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 type agentConfig struct {
-	controlPlaneURL string
-	apiToken        string
-	outputPath      string
-	pollInterval    time.Duration
+	controlPlaneURL   string
+	apiToken          string
+	outputPath        string
+	pollInterval      time.Duration
 	reconcileInterval time.Duration
-	composeDir      string
+	composeDir        string
+	runtime           Runtime
 }
 
 func main() {
@@ -53,18 +55,33 @@ func parseFlags() agentConfig {
 	cfgInterval := flag.Duration("poll-interval", 15*time.Second, "Traefik config polling interval")
 	reconcile := flag.Duration("deploy-interval", 20*time.Second, "Container reconcile interval")
 	composeDir := flag.String("compose-dir", envOrDefault("AGENT_COMPOSE_DIR", "./compose"), "Directory for rendered docker-compose files")
+	runtimeName := flag.String("runtime", envOrDefault("AGENT_RUNTIME", "docker"), "Container runtime backend: docker, podman, or runc")
 	flag.Parse()
 
+	runtime, err := selectRuntime(*runtimeName)
+	if err != nil {
+		log.Fatalf("runtime: %v", err)
+	}
+
 	return agentConfig{
-		controlPlaneURL: strings.TrimRight(*controlPlane, "/"),
-		apiToken:        *token,
-		outputPath:      *output,
-		pollInterval:    *cfgInterval,
+		controlPlaneURL:   strings.TrimRight(*controlPlane, "/"),
+		apiToken:          *token,
+		outputPath:        *output,
+		pollInterval:      *cfgInterval,
 		reconcileInterval: *reconcile,
-		composeDir:      *composeDir,
+		composeDir:        *composeDir,
+		runtime:           runtime,
 	}
 }
 
+// run drives the agent's two feeds - Traefik config and service state -
+// off the control plane's `/v1/events` SSE stream, which pushes a
+// "traefik.updated"/"services.updated" pair the instant something
+// changes, cutting reconvergence latency from pollInterval to
+// sub-second. configTicker/reconcileTicker remain as the fallback
+// cadence: while connected they're a no-op safety net, but the moment
+// the stream drops they're what keeps the agent converging until it
+// reconnects.
 func run(ctx context.Context, cfg agentConfig) error {
 	var lastHash [32]byte
 	configTicker := time.NewTicker(cfg.pollInterval)
@@ -72,16 +89,44 @@ func run(ctx context.Context, cfg agentConfig) error {
 	reconcileTicker := time.NewTicker(cfg.reconcileInterval)
 	defer reconcileTicker.Stop()
 
+	events := make(chan sseEvent, 8)
+	var streaming atomic.Bool
+	go watchEvents(ctx, cfg, events, &streaming)
+
+	if err := updateTraefikConfig(ctx, cfg, &lastHash); err != nil {
+		log.Printf("traefik update error: %v", err)
+	}
+	if err := reconcileServices(ctx, cfg); err != nil {
+		log.Printf("reconcile error: %v", err)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("agent shutting down")
 			return nil
+		case ev := <-events:
+			switch ev.name {
+			case "traefik.updated":
+				if err := updateTraefikConfig(ctx, cfg, &lastHash); err != nil {
+					log.Printf("traefik update error: %v", err)
+				}
+			case "services.updated":
+				if err := reconcileServices(ctx, cfg); err != nil {
+					log.Printf("reconcile error: %v", err)
+				}
+			}
 		case <-configTicker.C:
+			if streaming.Load() {
+				continue
+			}
 			if err := updateTraefikConfig(ctx, cfg, &lastHash); err != nil {
 				log.Printf("traefik update error: %v", err)
 			}
 		case <-reconcileTicker.C:
+			if streaming.Load() {
+				continue
+			}
 			if err := reconcileServices(ctx, cfg); err != nil {
 				log.Printf("reconcile error: %v", err)
 			}
@@ -89,6 +134,93 @@ func run(ctx context.Context, cfg agentConfig) error {
 	}
 }
 
+// sseEvent is one `event: <name>\ndata: <data>\n\n` frame off /v1/events.
+type sseEvent struct {
+	name string
+	data string
+}
+
+// watchEvents keeps a long-lived connection to /v1/events open, forwarding
+// each event to events and tracking connectivity in streaming so run can
+// tell whether its ticker fallback is needed. It reconnects with capped
+// exponential backoff on disconnect and only gives up when ctx is done.
+func watchEvents(ctx context.Context, cfg agentConfig, events chan<- sseEvent, streaming *atomic.Bool) {
+	backoff := time.Second
+	const maxBackoff = 30 * time.Second
+
+	for ctx.Err() == nil {
+		err := streamEvents(ctx, cfg, events, func() {
+			streaming.Store(true)
+			backoff = time.Second
+		})
+		streaming.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("event stream disconnected, falling back to polling until reconnect: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// streamEvents opens one connection to /v1/events and blocks reading
+// events off it until the stream ends or ctx is canceled. onConnected is
+// called once the connection is established, before the first event.
+func streamEvents(ctx context.Context, cfg agentConfig, events chan<- sseEvent, onConnected func()) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.controlPlaneURL+"/v1/events", nil)
+	if err != nil {
+		return err
+	}
+	if cfg.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.apiToken)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		buf, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("events stream %d: %s", resp.StatusCode, string(bytes.TrimSpace(buf)))
+	}
+	onConnected()
+
+	var ev sseEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			if ev.name != "" {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			ev = sseEvent{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
 func updateTraefikConfig(ctx context.Context, cfg agentConfig, lastHash *[32]byte) error {
 	config, err := fetchTraefikConfig(ctx, cfg)
 	if err != nil {
@@ -187,6 +319,10 @@ func reconcileServices(ctx context.Context, cfg agentConfig) error {
 
 func ensureService(ctx context.Context, cfg agentConfig, svc serviceState) error {
 	if strings.TrimSpace(svc.Compose) != "" {
+		if !cfg.runtime.Capabilities().Compose {
+			log.Printf("service %s declares a compose stack but the %s runtime doesn't support compose; skipping", svc.ID, cfg.runtime.Name())
+			return nil
+		}
 		return ensureComposeService(ctx, cfg, svc)
 	}
 	return ensureContainer(ctx, cfg, svc)
@@ -198,39 +334,25 @@ func ensureContainer(ctx context.Context, cfg agentConfig, svc serviceState) err
 	}
 	container := "svc-" + svc.ID
 	composePath := filepath.Join(cfg.composeDir, svc.ID, "docker-compose.yml")
-	if _, err := os.Stat(composePath); err == nil {
+	if _, err := os.Stat(composePath); err == nil && cfg.runtime.Capabilities().Compose {
 		log.Printf("compose stack detected for %s, bringing it down", svc.ID)
-		_ = runDocker(ctx, "compose", "-f", composePath, "-p", "mdp-"+svc.ID, "down", "--remove-orphans")
+		_ = cfg.runtime.ComposeDown(ctx, ComposeSpec{ServiceID: svc.ID, ComposeFile: composePath, Project: "mdp-" + svc.ID})
 	}
 
-	if err := runDocker(ctx, "pull", svc.Image); err != nil {
+	if err := cfg.runtime.Pull(ctx, svc.Image); err != nil {
 		log.Printf("pull warning for %s: %v", svc.Image, err)
 	}
 
-	image, err := dockerInspect(ctx, container, "{{.Config.Image}}")
-	if err == nil && strings.TrimSpace(image) == svc.Image {
-		state, err := dockerInspect(ctx, container, "{{.State.Running}}")
-		if err == nil && strings.TrimSpace(state) == "true" {
-			return nil
-		}
-		return runDocker(ctx, "start", container)
-	}
-
-	_ = runDocker(ctx, "rm", "-f", container)
-
-	args := []string{
-		"run", "-d",
-		"--restart", "unless-stopped",
-		"--name", container,
-		"--label", "mdp.service=" + svc.ID,
-		"-p", fmt.Sprintf("127.0.0.1:%d:%d", svc.InternalPort, svc.InternalPort),
-		svc.Image,
-	}
-	return runDocker(ctx, args...)
+	return cfg.runtime.Ensure(ctx, ContainerSpec{
+		Name:         container,
+		Image:        svc.Image,
+		InternalPort: svc.InternalPort,
+		Labels:       map[string]string{mdpServiceLabel: svc.ID},
+	})
 }
 
 func ensureComposeService(ctx context.Context, cfg agentConfig, svc serviceState) error {
-    _ = runDocker(ctx, "rm", "-f", "svc-"+svc.ID)
+	_ = cfg.runtime.Remove(ctx, "svc-"+svc.ID)
 	dir := filepath.Join(cfg.composeDir, svc.ID)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return fmt.Errorf("compose dir: %w", err)
@@ -241,84 +363,43 @@ func ensureComposeService(ctx context.Context, cfg agentConfig, svc serviceState
 		return fmt.Errorf("write compose: %w", err)
 	}
 
-	if err := runDocker(ctx, "compose", "-f", composePath, "-p", "mdp-"+svc.ID, "pull"); err != nil {
-		log.Printf("compose pull warning: %v", err)
-	}
-	return runDocker(ctx, "compose", "-f", composePath, "-p", "mdp-"+svc.ID, "up", "-d", "--remove-orphans")
+	return cfg.runtime.ComposeUp(ctx, ComposeSpec{ServiceID: svc.ID, ComposeFile: composePath, Project: "mdp-" + svc.ID})
 }
 
 func cleanupServices(ctx context.Context, cfg agentConfig, desired map[string]serviceState) error {
-	output, err := runDockerOutput(ctx, "ps", "-a", "--filter", "label=mdp.service", "--format", "{{.Names}} {{.Label \"mdp.service\"}}")
+	managed, err := cfg.runtime.ListManaged(ctx)
 	if err == nil {
-		lines := strings.Split(strings.TrimSpace(output), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" {
+		for _, container := range managed {
+			if _, ok := desired[container.ServiceID]; ok {
 				continue
 			}
-			parts := strings.Fields(line)
-			if len(parts) != 2 {
-				continue
-			}
-			name := parts[0]
-			id := parts[1]
-			if _, ok := desired[id]; ok {
-				continue
-			}
-			log.Printf("removing stale container %s", name)
-			_ = runDocker(ctx, "rm", "-f", name)
+			log.Printf("removing stale container %s", container.Name)
+			_ = cfg.runtime.Remove(ctx, container.Name)
 		}
 	}
 
-	dirs, err := os.ReadDir(cfg.composeDir)
-	if err == nil {
-		for _, entry := range dirs {
-			if !entry.IsDir() {
-				continue
-			}
-			id := entry.Name()
-			if _, ok := desired[id]; ok {
-				continue
-			}
-			composePath := filepath.Join(cfg.composeDir, id, "docker-compose.yml")
-			if _, statErr := os.Stat(composePath); statErr == nil {
-				log.Printf("bringing down compose stack for service %s", id)
-				_ = runDocker(ctx, "compose", "-f", composePath, "-p", "mdp-"+id, "down", "--remove-orphans")
+	if cfg.runtime.Capabilities().Compose {
+		dirs, err := os.ReadDir(cfg.composeDir)
+		if err == nil {
+			for _, entry := range dirs {
+				if !entry.IsDir() {
+					continue
+				}
+				id := entry.Name()
+				if _, ok := desired[id]; ok {
+					continue
+				}
+				composePath := filepath.Join(cfg.composeDir, id, "docker-compose.yml")
+				if _, statErr := os.Stat(composePath); statErr == nil {
+					log.Printf("bringing down compose stack for service %s", id)
+					_ = cfg.runtime.ComposeDown(ctx, ComposeSpec{ServiceID: id, ComposeFile: composePath, Project: "mdp-" + id})
+				}
 			}
 		}
 	}
 	return nil
 }
 
-func runDocker(ctx context.Context, args ...string) error {
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
-func runDockerOutput(ctx context.Context, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
-}
-
-func dockerInspect(ctx context.Context, container string, format string) (string, error) {
-	cmd := exec.CommandContext(ctx, "docker", "inspect", "--format", format, container)
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
-	cmd.Stderr = &bytes.Buffer{}
-	if err := cmd.Run(); err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(buf.String()), nil
-}
-
 func envOrDefault(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// errContainerNotFound is returned by Runtime.Inspect when name isn't a
+// container the runtime knows about, mirroring the store package's
+// ErrNotFound sentinel style.
+var errContainerNotFound = errors.New("runtime: container not found")
+
+// Capabilities describes what a Runtime backend can do, so the reconcile
+// loop can degrade gracefully instead of assuming every backend behaves
+// like Docker.
+type Capabilities struct {
+	// Compose reports whether ComposeUp/ComposeDown are implemented. A
+	// service that declares a compose stack is skipped with a warning
+	// when the active runtime doesn't support it, rather than failing
+	// the whole reconcile pass.
+	Compose bool
+}
+
+// ContainerSpec is the desired state for a single, non-compose container.
+type ContainerSpec struct {
+	Name         string
+	Image        string
+	InternalPort int
+	Labels       map[string]string
+}
+
+// ContainerInfo is what Runtime.Inspect reports about a running container.
+type ContainerInfo struct {
+	Image   string
+	Running bool
+}
+
+// ComposeSpec points at a rendered compose file on disk for a service.
+type ComposeSpec struct {
+	ServiceID   string
+	ComposeFile string
+	Project     string
+}
+
+// ManagedContainer is one container the runtime is tracking on mdp's
+// behalf, as reported by ListManaged.
+type ManagedContainer struct {
+	Name      string
+	ServiceID string
+}
+
+// Runtime abstracts the container engine the agent reconciles services
+// against. Docker is the default; Podman and a rootless runc/OCI backend
+// cover hosts without (or unwilling to run) a Docker daemon.
+type Runtime interface {
+	Name() string
+	Capabilities() Capabilities
+	Pull(ctx context.Context, image string) error
+	// Ensure makes spec's container exist and run the declared image,
+	// recreating it if the running image has drifted. No-op if it's
+	// already correct and running.
+	Ensure(ctx context.Context, spec ContainerSpec) error
+	// Inspect returns errContainerNotFound if name doesn't exist.
+	Inspect(ctx context.Context, name string) (ContainerInfo, error)
+	Remove(ctx context.Context, name string) error
+	ComposeUp(ctx context.Context, spec ComposeSpec) error
+	ComposeDown(ctx context.Context, spec ComposeSpec) error
+	ListManaged(ctx context.Context) ([]ManagedContainer, error)
+}
+
+// selectRuntime resolves the --runtime flag / AGENT_RUNTIME value to a
+// Runtime backend.
+func selectRuntime(name string) (Runtime, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "docker":
+		return &dockerRuntime{}, nil
+	case "podman":
+		return &podmanRuntime{}, nil
+	case "runc":
+		return newRuncRuntime(), nil
+	default:
+		return nil, fmt.Errorf("unknown runtime %q (want docker, podman, or runc)", name)
+	}
+}
+
+// runCommand runs name with args, streaming stdout/stderr to the agent's
+// own, matching how the control plane surfaces build job output.
+func runCommand(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// commandOutput runs name with args and returns captured stdout, for
+// callers that need to parse the result (inspect formats, ps output).
+func commandOutput(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &bytes.Buffer{}
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// parseManagedContainers parses the "name serviceID" lines produced by
+// docker/podman `ps --format {{.Names}} {{.Label "mdp.service"}}`.
+func parseManagedContainers(output string) []ManagedContainer {
+	var managed []ManagedContainer
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		managed = append(managed, ManagedContainer{Name: parts[0], ServiceID: parts[1]})
+	}
+	return managed
+}
+
+// sanitizeRuntimeKey mirrors the control plane's sanitizeKey: lowercase,
+// every rune outside [a-z0-9] replaced by its own '-' (runs are not
+// collapsed), leading/trailing dashes trimmed. Used to derive
+// filesystem-safe names from image references.
+func sanitizeRuntimeKey(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
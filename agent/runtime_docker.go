@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// mdpServiceLabel is the label ensureContainer/ensureComposeService stamp
+// on every container they manage, so ListManaged/cleanupServices can tell
+// mdp-owned containers apart from anything else on the host.
+const mdpServiceLabel = "mdp.service"
+
+// dockerRuntime is the default Runtime backend: the Docker CLI plus
+// `docker compose` for compose-based services.
+type dockerRuntime struct{}
+
+func (dockerRuntime) Name() string { return "docker" }
+
+func (dockerRuntime) Capabilities() Capabilities { return Capabilities{Compose: true} }
+
+func (dockerRuntime) Pull(ctx context.Context, image string) error {
+	return runCommand(ctx, "docker", "pull", image)
+}
+
+func (dockerRuntime) Inspect(ctx context.Context, name string) (ContainerInfo, error) {
+	image, err := commandOutput(ctx, "docker", "inspect", "--format", "{{.Config.Image}}", name)
+	if err != nil {
+		return ContainerInfo{}, errContainerNotFound
+	}
+	state, err := commandOutput(ctx, "docker", "inspect", "--format", "{{.State.Running}}", name)
+	if err != nil {
+		return ContainerInfo{}, errContainerNotFound
+	}
+	return ContainerInfo{
+		Image:   strings.TrimSpace(image),
+		Running: strings.TrimSpace(state) == "true",
+	}, nil
+}
+
+func (d dockerRuntime) Ensure(ctx context.Context, spec ContainerSpec) error {
+	info, err := d.Inspect(ctx, spec.Name)
+	if err == nil && info.Image == spec.Image {
+		if info.Running {
+			return nil
+		}
+		return runCommand(ctx, "docker", "start", spec.Name)
+	}
+
+	_ = d.Remove(ctx, spec.Name)
+
+	args := []string{"run", "-d", "--restart", "unless-stopped", "--name", spec.Name}
+	for key, value := range spec.Labels {
+		args = append(args, "--label", key+"="+value)
+	}
+	if spec.InternalPort != 0 {
+		args = append(args, "-p", fmt.Sprintf("127.0.0.1:%d:%d", spec.InternalPort, spec.InternalPort))
+	}
+	args = append(args, spec.Image)
+	return runCommand(ctx, "docker", args...)
+}
+
+func (dockerRuntime) Remove(ctx context.Context, name string) error {
+	return runCommand(ctx, "docker", "rm", "-f", name)
+}
+
+func (dockerRuntime) ComposeUp(ctx context.Context, spec ComposeSpec) error {
+	if err := runCommand(ctx, "docker", "compose", "-f", spec.ComposeFile, "-p", spec.Project, "pull"); err != nil {
+		log.Printf("compose pull warning: %v", err)
+	}
+	return runCommand(ctx, "docker", "compose", "-f", spec.ComposeFile, "-p", spec.Project, "up", "-d", "--remove-orphans")
+}
+
+func (dockerRuntime) ComposeDown(ctx context.Context, spec ComposeSpec) error {
+	return runCommand(ctx, "docker", "compose", "-f", spec.ComposeFile, "-p", spec.Project, "down", "--remove-orphans")
+}
+
+func (dockerRuntime) ListManaged(ctx context.Context) ([]ManagedContainer, error) {
+	output, err := commandOutput(ctx, "docker", "ps", "-a",
+		"--filter", "label="+mdpServiceLabel,
+		"--format", `{{.Names}} {{.Label "`+mdpServiceLabel+`"}}`)
+	if err != nil {
+		return nil, err
+	}
+	return parseManagedContainers(output), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// podmanRuntime targets rootless Podman hosts. Single-container lifecycle
+// mirrors Docker (Podman's CLI is intentionally compatible); compose
+// stacks go through the separate podman-compose binary since Podman
+// itself doesn't speak Compose YAML natively.
+type podmanRuntime struct{}
+
+func (podmanRuntime) Name() string { return "podman" }
+
+func (podmanRuntime) Capabilities() Capabilities { return Capabilities{Compose: true} }
+
+func (podmanRuntime) Pull(ctx context.Context, image string) error {
+	return runCommand(ctx, "podman", "pull", image)
+}
+
+func (podmanRuntime) Inspect(ctx context.Context, name string) (ContainerInfo, error) {
+	image, err := commandOutput(ctx, "podman", "inspect", "--format", "{{.Config.Image}}", name)
+	if err != nil {
+		return ContainerInfo{}, errContainerNotFound
+	}
+	state, err := commandOutput(ctx, "podman", "inspect", "--format", "{{.State.Running}}", name)
+	if err != nil {
+		return ContainerInfo{}, errContainerNotFound
+	}
+	return ContainerInfo{
+		Image:   strings.TrimSpace(image),
+		Running: strings.TrimSpace(state) == "true",
+	}, nil
+}
+
+func (p podmanRuntime) Ensure(ctx context.Context, spec ContainerSpec) error {
+	info, err := p.Inspect(ctx, spec.Name)
+	if err == nil && info.Image == spec.Image {
+		if info.Running {
+			return nil
+		}
+		return runCommand(ctx, "podman", "start", spec.Name)
+	}
+
+	_ = p.Remove(ctx, spec.Name)
+
+	args := []string{"run", "-d", "--restart", "unless-stopped", "--name", spec.Name}
+	for key, value := range spec.Labels {
+		args = append(args, "--label", key+"="+value)
+	}
+	if spec.InternalPort != 0 {
+		args = append(args, "-p", fmt.Sprintf("127.0.0.1:%d:%d", spec.InternalPort, spec.InternalPort))
+	}
+	args = append(args, spec.Image)
+	return runCommand(ctx, "podman", args...)
+}
+
+func (podmanRuntime) Remove(ctx context.Context, name string) error {
+	return runCommand(ctx, "podman", "rm", "-f", name)
+}
+
+func (podmanRuntime) ComposeUp(ctx context.Context, spec ComposeSpec) error {
+	if err := runCommand(ctx, "podman-compose", "-f", spec.ComposeFile, "-p", spec.Project, "pull"); err != nil {
+		log.Printf("compose pull warning: %v", err)
+	}
+	return runCommand(ctx, "podman-compose", "-f", spec.ComposeFile, "-p", spec.Project, "up", "-d")
+}
+
+func (podmanRuntime) ComposeDown(ctx context.Context, spec ComposeSpec) error {
+	return runCommand(ctx, "podman-compose", "-f", spec.ComposeFile, "-p", spec.Project, "down")
+}
+
+func (podmanRuntime) ListManaged(ctx context.Context) ([]ManagedContainer, error) {
+	output, err := commandOutput(ctx, "podman", "ps", "-a",
+		"--filter", "label="+mdpServiceLabel,
+		"--format", `{{.Names}} {{.Label "`+mdpServiceLabel+`"}}`)
+	if err != nil {
+		return nil, err
+	}
+	return parseManagedContainers(output), nil
+}
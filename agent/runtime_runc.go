@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runcRuntime targets hosts with no container daemon at all: images are
+// fetched straight to an OCI layout with skopeo, unpacked to a bundle
+// rootfs with umoci, and run with rootless runc. It doesn't understand
+// Compose, so Capabilities().Compose is false and the reconcile loop
+// skips compose-declared services rather than failing them.
+type runcRuntime struct {
+	// bundleRoot holds one subdirectory per container (its OCI bundle)
+	// plus an "images" subdirectory of pulled OCI layouts.
+	bundleRoot string
+}
+
+func newRuncRuntime() *runcRuntime {
+	return &runcRuntime{bundleRoot: envOrDefault("AGENT_RUNC_ROOT", "/var/lib/mdp-agent/runc")}
+}
+
+func (r *runcRuntime) Name() string { return "runc" }
+
+func (r *runcRuntime) Capabilities() Capabilities { return Capabilities{Compose: false} }
+
+func (r *runcRuntime) imageLayout(image string) string {
+	return "oci:" + filepath.Join(r.bundleRoot, "images", sanitizeRuntimeKey(image)) + ":latest"
+}
+
+func (r *runcRuntime) bundleDir(name string) string {
+	return filepath.Join(r.bundleRoot, name)
+}
+
+func (r *runcRuntime) Pull(ctx context.Context, image string) error {
+	dest := filepath.Join(r.bundleRoot, "images", sanitizeRuntimeKey(image))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("images dir: %w", err)
+	}
+	return runCommand(ctx, "skopeo", "copy", "docker://"+image, r.imageLayout(image))
+}
+
+// runcState is the subset of `runc state` this backend reads back. The
+// image a container is running isn't part of runc's own state, so Ensure
+// stamps it into the bundle's config.json annotations at create time.
+type runcState struct {
+	Status      string            `json:"status"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (r *runcRuntime) Inspect(ctx context.Context, name string) (ContainerInfo, error) {
+	out, err := commandOutput(ctx, "runc", "state", name)
+	if err != nil {
+		return ContainerInfo{}, errContainerNotFound
+	}
+	var state runcState
+	if err := json.Unmarshal([]byte(out), &state); err != nil {
+		return ContainerInfo{}, fmt.Errorf("parse runc state: %w", err)
+	}
+	return ContainerInfo{
+		Image:   state.Annotations["mdp.image"],
+		Running: state.Status == "running",
+	}, nil
+}
+
+func (r *runcRuntime) Ensure(ctx context.Context, spec ContainerSpec) error {
+	info, err := r.Inspect(ctx, spec.Name)
+	if err == nil && info.Image == spec.Image && info.Running {
+		return nil
+	}
+	_ = r.Remove(ctx, spec.Name)
+
+	bundle := r.bundleDir(spec.Name)
+	rootfs := filepath.Join(bundle, "rootfs")
+	if err := os.MkdirAll(bundle, 0o755); err != nil {
+		return fmt.Errorf("bundle dir: %w", err)
+	}
+	if err := runCommand(ctx, "umoci", "unpack", "--image", r.imageLayout(spec.Image), rootfs); err != nil {
+		return fmt.Errorf("unpack rootfs: %w", err)
+	}
+	if err := runCommand(ctx, "runc", "spec", "--bundle", bundle, "--rootless"); err != nil {
+		return fmt.Errorf("generate spec: %w", err)
+	}
+	// Port publishing without a daemon is the operator's job (host
+	// networking or a slirp4netns sidecar); the port is neither published
+	// nor recorded. annotateBundle stamps the image and labels into the
+	// bundle so Inspect can report the image back.
+	if err := r.annotateBundle(bundle, spec); err != nil {
+		return err
+	}
+	return runCommand(ctx, "runc", "run", "-d", "--bundle", bundle, spec.Name)
+}
+
+func (r *runcRuntime) annotateBundle(bundle string, spec ContainerSpec) error {
+	path := filepath.Join(bundle, "config.json")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read runc config: %w", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("parse runc config: %w", err)
+	}
+	annotations, _ := doc["annotations"].(map[string]any)
+	if annotations == nil {
+		annotations = map[string]any{}
+	}
+	annotations["mdp.image"] = spec.Image
+	for key, value := range spec.Labels {
+		annotations[key] = value
+	}
+	doc["annotations"] = annotations
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode runc config: %w", err)
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+func (r *runcRuntime) Remove(ctx context.Context, name string) error {
+	_ = runCommand(ctx, "runc", "delete", "-f", name)
+	return os.RemoveAll(r.bundleDir(name))
+}
+
+func (r *runcRuntime) ComposeUp(ctx context.Context, spec ComposeSpec) error {
+	return fmt.Errorf("runc backend does not support compose stacks")
+}
+
+func (r *runcRuntime) ComposeDown(ctx context.Context, spec ComposeSpec) error {
+	return fmt.Errorf("runc backend does not support compose stacks")
+}
+
+func (r *runcRuntime) ListManaged(ctx context.Context) ([]ManagedContainer, error) {
+	entries, err := os.ReadDir(r.bundleRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var managed []ManagedContainer
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "images" {
+			continue
+		}
+		managed = append(managed, ManagedContainer{
+			Name:      entry.Name(),
+			ServiceID: strings.TrimPrefix(entry.Name(), "svc-"),
+		})
+	}
+	return managed, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// buildInfo describes how an image was produced, reported back to the
+// control plane alongside the image artifact.
+type buildInfo struct {
+	Builder  string
+	Language string
+	Version  string
+}
+
+// Builder produces a container image from a workdir.
+type Builder interface {
+	// Name identifies the builder for logging and job reporting.
+	Name() string
+	// Build produces an image tagged as imageName from workdir. secrets
+	// holds the job's build-time secret values; a builder that can't wire
+	// them in safely (nixpacks, buildpacks) is free to ignore them.
+	Build(ctx context.Context, workdir, imageName string, secrets []string) error
+}
+
+func newBuilder(kind string, cfg workerConfig) (Builder, error) {
+	switch kind {
+	case "", "docker":
+		return dockerBuilder{cfg: cfg}, nil
+	case "buildpacks":
+		return buildpacksBuilder{cfg: cfg}, nil
+	case "nixpacks":
+		return nixpacksBuilder{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("unknown builder: %s", kind)
+	}
+}
+
+// detectBuilder inspects workdir and picks a builder + language when the
+// worker is configured with --builder=auto.
+func detectBuilder(workdir string) (kind string, language string) {
+	if fileExists(filepath.Join(workdir, "Dockerfile")) {
+		return "docker", ""
+	}
+	if fileExists(filepath.Join(workdir, "go.mod")) {
+		return "nixpacks", "go"
+	}
+	if fileExists(filepath.Join(workdir, "package.json")) {
+		return "nixpacks", "node"
+	}
+	if fileExists(filepath.Join(workdir, "requirements.txt")) {
+		return "buildpacks", "python"
+	}
+	if fileExists(filepath.Join(workdir, "Procfile")) {
+		return "buildpacks", "procfile"
+	}
+	return "docker", ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type dockerBuilder struct {
+	cfg workerConfig
+}
+
+func (dockerBuilder) Name() string { return "docker" }
+
+// Build runs `docker build`, wiring secrets in via BuildKit's --secret flag
+// (one id per secret, backed by a file in a temp directory outside workdir) so
+// they're available to RUN steps as /run/secrets/<id> without ever being
+// baked into an image layer or exposed as a --build-arg.
+func (b dockerBuilder) Build(ctx context.Context, workdir, imageName string, secrets []string) error {
+	log.Printf("[worker %s] docker build %s", b.cfg.name, imageName)
+
+	secretDir, cleanup, err := writeBuildSecrets(secrets)
+	if err != nil {
+		return fmt.Errorf("write build secrets: %w", err)
+	}
+	defer cleanup()
+
+	args := []string{"build", "-t", imageName}
+	if b.cfg.buildCPU != "" {
+		args = append(args, "--cpu-quota", b.cfg.buildCPU)
+	}
+	if b.cfg.buildMemory != "" {
+		args = append(args, "--memory", b.cfg.buildMemory)
+	}
+	for i := range secrets {
+		args = append(args, "--secret", fmt.Sprintf("id=secret%d,src=%s", i, filepath.Join(secretDir, fmt.Sprintf("secret%d", i))))
+	}
+	args = append(args, ".")
+
+	return runCommand(ctx, b.cfg, workdir, dockerEnv(), "docker", args...)
+}
+
+// writeBuildSecrets writes each secret value to its own 0600 file in a
+// fresh temp directory (outside the build context, so it can never be
+// COPYed into an image) and returns a cleanup func to remove it.
+func writeBuildSecrets(secrets []string) (string, func(), error) {
+	noop := func() {}
+	if len(secrets) == 0 {
+		return "", noop, nil
+	}
+	dir, err := os.MkdirTemp("", "build-secrets-")
+	if err != nil {
+		return "", noop, err
+	}
+	for i, secret := range secrets {
+		path := filepath.Join(dir, fmt.Sprintf("secret%d", i))
+		if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", noop, err
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+type buildpacksBuilder struct {
+	cfg workerConfig
+}
+
+func (buildpacksBuilder) Name() string { return "buildpacks" }
+
+func (b buildpacksBuilder) Build(ctx context.Context, workdir, imageName string, secrets []string) error {
+	log.Printf("[worker %s] pack build %s", b.cfg.name, imageName)
+	return runCommand(ctx, b.cfg, workdir, nil, "pack", "build", imageName, "--path", ".")
+}
+
+type nixpacksBuilder struct {
+	cfg workerConfig
+}
+
+func (nixpacksBuilder) Name() string { return "nixpacks" }
+
+func (b nixpacksBuilder) Build(ctx context.Context, workdir, imageName string, secrets []string) error {
+	log.Printf("[worker %s] nixpacks build %s", b.cfg.name, imageName)
+	return runCommand(ctx, b.cfg, workdir, nil, "nixpacks", "build", ".", "--name", imageName)
+}
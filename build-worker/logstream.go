@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logSinkKey struct{}
+
+func withLogSink(ctx context.Context, sink *logStreamer) context.Context {
+	return context.WithValue(ctx, logSinkKey{}, sink)
+}
+
+func logSinkFromContext(ctx context.Context) *logStreamer {
+	sink, _ := ctx.Value(logSinkKey{}).(*logStreamer)
+	return sink
+}
+
+const heartbeatInterval = 30 * time.Second
+
+// logStreamer batches lines written to it and uploads them to the control
+// plane in order, tagged with an increasing sequence number. It implements
+// io.Writer so it can sit alongside os.Stdout/os.Stderr on an exec.Cmd.
+type logStreamer struct {
+	client   *http.Client
+	cfg      workerConfig
+	jobID    string
+	redactor *SecretRedactor
+
+	mu      sync.Mutex
+	partial string
+	seq     int
+	pending []string
+}
+
+func newLogStreamer(client *http.Client, cfg workerConfig, jobID string, redactor *SecretRedactor) *logStreamer {
+	return &logStreamer{client: client, cfg: cfg, jobID: jobID, redactor: redactor}
+}
+
+func (l *logStreamer) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.redactor != nil {
+		p = []byte(l.redactor.Redact(string(p)))
+	}
+
+	l.mu.Lock()
+	l.partial += string(p)
+	lines := strings.Split(l.partial, "\n")
+	l.partial = lines[len(lines)-1]
+	complete := lines[:len(lines)-1]
+	l.pending = append(l.pending, complete...)
+	shouldFlush := len(l.pending) >= 20
+	l.mu.Unlock()
+
+	if shouldFlush {
+		l.flush(false)
+	}
+	return n, nil
+}
+
+// Close flushes any buffered lines, including a trailing partial line, and
+// marks the upload as final.
+func (l *logStreamer) Close() {
+	l.mu.Lock()
+	if l.partial != "" {
+		l.pending = append(l.pending, l.partial)
+		l.partial = ""
+	}
+	l.mu.Unlock()
+	l.flush(true)
+}
+
+func (l *logStreamer) flush(final bool) {
+	l.mu.Lock()
+	if len(l.pending) == 0 && !final {
+		l.mu.Unlock()
+		return
+	}
+	lines := l.pending
+	l.pending = nil
+	l.seq++
+	seq := l.seq
+	l.mu.Unlock()
+
+	if len(lines) == 0 && !final {
+		return
+	}
+
+	payload := map[string]any{
+		"sequence": seq,
+		"lines":    lines,
+		"final":    final,
+	}
+	data, _ := json.Marshal(payload)
+
+	req, err := http.NewRequest(http.MethodPost, l.cfg.controlPlane+"/v1/build-jobs/"+l.jobID+"/logs", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("[worker %s] log upload build request failed: %v", l.cfg.name, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.cfg.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+l.cfg.apiToken)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		log.Printf("[worker %s] log upload failed: %v", l.cfg.name, err)
+		return
+	}
+	_ = resp.Body.Close()
+}
+
+// startHeartbeat pings the control plane every heartbeatInterval while ctx
+// is alive, letting it detect a dead worker and reclaim the job's lease.
+func startHeartbeat(ctx context.Context, client *http.Client, cfg workerConfig, jobID string) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				sendHeartbeat(ctx, client, cfg, jobID)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func sendHeartbeat(ctx context.Context, client *http.Client, cfg workerConfig, jobID string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.controlPlane+"/v1/build-jobs/"+jobID+"/heartbeat", nil)
+	if err != nil {
+		return
+	}
+	if cfg.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.apiToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("[worker %s] heartbeat failed for job %s: %v", cfg.name, jobID, err)
+		return
+	}
+	_ = resp.Body.Close()
+}
@@ -14,22 +14,35 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 type workerConfig struct {
-	controlPlane   string
-	apiToken       string
-	name           string
-	pollInterval   time.Duration
-	autoComplete   bool
-	completionMsg  string
-	workspace      string
-	registryPrefix string
-	pushImages     bool
-	keepWorkspace  bool
-	githubToken    string
+	controlPlane      string
+	apiToken          string
+	name              string
+	pollInterval      time.Duration
+	autoComplete      bool
+	completionMsg     string
+	workspace         string
+	registryPrefix    string
+	pushImages        bool
+	keepWorkspace     bool
+	githubToken       string
+	gitlabToken       string
+	giteaToken        string
+	bitbucketToken    string
+	sshKeyPath        string
+	builder           string
+	maxRetries        int
+	secretEnvPrefixes []string
+	concurrency       int
+	pushConcurrency   int
+	buildCPU          string
+	buildMemory       string
+	uploadArtifacts   bool
 }
 
 func main() {
@@ -59,46 +72,100 @@ func parseFlags() workerConfig {
 	push := flag.Bool("push", false, "Push built images to registry")
 	keep := flag.Bool("keep-workspace", false, "Keep workspace after builds")
 	ghToken := flag.String("github-token", os.Getenv("GITHUB_TOKEN"), "GitHub token for cloning private repos")
+	glToken := flag.String("gitlab-token", os.Getenv("GITLAB_TOKEN"), "GitLab token for cloning private repos")
+	giToken := flag.String("gitea-token", os.Getenv("GITEA_TOKEN"), "Gitea token for cloning private repos")
+	bbToken := flag.String("bitbucket-token", os.Getenv("BITBUCKET_TOKEN"), "Bitbucket token for cloning private repos")
+	sshKey := flag.String("ssh-key", os.Getenv("BUILD_WORKER_SSH_KEY"), "Path to an SSH private key for git+ssh clones")
+	builder := flag.String("builder", envOrDefault("BUILD_WORKER_BUILDER", "docker"), "Build strategy: docker, buildpacks, nixpacks, auto")
+	maxRetries := flag.Int("max-retries", 3, "Number of local retries for transient build failures (git clone, docker push, network errors)")
+	secretEnvPrefix := flag.String("secret-env-prefix", envOrDefault("BUILD_WORKER_SECRET_ENV_PREFIX", "BUILD_SECRET_"), "Comma-separated env var name prefixes whose values are treated as build secrets and redacted from logs")
+	concurrency := flag.Int("concurrency", 1, "Maximum number of build jobs to run at once")
+	pushConcurrency := flag.Int("push-concurrency", 1, "Maximum number of concurrent `docker push` calls across all jobs")
+	buildCPU := flag.String("build-cpu", "", "docker build --cpu-quota value (empty disables the limit)")
+	buildMemory := flag.String("build-memory", "", "docker build --memory value, e.g. 512m (empty disables the limit)")
+	uploadArtifacts := flag.Bool("upload-artifacts", false, "docker save the built image and upload it to the control plane's object storage")
 	flag.Parse()
 
 	return workerConfig{
-		controlPlane:   strings.TrimRight(*control, "/"),
-		apiToken:       *token,
-		name:           *name,
-		pollInterval:   *interval,
-		autoComplete:   *auto,
-		completionMsg:  *reason,
-		workspace:      *workspace,
-		registryPrefix: strings.TrimRight(*registry, "/"),
-		pushImages:     *push,
-		keepWorkspace:  *keep,
-		githubToken:    *ghToken,
+		controlPlane:      strings.TrimRight(*control, "/"),
+		apiToken:          *token,
+		name:              *name,
+		pollInterval:      *interval,
+		autoComplete:      *auto,
+		completionMsg:     *reason,
+		workspace:         *workspace,
+		registryPrefix:    strings.TrimRight(*registry, "/"),
+		pushImages:        *push,
+		keepWorkspace:     *keep,
+		githubToken:       *ghToken,
+		gitlabToken:       *glToken,
+		giteaToken:        *giToken,
+		bitbucketToken:    *bbToken,
+		sshKeyPath:        *sshKey,
+		builder:           *builder,
+		maxRetries:        *maxRetries,
+		secretEnvPrefixes: splitAndTrim(*secretEnvPrefix, ","),
+		concurrency:       *concurrency,
+		pushConcurrency:   *pushConcurrency,
+		buildCPU:          *buildCPU,
+		buildMemory:       *buildMemory,
+		uploadArtifacts:   *uploadArtifacts,
 	}
 }
 
+// splitAndTrim splits s on sep, trims whitespace from each part, and drops
+// empty results.
+func splitAndTrim(s, sep string) []string {
+	var out []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// run polls the control plane on an interval and fans claimed jobs out to a
+// bounded pool of job goroutines, so up to cfg.concurrency builds run at
+// once, each in its own job.ID-keyed workspace.
 func run(ctx context.Context, cfg workerConfig) error {
-	client := &http.Client{Timeout: 30 * time.Second}
-	log.Printf("build worker %s polling %s every %s", cfg.name, cfg.controlPlane, cfg.pollInterval)
+	client := &http.Client{Timeout: cfg.pollInterval + 30*time.Second}
+	log.Printf("build worker %s polling %s every %s (concurrency=%d)", cfg.name, cfg.controlPlane, cfg.pollInterval, cfg.concurrency)
+
+	pool := newWorkerPool(cfg.concurrency, cfg.pushConcurrency)
+	ctx = withPool(ctx, pool)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
 	ticker := time.NewTicker(cfg.pollInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("worker exiting")
+			log.Println("worker exiting, waiting for in-flight jobs")
 			return nil
 		case <-ticker.C:
-			job, err := claimJob(ctx, client, cfg)
-			if err != nil {
-				log.Printf("claim error: %v", err)
-				continue
-			}
-			if job == nil {
-				continue
-			}
-
-			if err := processJob(ctx, client, cfg, job); err != nil {
-				log.Printf("job %s failed: %v", job.ID, err)
+			for pool.availableSlots() > 0 {
+				job, err := claimJob(ctx, client, cfg, pool)
+				if err != nil {
+					log.Printf("claim error: %v", err)
+					break
+				}
+				if job == nil {
+					break
+				}
+
+				pool.acquire()
+				wg.Add(1)
+				go func(job *buildJob) {
+					defer wg.Done()
+					defer pool.release()
+					if err := processJob(ctx, client, cfg, job); err != nil {
+						log.Printf("job %s failed: %v", job.ID, err)
+					}
+				}(job)
 			}
 		}
 	}
@@ -109,18 +176,32 @@ type buildJob struct {
 	Repository   string   `json:"repository"`
 	Ref          string   `json:"ref"`
 	Commit       string   `json:"commit"`
+	Provider     string   `json:"provider"`
 	Installation string   `json:"installation"`
 	Status       string   `json:"status"`
 	ServiceID    string   `json:"service_id"`
 	Environment  string   `json:"environment"`
 	ComposePath  string   `json:"compose_path"`
+	Attempt      int      `json:"attempt"`
+	Secrets      []string `json:"secrets"`
+	// Kind is "" (normal build/deploy) or "teardown", the latter enqueued
+	// when a preview PR closes - see processJob.
+	Kind string `json:"kind,omitempty"`
+	// PullRequest is the PR/MR number this job was triggered by, 0 for a
+	// plain push.
+	PullRequest int `json:"pull_request,omitempty"`
 }
 
-func claimJob(ctx context.Context, client *http.Client, cfg workerConfig) (*buildJob, error) {
-	body := map[string]string{"worker": cfg.name}
+func claimJob(ctx context.Context, client *http.Client, cfg workerConfig, pool *workerPool) (*buildJob, error) {
+	active, capacity := pool.load()
+	body := map[string]any{"worker": cfg.name, "active": active, "capacity": capacity}
 	payload, _ := json.Marshal(body)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.controlPlane+"/v1/build-jobs/claim", bytes.NewReader(payload))
+	// wait ties the claim call to a long-poll: the control plane blocks up
+	// to cfg.pollInterval before answering 204, so idle capacity gets a job
+	// the instant one is enqueued instead of only on the next tick.
+	claimURL := fmt.Sprintf("%s/v1/build-jobs/claim?wait=%s", cfg.controlPlane, cfg.pollInterval)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, claimURL, bytes.NewReader(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -158,9 +239,30 @@ func claimJob(ctx context.Context, client *http.Client, cfg workerConfig) (*buil
 func processJob(ctx context.Context, client *http.Client, cfg workerConfig, job *buildJob) error {
 	log.Printf("claimed job %s (%s @ %s)", job.ID, job.Repository, job.Commit)
 
-	artifacts, composeData, err := performBuild(ctx, cfg, job)
+	redactor := newSecretRedactor(cfg, job)
+	ctx = withRedactor(ctx, redactor)
+
+	sink := newLogStreamer(client, cfg, job.ID, redactor)
+	defer sink.Close()
+	ctx = withLogSink(ctx, sink)
+
+	stopHeartbeat := startHeartbeat(ctx, client, cfg, job.ID)
+	defer stopHeartbeat()
+
+	if job.Kind == "teardown" {
+		if err := teardownPreview(ctx, cfg, job); err != nil {
+			updateJob(ctx, client, cfg, job.ID, "failed", fmt.Sprintf("teardown error: %v", err), nil, "", buildInfo{})
+			return err
+		}
+		if err := updateJob(ctx, client, cfg, job.ID, "succeeded", cfg.completionMsg, nil, "", buildInfo{}); err != nil {
+			log.Printf("update job error: %v", err)
+		}
+		return nil
+	}
+
+	artifacts, composeData, info, err := performBuildWithRetry(ctx, cfg, job)
 	if err != nil {
-		updateJob(ctx, client, cfg, job.ID, "failed", fmt.Sprintf("build error: %v", err), nil, "")
+		updateJob(ctx, client, cfg, job.ID, "failed", fmt.Sprintf("build error: %v", err), nil, "", buildInfo{})
 		return err
 	}
 
@@ -172,12 +274,21 @@ func processJob(ctx context.Context, client *http.Client, cfg workerConfig, job
 		}
 		if len(artifacts) > 0 {
 			if err := applyDeployment(ctx, client, cfg, job, artifacts[0]); err != nil {
-				updateJob(ctx, client, cfg, job.ID, "failed", fmt.Sprintf("deploy error: %v", err), nil, job.ComposePath)
+				updateJob(ctx, client, cfg, job.ID, "failed", fmt.Sprintf("deploy error: %v", err), nil, job.ComposePath, info)
 				return err
 			}
 		}
 	}
 
+	if cfg.uploadArtifacts && len(artifacts) > 0 {
+		if err := uploadImageArtifact(ctx, client, cfg, job, artifacts[0]); err != nil {
+			// The image already exists locally/in the registry, so a failed
+			// artifact upload shouldn't fail the whole job - just means no
+			// presigned copy is sitting in object storage to reuse later.
+			log.Printf("[worker %s] artifact upload failed: %v", cfg.name, err)
+		}
+	}
+
 	status := "running"
 	reason := cfg.completionMsg
 	artifactList := artifacts
@@ -186,13 +297,13 @@ func processJob(ctx context.Context, client *http.Client, cfg workerConfig, job
 	} else {
 		artifactList = nil
 	}
-	if err := updateJob(ctx, client, cfg, job.ID, status, reason, artifactList, job.ComposePath); err != nil {
+	if err := updateJob(ctx, client, cfg, job.ID, status, reason, artifactList, job.ComposePath, info); err != nil {
 		log.Printf("update job error: %v", err)
 	}
 	return nil
 }
 
-func updateJob(ctx context.Context, client *http.Client, cfg workerConfig, id, status, reason string, artifacts []string, composePath string) error {
+func updateJob(ctx context.Context, client *http.Client, cfg workerConfig, id, status, reason string, artifacts []string, composePath string, info buildInfo) error {
 	payload := map[string]any{}
 	if status != "" {
 		payload["status"] = status
@@ -206,6 +317,15 @@ func updateJob(ctx context.Context, client *http.Client, cfg workerConfig, id, s
 	if composePath != "" {
 		payload["compose_path"] = composePath
 	}
+	if info.Builder != "" {
+		payload["builder"] = info.Builder
+	}
+	if info.Language != "" {
+		payload["language"] = info.Language
+	}
+	if info.Version != "" {
+		payload["builder_version"] = info.Version
+	}
 	data, _ := json.Marshal(payload)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, cfg.controlPlane+"/v1/build-jobs/"+id, bytes.NewReader(data))
@@ -230,24 +350,23 @@ func updateJob(ctx context.Context, client *http.Client, cfg workerConfig, id, s
 	return nil
 }
 
-func performBuild(ctx context.Context, cfg workerConfig, job *buildJob) ([]string, []byte, error) {
+func performBuild(ctx context.Context, cfg workerConfig, job *buildJob) ([]string, []byte, buildInfo, error) {
 	owner, name, err := splitRepo(job.Repository)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, buildInfo{}, err
 	}
 
 	workdir := filepath.Join(cfg.workspace, job.ID)
 	if err := os.RemoveAll(workdir); err != nil {
-		return nil, nil, fmt.Errorf("clean workspace: %w", err)
+		return nil, nil, buildInfo{}, fmt.Errorf("clean workspace: %w", err)
 	}
 
-	cloneURL := fmt.Sprintf("https://github.com/%s.git", job.Repository)
-	if cfg.githubToken != "" {
-		cloneURL = fmt.Sprintf("https://%s@github.com/%s.git", cfg.githubToken, job.Repository)
-	}
+	vcs := selectVCSProvider(job.Provider)
+	token := vcsToken(cfg, job.Provider)
+	cloneURL := vcs.CloneURL(job.Repository, token)
 
 	if err := runCommand(ctx, cfg, cfg.workspace, gitEnv(), "git", "clone", "--depth", "1", cloneURL, workdir); err != nil {
-		return nil, nil, fmt.Errorf("git clone: %w", err)
+		return nil, nil, buildInfo{}, fmt.Errorf("git clone: %w", err)
 	}
 
 	if !cfg.keepWorkspace {
@@ -255,15 +374,15 @@ func performBuild(ctx context.Context, cfg workerConfig, job *buildJob) ([]strin
 	}
 
 	if err := runCommand(ctx, cfg, workdir, gitEnv(), "git", "fetch", "--depth", "1", "origin", job.Commit); err != nil {
-		return nil, nil, fmt.Errorf("git fetch: %w", err)
+		return nil, nil, buildInfo{}, fmt.Errorf("git fetch: %w", err)
 	}
 
 	if err := runCommand(ctx, cfg, workdir, gitEnv(), "git", "checkout", job.Commit); err != nil {
-		return nil, nil, fmt.Errorf("git checkout: %w", err)
+		return nil, nil, buildInfo{}, fmt.Errorf("git checkout: %w", err)
 	}
 
-	if cfg.githubToken != "" {
-		_ = runCommand(ctx, cfg, workdir, gitEnv(), "git", "remote", "set-url", "origin", fmt.Sprintf("https://github.com/%s.git", job.Repository))
+	if token != "" {
+		_ = runCommand(ctx, cfg, workdir, gitEnv(), "git", "remote", "set-url", "origin", vcs.CloneURL(job.Repository, ""))
 	}
 
 	var composeData []byte
@@ -281,17 +400,37 @@ func performBuild(ctx context.Context, cfg workerConfig, job *buildJob) ([]strin
 		prefix = fmt.Sprintf("ghcr.io/%s", strings.ToLower(owner))
 	}
 	prefix = strings.TrimSuffix(prefix, "/")
-	imageName := fmt.Sprintf("%s/%s:%s", prefix, strings.ToLower(name), shortSHA(job.Commit))
+	tag := shortSHA(job.Commit)
+	if job.Attempt > 0 {
+		tag = fmt.Sprintf("%s-r%d", tag, job.Attempt)
+	}
+	imageName := fmt.Sprintf("%s/%s:%s", prefix, strings.ToLower(name), tag)
 
-	log.Printf("[worker %s] docker build %s", cfg.name, imageName)
-	if err := runCommand(ctx, cfg, workdir, dockerEnv(), "docker", "build", "-t", imageName, "."); err != nil {
-		return nil, nil, fmt.Errorf("docker build: %w", err)
+	builderKind := cfg.builder
+	language := ""
+	if builderKind == "auto" || builderKind == "" {
+		builderKind, language = detectBuilder(workdir)
+	}
+	builder, err := newBuilder(builderKind, cfg)
+	if err != nil {
+		return nil, nil, buildInfo{}, err
+	}
+	if err := builder.Build(ctx, workdir, imageName, job.Secrets); err != nil {
+		return nil, nil, buildInfo{}, fmt.Errorf("%s build: %w", builder.Name(), err)
 	}
+	info := buildInfo{Builder: builder.Name(), Language: language}
 
 	if cfg.pushImages {
+		if pool := poolFromContext(ctx); pool != nil {
+			release, err := pool.acquirePush(ctx)
+			if err != nil {
+				return nil, nil, buildInfo{}, err
+			}
+			defer release()
+		}
 		log.Printf("[worker %s] docker push %s", cfg.name, imageName)
 		if err := runCommand(ctx, cfg, "", nil, "docker", "push", imageName); err != nil {
-			return nil, nil, fmt.Errorf("docker push: %w", err)
+			return nil, nil, buildInfo{}, fmt.Errorf("docker push: %w", err)
 		}
 	}
 
@@ -299,20 +438,83 @@ func performBuild(ctx context.Context, cfg workerConfig, job *buildJob) ([]strin
 		log.Printf("[worker %s] auto-complete disabled; leaving job running", cfg.name)
 	}
 
-	return []string{imageName}, composeData, nil
+	return []string{imageName}, composeData, info, nil
+}
+
+// performBuildWithRetry retries performBuild on transient failures (clone,
+// push, network errors) with exponential backoff, bounded by
+// cfg.maxRetries.
+func performBuildWithRetry(ctx context.Context, cfg workerConfig, job *buildJob) ([]string, []byte, buildInfo, error) {
+	var lastErr error
+	backoff := time.Second
+	for attempt := 0; attempt <= cfg.maxRetries; attempt++ {
+		artifacts, composeData, info, err := performBuild(ctx, cfg, job)
+		if err == nil {
+			return artifacts, composeData, info, nil
+		}
+		lastErr = err
+		if !isRetryableBuildError(err) || attempt == cfg.maxRetries {
+			return nil, nil, buildInfo{}, err
+		}
+		log.Printf("[worker %s] job %s: retryable error (attempt %d/%d): %v", cfg.name, job.ID, attempt+1, cfg.maxRetries, err)
+		select {
+		case <-ctx.Done():
+			return nil, nil, buildInfo{}, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return nil, nil, buildInfo{}, lastErr
+}
+
+func isRetryableBuildError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range []string{"git clone", "docker push", "connection reset", "timeout", "temporary failure", "no such host", "eof", "network is unreachable"} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownPreview brings down the compose stack a closed PR's preview
+// environment was running, by project name alone (no clone needed, since
+// there's nothing left to build). Mirrors the "mdp-<serviceID>" project
+// naming the agent's ensureComposeService uses, so this only reaches a
+// stack the agent actually brought up with ComposeUp; best-effort, since
+// a preview that never got past a failed build has nothing to remove.
+func teardownPreview(ctx context.Context, cfg workerConfig, job *buildJob) error {
+	if job.ServiceID == "" {
+		return nil
+	}
+	project := "mdp-" + job.ServiceID
+	if err := runCommand(ctx, cfg, "", dockerEnv(), "docker", "compose", "-p", project, "down", "--remove-orphans"); err != nil {
+		return fmt.Errorf("compose down: %w", err)
+	}
+	return nil
 }
 
+// applyDeployment creates a pending deployment for the built image and
+// immediately promotes it. The worker doesn't run its own health checks
+// yet, so it stands in as the health gate: a successful build and image
+// push is treated as good enough to flip traffic, same as the previous
+// one-shot behavior, but now goes through the auditable pending->healthy
+// trail instead of mutating Service.Image directly.
 func applyDeployment(ctx context.Context, client *http.Client, cfg workerConfig, job *buildJob, image string) error {
 	if job.ServiceID == "" {
 		return nil
 	}
+	environment := job.Environment
+	if environment == "" {
+		environment = "production"
+	}
 	payload := map[string]string{
-		"environment": job.Environment,
+		"environment": environment,
 		"image":       image,
 	}
-	if payload["environment"] == "" {
-		payload["environment"] = "production"
-	}
 	data, _ := json.Marshal(payload)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v1/services/%s/deployments", cfg.controlPlane, job.ServiceID), bytes.NewReader(data))
@@ -334,6 +536,30 @@ func applyDeployment(ctx context.Context, client *http.Client, cfg workerConfig,
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("deploy call error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
+
+	var deployment struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&deployment); err != nil {
+		return fmt.Errorf("decode deployment response: %w", err)
+	}
+
+	promoteReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v1/services/%s/deployments/%s/promote", cfg.controlPlane, job.ServiceID, deployment.ID), nil)
+	if err != nil {
+		return err
+	}
+	if cfg.apiToken != "" {
+		promoteReq.Header.Set("Authorization", "Bearer "+cfg.apiToken)
+	}
+	promoteResp, err := client.Do(promoteReq)
+	if err != nil {
+		return err
+	}
+	defer promoteResp.Body.Close()
+	if promoteResp.StatusCode >= 400 {
+		body, _ := io.ReadAll(promoteResp.Body)
+		return fmt.Errorf("promote call error %d: %s", promoteResp.StatusCode, strings.TrimSpace(string(body)))
+	}
 	return nil
 }
 
@@ -366,6 +592,92 @@ func applyCompose(ctx context.Context, client *http.Client, cfg workerConfig, jo
 	return nil
 }
 
+// uploadImageArtifact docker-saves image to a temp tarball and pushes it
+// straight to the control plane's object storage via a presigned URL, so
+// the control plane never has to proxy image bytes through itself.
+func uploadImageArtifact(ctx context.Context, client *http.Client, cfg workerConfig, job *buildJob, image string) error {
+	tmpFile, err := os.CreateTemp("", "build-artifact-*.tar")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(tmpPath)
+
+	if err := runCommand(ctx, cfg, "", nil, "docker", "save", "-o", tmpPath, image); err != nil {
+		return fmt.Errorf("docker save: %w", err)
+	}
+
+	name := sanitizeArtifactName(image) + ".tar"
+	reqData, _ := json.Marshal(map[string]string{"name": name})
+	presignReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v1/build-jobs/%s/artifacts", cfg.controlPlane, job.ID), bytes.NewReader(reqData))
+	if err != nil {
+		return err
+	}
+	presignReq.Header.Set("Content-Type", "application/json")
+	if cfg.apiToken != "" {
+		presignReq.Header.Set("Authorization", "Bearer "+cfg.apiToken)
+	}
+	presignResp, err := client.Do(presignReq)
+	if err != nil {
+		return err
+	}
+	defer presignResp.Body.Close()
+	if presignResp.StatusCode >= 400 {
+		body, _ := io.ReadAll(presignResp.Body)
+		return fmt.Errorf("presign error %d: %s", presignResp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var presigned struct {
+		Key       string `json:"key"`
+		UploadURL string `json:"upload_url"`
+	}
+	if err := json.NewDecoder(presignResp.Body).Decode(&presigned); err != nil {
+		return fmt.Errorf("decode presign response: %w", err)
+	}
+
+	tarball, err := os.Open(tmpPath)
+	if err != nil {
+		return fmt.Errorf("open artifact: %w", err)
+	}
+	defer tarball.Close()
+	info, err := tarball.Stat()
+	if err != nil {
+		return fmt.Errorf("stat artifact: %w", err)
+	}
+
+	putReq, err := http.NewRequestWithContext(ctx, http.MethodPut, presigned.UploadURL, tarball)
+	if err != nil {
+		return err
+	}
+	putReq.ContentLength = info.Size()
+	putResp, err := client.Do(putReq)
+	if err != nil {
+		return fmt.Errorf("upload artifact: %w", err)
+	}
+	defer putResp.Body.Close()
+	if putResp.StatusCode >= 400 {
+		body, _ := io.ReadAll(putResp.Body)
+		return fmt.Errorf("upload error %d: %s", putResp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	log.Printf("[worker %s] uploaded artifact %s", cfg.name, presigned.Key)
+	return nil
+}
+
+// sanitizeArtifactName turns an image reference into a filesystem/object
+// key-safe name by collapsing anything outside [a-zA-Z0-9.-] to a dash.
+func sanitizeArtifactName(image string) string {
+	var b strings.Builder
+	for _, r := range image {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
 func runCommand(ctx context.Context, cfg workerConfig, dir string, extraEnv []string, name string, args ...string) error {
 	cmd := exec.CommandContext(ctx, name, args...)
 	env := append(os.Environ(), extraEnv...)
@@ -373,29 +685,51 @@ func runCommand(ctx context.Context, cfg workerConfig, dir string, extraEnv []st
 	if dir != "" {
 		cmd.Dir = dir
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
 
-	log.Printf("[worker %s] exec: %s", cfg.name, sanitizeCommand(cfg.githubToken, name, args))
+	redactor := redactorFromContext(ctx)
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	if redactor != nil {
+		stdout = newRedactWriter(stdout, redactor)
+		stderr = newRedactWriter(stderr, redactor)
+	}
+	if sink := logSinkFromContext(ctx); sink != nil {
+		stdout = io.MultiWriter(stdout, sink)
+		stderr = io.MultiWriter(stderr, sink)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	cmdline := cmd.String()
+	if redactor != nil {
+		cmdline = redactor.Redact(cmdline)
+	} else {
+		cmdline = sanitizeCommand(cmdline, cfg.githubToken, cfg.gitlabToken, cfg.giteaToken, cfg.bitbucketToken)
+	}
+	log.Printf("[worker %s] exec: %s", cfg.name, cmdline)
 	return cmd.Run()
 }
 
-func sanitizeCommand(secret string, name string, args []string) string {
-	parts := append([]string{name}, args...)
-	cmd := strings.Join(parts, " ")
-	if secret != "" {
+func sanitizeCommand(cmdline string, secrets ...string) string {
+	cmd := cmdline
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
 		cmd = strings.ReplaceAll(cmd, secret, "****")
 	}
 	return cmd
 }
 
+// splitRepo splits "owner/name" or, for providers that support nested
+// groups (e.g. GitLab's group/subgroup/repo), any "path/.../name" into an
+// owner path and a repository name.
 func splitRepo(repo string) (string, string, error) {
 	parts := strings.Split(repo, "/")
-	if len(parts) != 2 {
+	if len(parts) < 2 {
 		return "", "", fmt.Errorf("invalid repository: %s", repo)
 	}
-	owner := strings.TrimSpace(parts[0])
-	name := strings.TrimSpace(parts[1])
+	name := strings.TrimSpace(parts[len(parts)-1])
+	owner := strings.TrimSpace(strings.Join(parts[:len(parts)-1], "/"))
 	if owner == "" || name == "" {
 		return "", "", fmt.Errorf("invalid repository: %s", repo)
 	}
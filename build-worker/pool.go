@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// workerPool bounds how many build jobs this worker processes at once and
+// reports that load back to the control plane on every claim, so a future
+// scheduler can route jobs away from busy workers.
+type workerPool struct {
+	capacity int64
+	active   int64
+	pushSem  chan struct{}
+}
+
+func newWorkerPool(capacity, pushConcurrency int) *workerPool {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if pushConcurrency < 1 {
+		pushConcurrency = 1
+	}
+	return &workerPool{
+		capacity: int64(capacity),
+		pushSem:  make(chan struct{}, pushConcurrency),
+	}
+}
+
+func (p *workerPool) acquire() { atomic.AddInt64(&p.active, 1) }
+func (p *workerPool) release() { atomic.AddInt64(&p.active, -1) }
+
+// availableSlots reports how many more jobs this worker can pick up right now.
+func (p *workerPool) availableSlots() int {
+	n := p.capacity - atomic.LoadInt64(&p.active)
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// load reports current active job count and total capacity, echoed to the
+// control plane in claim requests.
+func (p *workerPool) load() (active, capacity int) {
+	return int(atomic.LoadInt64(&p.active)), int(p.capacity)
+}
+
+// acquirePush blocks until a docker-push slot is free, bounding how many
+// pushes hit the registry at once regardless of build concurrency. The
+// returned func releases the slot.
+func (p *workerPool) acquirePush(ctx context.Context) (func(), error) {
+	select {
+	case p.pushSem <- struct{}{}:
+		return func() { <-p.pushSem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type poolKey struct{}
+
+func withPool(ctx context.Context, p *workerPool) context.Context {
+	return context.WithValue(ctx, poolKey{}, p)
+}
+
+func poolFromContext(ctx context.Context) *workerPool {
+	p, _ := ctx.Value(poolKey{}).(*workerPool)
+	return p
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const redactedPlaceholder = "****"
+
+// SecretRedactor scrubs known secret values, and their common encoded
+// forms, from log output before it reaches stdout/stderr or an uploaded
+// log chunk. It's seeded once per job from the worker's configured VCS
+// tokens, the job's own build-time secrets, and any environment variables
+// matching cfg.secretEnvPrefixes.
+type SecretRedactor struct {
+	mu      sync.RWMutex
+	needles []string
+}
+
+func newSecretRedactor(cfg workerConfig, job *buildJob) *SecretRedactor {
+	r := &SecretRedactor{}
+	r.Add(cfg.apiToken, cfg.githubToken, cfg.gitlabToken, cfg.giteaToken, cfg.bitbucketToken)
+	r.Add(job.Secrets...)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		for _, prefix := range cfg.secretEnvPrefixes {
+			if prefix != "" && strings.HasPrefix(key, prefix) {
+				r.Add(value)
+				break
+			}
+		}
+	}
+	return r
+}
+
+// Add seeds the redactor with additional raw secret values, along with
+// their base64 and URL-encoded forms, so encoded copies (e.g. in a
+// basic-auth header or a query string) are caught too.
+func (r *SecretRedactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		r.needles = append(r.needles,
+			secret,
+			base64.StdEncoding.EncodeToString([]byte(secret)),
+			url.QueryEscape(secret),
+		)
+	}
+}
+
+// Redact replaces every known secret, or encoded variant, in s with a fixed
+// placeholder.
+func (r *SecretRedactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, needle := range r.needles {
+		s = strings.ReplaceAll(s, needle, redactedPlaceholder)
+	}
+	return s
+}
+
+type redactorKey struct{}
+
+func withRedactor(ctx context.Context, r *SecretRedactor) context.Context {
+	return context.WithValue(ctx, redactorKey{}, r)
+}
+
+func redactorFromContext(ctx context.Context) *SecretRedactor {
+	r, _ := ctx.Value(redactorKey{}).(*SecretRedactor)
+	return r
+}
+
+// redactWriter wraps an io.Writer, redacting each write through r before
+// forwarding it downstream. A secret split across two Write calls won't be
+// caught; in practice exec.Cmd writes are large enough chunks that this
+// isn't an issue in builds.
+type redactWriter struct {
+	w io.Writer
+	r *SecretRedactor
+}
+
+func newRedactWriter(w io.Writer, r *SecretRedactor) io.Writer {
+	return redactWriter{w: w, r: r}
+}
+
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write([]byte(rw.r.Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
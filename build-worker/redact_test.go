@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestSecretRedactorRedact(t *testing.T) {
+	cases := []struct {
+		name    string
+		secrets []string
+		input   string
+		want    string
+	}{
+		{
+			name:    "plain secret",
+			secrets: []string{"s3cr3t"},
+			input:   "Authorization: Bearer s3cr3t",
+			want:    "Authorization: Bearer ****",
+		},
+		{
+			name:    "base64-encoded form",
+			secrets: []string{"s3cr3t"},
+			input:   "auth=" + "czNjcjN0", // base64("s3cr3t")
+			want:    "auth=****",
+		},
+		{
+			name:    "url-encoded form",
+			secrets: []string{"a b&c"},
+			input:   "token=a+b%26c in query string",
+			want:    "token=**** in query string",
+		},
+		{
+			name:    "multiple secrets in one line",
+			secrets: []string{"alpha", "beta"},
+			input:   "alpha and beta both appear",
+			want:    "**** and **** both appear",
+		},
+		{
+			name:    "no match leaves input untouched",
+			secrets: []string{"alpha"},
+			input:   "nothing sensitive here",
+			want:    "nothing sensitive here",
+		},
+		{
+			name:    "empty secret is ignored, not treated as a wildcard",
+			secrets: []string{""},
+			input:   "some ordinary text",
+			want:    "some ordinary text",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &SecretRedactor{}
+			r.Add(tc.secrets...)
+			if got := r.Redact(tc.input); got != tc.want {
+				t.Errorf("Redact(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSecretRedactorAddIsCumulative(t *testing.T) {
+	r := &SecretRedactor{}
+	r.Add("first")
+	r.Add("second")
+
+	got := r.Redact("first then second")
+	want := "**** then ****"
+	if got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VCSProvider abstracts the parts of cloning that differ between Git
+// hosting backends: how to build an authenticated clone URL, which extra
+// git environment/config is needed to authenticate non-URL-embedded
+// credentials, and how to normalize a webhook-supplied ref into something
+// `git fetch` accepts.
+type VCSProvider interface {
+	// CloneURL returns the URL used for `git clone`/`git fetch`, embedding
+	// token as needed.
+	CloneURL(repo, token string) string
+	// AuthHeaders returns extra `git -c` config entries (e.g. an
+	// `http.extraheader`) required to authenticate the clone.
+	AuthHeaders(token string) []string
+	// NormalizeRef turns a ref as reported by a webhook (which may be a
+	// full "refs/heads/..." path) into the value `git fetch` should use.
+	NormalizeRef(ref string) string
+}
+
+func selectVCSProvider(kind string) VCSProvider {
+	switch kind {
+	case "gitlab":
+		return gitlabProvider{}
+	case "gitea":
+		return giteaProvider{}
+	case "bitbucket":
+		return bitbucketProvider{}
+	case "ssh":
+		return sshProvider{}
+	case "github", "":
+		return githubProvider{}
+	default:
+		return githubProvider{}
+	}
+}
+
+func vcsToken(cfg workerConfig, provider string) string {
+	switch provider {
+	case "gitlab":
+		return cfg.gitlabToken
+	case "gitea":
+		return cfg.giteaToken
+	case "bitbucket":
+		return cfg.bitbucketToken
+	default:
+		return cfg.githubToken
+	}
+}
+
+type githubProvider struct{}
+
+func (githubProvider) CloneURL(repo, token string) string {
+	if token != "" {
+		return fmt.Sprintf("https://%s@github.com/%s.git", token, repo)
+	}
+	return fmt.Sprintf("https://github.com/%s.git", repo)
+}
+
+func (githubProvider) AuthHeaders(token string) []string { return nil }
+
+func (githubProvider) NormalizeRef(ref string) string { return normalizeRef(ref) }
+
+type gitlabProvider struct{}
+
+func (gitlabProvider) CloneURL(repo, token string) string {
+	if token != "" {
+		return fmt.Sprintf("https://oauth2:%s@gitlab.com/%s.git", token, repo)
+	}
+	return fmt.Sprintf("https://gitlab.com/%s.git", repo)
+}
+
+func (gitlabProvider) AuthHeaders(token string) []string { return nil }
+
+func (gitlabProvider) NormalizeRef(ref string) string { return normalizeRef(ref) }
+
+type giteaProvider struct{}
+
+func (giteaProvider) CloneURL(repo, token string) string {
+	if token != "" {
+		return fmt.Sprintf("https://%s@gitea.com/%s.git", token, repo)
+	}
+	return fmt.Sprintf("https://gitea.com/%s.git", repo)
+}
+
+func (giteaProvider) AuthHeaders(token string) []string { return nil }
+
+func (giteaProvider) NormalizeRef(ref string) string { return normalizeRef(ref) }
+
+type bitbucketProvider struct{}
+
+func (bitbucketProvider) CloneURL(repo, token string) string {
+	if token != "" {
+		return fmt.Sprintf("https://x-token-auth:%s@bitbucket.org/%s.git", token, repo)
+	}
+	return fmt.Sprintf("https://bitbucket.org/%s.git", repo)
+}
+
+func (bitbucketProvider) AuthHeaders(token string) []string { return nil }
+
+func (bitbucketProvider) NormalizeRef(ref string) string { return normalizeRef(ref) }
+
+// sshProvider clones over generic git+ssh, relying on the worker's
+// configured SSH key rather than a token embedded in the URL.
+type sshProvider struct{}
+
+func (sshProvider) CloneURL(repo, token string) string {
+	return fmt.Sprintf("git@%s", strings.Replace(repo, "/", ":", 1)+".git")
+}
+
+func (sshProvider) AuthHeaders(token string) []string { return nil }
+
+func (sshProvider) NormalizeRef(ref string) string { return normalizeRef(ref) }
+
+func normalizeRef(ref string) string {
+	ref = strings.TrimPrefix(ref, "refs/heads/")
+	ref = strings.TrimPrefix(ref, "refs/tags/")
+	return ref
+}
@@ -0,0 +1,89 @@
+// Package cliconfig is the on-disk layout behind infrctl's layered
+// configuration: a YAML file of named contexts (profiles), each a
+// base_url/token/default_project/default_env, selected by current_context
+// unless overridden by --context. main.go merges this with --flags and the
+// INFRCTL_API/INFRCTL_TOKEN env vars (flags > env > file > built-in
+// defaults) to build the cliConfig each command runs with.
+package cliconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the full contents of a config.yaml: every known context plus
+// which one applies when --context isn't given.
+type Config struct {
+	CurrentContext string             `yaml:"current_context"`
+	Contexts       map[string]Context `yaml:"contexts"`
+}
+
+// Context is one named profile: where to send requests, how to
+// authenticate them, and the project/env a bare `--project`/`--env` flag
+// falls back to when omitted.
+type Context struct {
+	BaseURL        string `yaml:"base_url"`
+	Token          string `yaml:"token"`
+	DefaultProject string `yaml:"default_project,omitempty"`
+	DefaultEnv     string `yaml:"default_env,omitempty"`
+}
+
+// DefaultPath returns ~/.config/infrctl/config.yaml, the file Load/Save use
+// when --config isn't given. Returns "" if the home directory can't be
+// resolved, in which case callers should treat config as absent rather
+// than error.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "infrctl", "config.yaml")
+}
+
+// Load reads and parses path. A missing file is not an error - it returns
+// an empty Config, the same as a freshly initialized one - since a config
+// file is optional and every command should work from env/flags alone.
+func Load(path string) (*Config, error) {
+	cfg := &Config{Contexts: map[string]Context{}}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = map[string]Context{}
+	}
+	return cfg, nil
+}
+
+// Save writes cfg to path as YAML, creating path's parent directory if
+// needed.
+func Save(path string, cfg *Config) error {
+	if path == "" {
+		return fmt.Errorf("no config path to save to")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write config %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,596 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Client is the subset of HTTP operations Build and Apply need against the
+// control plane. cmd/infrctl's apiClient satisfies it via a thin adapter,
+// so this package never has to import package main.
+type Client interface {
+	Get(path string) ([]byte, error)
+	PostJSON(path string, payload any) ([]byte, error)
+	PatchJSON(path string, payload any) ([]byte, error)
+	Delete(path string) error
+}
+
+// Action is what an Op does to its Resource.
+type Action string
+
+const (
+	ActionCreate      Action = "create"
+	ActionUpdate      Action = "update"
+	ActionNoop        Action = "noop"
+	ActionDelete      Action = "delete"
+	ActionUnsupported Action = "unsupported" // the control plane has no delete endpoint for this resource kind
+)
+
+// Op is one reconciliation step: create/update/delete a single resource,
+// or a no-op recording that it already matches the manifest.
+type Op struct {
+	Action   Action
+	Resource string // e.g. "project/acme", "service/acme/web", "domain/acme/web/foo.example.com"
+	Detail   string // human-readable summary of what changed (empty for noop)
+	apply    func(c Client) error
+}
+
+// Marker is the ± prefix `infrctl diff`/`apply` prints next to an Op.
+func (o Op) Marker() string {
+	switch o.Action {
+	case ActionCreate:
+		return "+"
+	case ActionUpdate:
+		return "~"
+	case ActionDelete:
+		return "-"
+	case ActionUnsupported:
+		return "!"
+	default:
+		return " "
+	}
+}
+
+func (o Op) String() string {
+	if o.Detail == "" {
+		return fmt.Sprintf("%s %-8s %s", o.Marker(), o.Action, o.Resource)
+	}
+	return fmt.Sprintf("%s %-8s %s (%s)", o.Marker(), o.Action, o.Resource, o.Detail)
+}
+
+// Plan is an ordered list of Ops: project, then service, then domain,
+// deployment, and github bindings, matching the dependency order those
+// resources must be created in.
+type Plan struct {
+	Ops []Op
+}
+
+// Summary counts Ops by Action, for a one-line "3 to create, 1 to update"
+// footer under the printed plan.
+func (p Plan) Summary() string {
+	counts := map[Action]int{}
+	for _, op := range p.Ops {
+		counts[op.Action]++
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to delete, %d unsupported, %d unchanged",
+		counts[ActionCreate], counts[ActionUpdate], counts[ActionDelete], counts[ActionUnsupported], counts[ActionNoop])
+}
+
+// ApplyResult records what happened to each Op in a Plan, so a partial
+// failure identifies exactly which resource failed and which downstream
+// ones were skipped as a result, rather than aborting with a single error.
+type ApplyResult struct {
+	Resource string
+	Action   Action
+	Err      error
+	Skipped  bool
+}
+
+// Apply runs every non-noop Op against c in order, stopping new work as
+// soon as one fails: every later create/update/delete Op is recorded as
+// Skipped rather than attempted, since later Ops (a domain under a service
+// that failed to create, say) are likely to depend on it. Unsupported Ops
+// are never attempted and are always recorded with their Detail as Err.
+func Apply(c Client, plan Plan, dryRun bool) []ApplyResult {
+	results := make([]ApplyResult, 0, len(plan.Ops))
+	failed := false
+	for _, op := range plan.Ops {
+		if op.Action == ActionNoop {
+			continue
+		}
+		if op.Action == ActionUnsupported {
+			results = append(results, ApplyResult{Resource: op.Resource, Action: op.Action, Err: fmt.Errorf("%s", op.Detail)})
+			continue
+		}
+		if failed {
+			results = append(results, ApplyResult{Resource: op.Resource, Action: op.Action, Skipped: true})
+			continue
+		}
+		if dryRun {
+			results = append(results, ApplyResult{Resource: op.Resource, Action: op.Action})
+			continue
+		}
+		if err := op.apply(c); err != nil {
+			failed = true
+			results = append(results, ApplyResult{Resource: op.Resource, Action: op.Action, Err: err})
+			continue
+		}
+		results = append(results, ApplyResult{Resource: op.Resource, Action: op.Action})
+	}
+	return results
+}
+
+// existingProject is the subset of GET /v1/projects' response Build cares about.
+type existingProject struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type existingService struct {
+	ID           string           `json:"id"`
+	Name         string           `json:"name"`
+	Image        string           `json:"image"`
+	InternalPort int              `json:"internal_port"`
+	Domains      []existingDomain `json:"domains"`
+	Deployments  []existingDeploy `json:"deployments"`
+}
+
+type existingDomain struct {
+	ID          string `json:"id"`
+	Hostname    string `json:"hostname"`
+	Environment string `json:"environment"`
+}
+
+type existingDeploy struct {
+	Environment string `json:"environment"`
+	Image       string `json:"image"`
+	Status      string `json:"status"`
+}
+
+// Build fetches current state for every resource the manifest references
+// and diffs it, producing a Plan in project -> service -> domain ->
+// deployment -> github dependency order. destroy turns every manifest
+// resource into a delete/unsupported Op instead of create/update/noop.
+// prune additionally diffs in the other direction: projects, services, and
+// domains that exist on the control plane but aren't declared anywhere in
+// the manifest are reported too, as ActionUnsupported, since the control
+// plane has no delete endpoint for any of the three - pruning still has to
+// be done by hand, but the plan now surfaces what's orphaned instead of
+// silently ignoring it.
+func Build(c Client, m *Manifest, destroy, prune bool) (Plan, error) {
+	var plan Plan
+
+	var projects []existingProject
+	if body, err := c.Get("/v1/projects"); err == nil {
+		var decoded struct {
+			Projects []existingProject `json:"projects"`
+		}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			projects = decoded.Projects
+		}
+	}
+
+	for _, ps := range m.Projects {
+		var existing *existingProject
+		for i := range projects {
+			if projects[i].Name == ps.Name {
+				existing = &projects[i]
+				break
+			}
+		}
+
+		projectResource := fmt.Sprintf("project/%s", ps.Name)
+		projectID := ""
+		if existing != nil {
+			projectID = existing.ID
+		}
+
+		if destroy {
+			plan.Ops = append(plan.Ops, Op{
+				Action:   ActionUnsupported,
+				Resource: projectResource,
+				Detail:   "control plane has no delete endpoint for projects; remove it manually if intended",
+			})
+		} else if existing == nil {
+			ps := ps
+			plan.Ops = append(plan.Ops, Op{
+				Action:   ActionCreate,
+				Resource: projectResource,
+				apply: func(c Client) error {
+					payload := map[string]string{"name": ps.Name}
+					if ps.Slug != "" {
+						payload["slug"] = ps.Slug
+					}
+					body, err := c.PostJSON("/v1/projects", payload)
+					if err != nil {
+						return err
+					}
+					var created existingProject
+					if err := json.Unmarshal(body, &created); err != nil {
+						return err
+					}
+					projectID = created.ID
+					return nil
+				},
+			})
+		} else {
+			plan.Ops = append(plan.Ops, Op{Action: ActionNoop, Resource: projectResource})
+		}
+
+		var services []existingService
+		if projectID != "" {
+			if body, err := c.Get(fmt.Sprintf("/v1/projects/%s/services", projectID)); err == nil {
+				var decoded struct {
+					Services []existingService `json:"services"`
+				}
+				if err := json.Unmarshal(body, &decoded); err == nil {
+					services = decoded.Services
+				}
+			}
+		}
+
+		for _, ss := range ps.Services {
+			planService(c, &plan, &projectID, ps.Name, ss, services, destroy, prune)
+		}
+
+		if prune {
+			pruneOrphanServices(&plan, ps.Name, ps.Services, services)
+		}
+	}
+
+	if prune {
+		pruneOrphanProjects(&plan, m.Projects, projects)
+	}
+
+	return plan, nil
+}
+
+// pruneOrphanProjects reports projects that exist on the control plane but
+// have no matching entry (by name) in the manifest.
+func pruneOrphanProjects(plan *Plan, declared []ProjectSpec, existing []existingProject) {
+	for _, p := range existing {
+		found := false
+		for _, ps := range declared {
+			if ps.Name == p.Name {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionUnsupported,
+			Resource: fmt.Sprintf("project/%s", p.Name),
+			Detail:   "exists on the control plane but not in the manifest; no delete endpoint for projects, remove it manually if intended",
+		})
+	}
+}
+
+// pruneOrphanServices reports services under a project that exist on the
+// control plane but have no matching entry (by name) in the manifest.
+func pruneOrphanServices(plan *Plan, projectName string, declared []ServiceSpec, existing []existingService) {
+	for _, svc := range existing {
+		found := false
+		for _, ss := range declared {
+			if ss.Name == svc.Name {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionUnsupported,
+			Resource: fmt.Sprintf("service/%s/%s", projectName, svc.Name),
+			Detail:   "exists on the control plane but not in the manifest; no delete endpoint for services, remove it manually if intended",
+		})
+	}
+}
+
+func planService(c Client, plan *Plan, projectID *string, projectName string, ss ServiceSpec, services []existingService, destroy, prune bool) {
+	var existing *existingService
+	for i := range services {
+		if services[i].Name == ss.Name {
+			existing = &services[i]
+			break
+		}
+	}
+
+	serviceResource := fmt.Sprintf("service/%s/%s", projectName, ss.Name)
+	serviceID := ""
+	if existing != nil {
+		serviceID = existing.ID
+	}
+
+	switch {
+	case destroy:
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionUnsupported,
+			Resource: serviceResource,
+			Detail:   "control plane has no delete endpoint for services; remove it manually if intended",
+		})
+	case existing == nil:
+		ss := ss
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionCreate,
+			Resource: serviceResource,
+			Detail:   fmt.Sprintf("image=%s port=%d", ss.Image, ss.InternalPort),
+			apply: func(c Client) error {
+				payload := map[string]any{"name": ss.Name, "internal_port": ss.InternalPort}
+				if ss.Image != "" {
+					payload["image"] = ss.Image
+				}
+				body, err := c.PostJSON(fmt.Sprintf("/v1/projects/%s/services", *projectID), payload)
+				if err != nil {
+					return err
+				}
+				var created existingService
+				if err := json.Unmarshal(body, &created); err != nil {
+					return err
+				}
+				serviceID = created.ID
+				return nil
+			},
+		})
+	case existing.Image != ss.Image && ss.Image != "":
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionUpdate,
+			Resource: serviceResource,
+			Detail:   fmt.Sprintf("image %s -> %s", existing.Image, ss.Image),
+			apply: func(c Client) error {
+				_, err := c.PatchJSON(fmt.Sprintf("/v1/services/%s", serviceID), map[string]any{"image": ss.Image})
+				return err
+			},
+		})
+	default:
+		plan.Ops = append(plan.Ops, Op{Action: ActionNoop, Resource: serviceResource})
+	}
+
+	var currentDomains []existingDomain
+	var currentDeploys []existingDeploy
+	if existing != nil {
+		currentDomains = existing.Domains
+		currentDeploys = existing.Deployments
+	}
+
+	for _, ds := range ss.Domains {
+		planDomain(plan, &serviceID, projectName, ss.Name, ds, currentDomains, destroy)
+	}
+
+	if prune && existing != nil {
+		pruneOrphanDomains(plan, projectName, ss.Name, ss.Domains, currentDomains)
+	}
+
+	if ss.Deployment != nil {
+		planDeployment(plan, &serviceID, projectName, ss.Name, *ss.Deployment, currentDeploys, destroy)
+	}
+
+	if ss.GitHub != nil {
+		planGitHubBinding(c, plan, &serviceID, projectName, ss.Name, *ss.GitHub, destroy)
+	}
+}
+
+func planDomain(plan *Plan, serviceID *string, projectName, serviceName string, ds DomainSpec, current []existingDomain, destroy bool) {
+	resource := fmt.Sprintf("domain/%s/%s/%s", projectName, serviceName, ds.Hostname)
+	var existing *existingDomain
+	for i := range current {
+		if current[i].Hostname == ds.Hostname {
+			existing = &current[i]
+			break
+		}
+	}
+
+	switch {
+	case destroy:
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionUnsupported,
+			Resource: resource,
+			Detail:   "control plane has no delete endpoint for domains; remove it manually if intended",
+		})
+	case existing == nil:
+		ds := ds
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionCreate,
+			Resource: resource,
+			apply: func(c Client) error {
+				environment := ds.Environment
+				if environment == "" {
+					environment = "production"
+				}
+				_, err := c.PostJSON(fmt.Sprintf("/v1/services/%s/domains", *serviceID), map[string]string{
+					"hostname":    ds.Hostname,
+					"environment": environment,
+				})
+				return err
+			},
+		})
+	default:
+		plan.Ops = append(plan.Ops, Op{Action: ActionNoop, Resource: resource})
+	}
+}
+
+// pruneOrphanDomains reports domains attached to a service on the control
+// plane but with no matching hostname in the manifest.
+func pruneOrphanDomains(plan *Plan, projectName, serviceName string, declared []DomainSpec, existing []existingDomain) {
+	for _, d := range existing {
+		found := false
+		for _, ds := range declared {
+			if ds.Hostname == d.Hostname {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionUnsupported,
+			Resource: fmt.Sprintf("domain/%s/%s/%s", projectName, serviceName, d.Hostname),
+			Detail:   "exists on the control plane but not in the manifest; no delete endpoint for domains, remove it manually if intended",
+		})
+	}
+}
+
+func planDeployment(plan *Plan, serviceID *string, projectName, serviceName string, ds DeploymentSpec, current []existingDeploy, destroy bool) {
+	environment := ds.Environment
+	if environment == "" {
+		environment = "production"
+	}
+	resource := fmt.Sprintf("deployment/%s/%s/%s", projectName, serviceName, environment)
+
+	var latest *existingDeploy
+	for i := range current {
+		if current[i].Environment == environment {
+			latest = &current[i]
+		}
+	}
+
+	switch {
+	case destroy:
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionUnsupported,
+			Resource: resource,
+			Detail:   "control plane has no delete endpoint for deployments; roll back manually if intended",
+		})
+	case latest == nil || latest.Image != ds.Image:
+		detail := fmt.Sprintf("image=%s", ds.Image)
+		if latest != nil {
+			detail = fmt.Sprintf("image %s -> %s", latest.Image, ds.Image)
+		}
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionCreate,
+			Resource: resource,
+			Detail:   detail,
+			apply: func(c Client) error {
+				body, err := c.PostJSON(fmt.Sprintf("/v1/services/%s/deployments", *serviceID), map[string]string{
+					"image":       ds.Image,
+					"environment": environment,
+				})
+				if err != nil {
+					return err
+				}
+				var created struct {
+					ID string `json:"id"`
+				}
+				if err := json.Unmarshal(body, &created); err != nil {
+					return err
+				}
+				_, err = c.PostJSON(fmt.Sprintf("/v1/services/%s/deployments/%s/promote", *serviceID, created.ID), map[string]string{})
+				return err
+			},
+		})
+	default:
+		plan.Ops = append(plan.Ops, Op{Action: ActionNoop, Resource: resource})
+	}
+}
+
+func planGitHubBinding(c Client, plan *Plan, serviceID *string, projectName, serviceName string, gs GitHubRepoSpec, destroy bool) {
+	resource := fmt.Sprintf("github/%s", gs.Repo)
+
+	if destroy {
+		plan.Ops = append(plan.Ops, Op{
+			Action:   ActionDelete,
+			Resource: resource,
+			apply: func(c Client) error {
+				return c.Delete(fmt.Sprintf("/v1/github/repos/%s/services?service_id=%s", repositoryID(gs.Repo), *serviceID))
+			},
+		})
+		return
+	}
+
+	type repoServiceBinding struct {
+		ServiceID   string `json:"service_id"`
+		ComposePath string `json:"compose_path"`
+	}
+	var decoded struct {
+		Services []repoServiceBinding `json:"services"`
+	}
+	repoExists := false
+	if body, err := c.Get(fmt.Sprintf("/v1/github/repos/%s", repositoryID(gs.Repo))); err == nil {
+		repoExists = true
+		_ = json.Unmarshal(body, &decoded)
+	}
+
+	bound := false
+	for _, svc := range decoded.Services {
+		if svc.ServiceID == *serviceID {
+			bound = true
+			break
+		}
+	}
+
+	action := ActionCreate
+	if repoExists {
+		action = ActionUpdate
+	}
+	if bound {
+		plan.Ops = append(plan.Ops, Op{Action: ActionNoop, Resource: resource})
+		return
+	}
+
+	plan.Ops = append(plan.Ops, Op{
+		Action:   action,
+		Resource: resource,
+		Detail:   fmt.Sprintf("compose_path=%s", gs.ComposePath),
+		apply: func(c Client) error {
+			owner, name := splitOwnerName(gs.Repo)
+			payload := map[string]string{
+				"owner":          owner,
+				"name":           name,
+				"default_branch": gs.Branch,
+				"compose_path":   gs.ComposePath,
+			}
+			if gs.Installation != "" {
+				payload["installation_id"] = gs.Installation
+			}
+			if _, err := c.PostJSON("/v1/github/repos", payload); err != nil {
+				return err
+			}
+			environment := gs.Environment
+			if environment == "" {
+				environment = "production"
+			}
+			_, err := c.PostJSON(fmt.Sprintf("/v1/github/repos/%s/services", repositoryID(gs.Repo)), map[string]string{
+				"service_id":   *serviceID,
+				"compose_path": gs.ComposePath,
+				"environment":  environment,
+			})
+			return err
+		},
+	})
+}
+
+// repositoryID mirrors the control plane's repositoryID(owner, name):
+// sanitizeKey(owner)+"-"+sanitizeKey(name), each lowercased with every
+// non-alphanumeric rune replaced by its own dash (runs are not collapsed)
+// and leading/trailing dashes trimmed.
+func repositoryID(repo string) string {
+	owner, name := splitOwnerName(repo)
+	return sanitizeKey(owner) + "-" + sanitizeKey(name)
+}
+
+func sanitizeKey(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+func splitOwnerName(repo string) (string, string) {
+	for i := 0; i < len(repo); i++ {
+		if repo[i] == '/' {
+			return repo[:i], repo[i+1:]
+		}
+	}
+	return repo, ""
+}
@@ -0,0 +1,118 @@
+// Package spec is the typed schema and loader behind `infrctl apply -f`:
+// one YAML/JSON document declaring projects, services, domains,
+// deployments, and GitHub repo bindings, reconciled against the control
+// plane's REST API by Build and Apply (see plan.go).
+package spec
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is the top-level document `infrctl apply -f` reads.
+type Manifest struct {
+	Projects []ProjectSpec `yaml:"projects"`
+}
+
+// ProjectSpec declares a project and the services it owns.
+type ProjectSpec struct {
+	Name     string        `yaml:"name"`
+	Slug     string        `yaml:"slug"`
+	Services []ServiceSpec `yaml:"services"`
+}
+
+// ServiceSpec declares a service, optionally with the domains, deployment,
+// and GitHub repo binding that go with it.
+type ServiceSpec struct {
+	Name         string          `yaml:"name"`
+	Image        string          `yaml:"image"`
+	InternalPort int             `yaml:"internal_port"`
+	Domains      []DomainSpec    `yaml:"domains"`
+	Deployment   *DeploymentSpec `yaml:"deployment"`
+	GitHub       *GitHubRepoSpec `yaml:"github"`
+}
+
+// DomainSpec declares one hostname a service should answer to.
+type DomainSpec struct {
+	Hostname    string `yaml:"hostname"`
+	Environment string `yaml:"environment"`
+}
+
+// DeploymentSpec declares the image a service's environment should be
+// running. Applying it creates a new Deployment and promotes it; there's
+// no update-in-place, so the planner diffs against the environment's most
+// recent Deployment's image rather than some mutable desired state.
+type DeploymentSpec struct {
+	Image       string `yaml:"image"`
+	Environment string `yaml:"environment"`
+}
+
+// GitHubRepoSpec declares the repository a service's pushes build from,
+// equivalent to `infrctl github register` plus a POST to
+// /v1/github/repos/{id}/services wiring it to the service above.
+type GitHubRepoSpec struct {
+	Repo         string `yaml:"repo"` // owner/name
+	Branch       string `yaml:"branch"`
+	ComposePath  string `yaml:"compose_path"`
+	Installation string `yaml:"installation"`
+	Environment  string `yaml:"environment"`
+}
+
+// Load reads and parses the manifest at path, interpolating ${env:VAR} and
+// ${file:path} references first (the former reads the named environment
+// variable, the latter the trimmed contents of the named file - handy for
+// reading a secret or image tag out of a file a CI step already wrote).
+func Load(path string) (*Manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	resolved, err := interpolate(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal([]byte(resolved), &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+var interpPattern = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// interpolate resolves every ${env:VAR} and ${file:path} reference in raw,
+// in the spirit of Drone's envsubst-style step templating. An unset env
+// var resolves to an empty string (matching shell envsubst); an unreadable
+// file is a hard error, since a missing secret/config file is very likely
+// a mistake the operator wants surfaced immediately.
+func interpolate(raw string) (string, error) {
+	var firstErr error
+	resolved := interpPattern.ReplaceAllStringFunc(raw, func(match string) string {
+		if firstErr != nil {
+			return match
+		}
+		parts := interpPattern.FindStringSubmatch(match)
+		kind, arg := parts[1], parts[2]
+		switch kind {
+		case "env":
+			return os.Getenv(arg)
+		case "file":
+			data, err := os.ReadFile(arg)
+			if err != nil {
+				firstErr = fmt.Errorf("${file:%s}: %w", arg, err)
+				return match
+			}
+			return strings.TrimSpace(string(data))
+		default:
+			return match
+		}
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return resolved, nil
+}
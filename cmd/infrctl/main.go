@@ -1,20 +1,38 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
+
+	"github.com/0xEdouard/multi-domain-infra/cmd/infrctl/internal/cliconfig"
+	"github.com/0xEdouard/multi-domain-infra/cmd/infrctl/internal/spec"
+	"gopkg.in/yaml.v3"
 )
 
 type cliConfig struct {
-	baseURL string
-	token   string
+	baseURL        string
+	token          string
+	defaultProject string
+	defaultEnv     string
+	output         string
+	configPath     string
 }
 
 func main() {
@@ -23,35 +41,105 @@ func main() {
 		os.Exit(1)
 	}
 
-	cfg := cliConfig{
-		baseURL: strings.TrimRight(envOrDefault("INFRCTL_API", "http://localhost:8080"), "/"),
-		token:   os.Getenv("INFRCTL_TOKEN"),
+	globalFlags := flag.NewFlagSet("infrctl", flag.ContinueOnError)
+	globalFlags.SetOutput(io.Discard)
+	configPath := globalFlags.String("config", cliconfig.DefaultPath(), "Path to config.yaml (default ~/.config/infrctl/config.yaml)")
+	contextName := globalFlags.String("context", "", "Named context to use instead of current_context")
+	output := globalFlags.String("output", "", "Output format: json (default), yaml, or table")
+	// Global flags must precede the subcommand, since flag.Parse stops at
+	// the first non-flag argument - the usual convention for Go CLIs that
+	// also take subcommand-specific flags.
+	if err := globalFlags.Parse(os.Args[1:]); err != nil {
+		printGlobalUsage()
+		os.Exit(1)
+	}
+	args := globalFlags.Args()
+	if len(args) == 0 {
+		printGlobalUsage()
+		os.Exit(1)
 	}
 
+	cfg := resolveCLIConfig(*configPath, *contextName, *output)
 	client := apiClient{config: cfg}
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "project":
-		handleProject(client, os.Args[2:])
+		handleProject(client, args[1:])
 	case "service":
-		handleService(client, os.Args[2:])
+		handleService(client, args[1:])
 	case "domain":
-		handleDomain(client, os.Args[2:])
+		handleDomain(client, args[1:])
 	case "deploy":
-		handleDeploy(client, os.Args[2:])
+		handleDeploy(client, args[1:])
 	case "github":
-		handleGitHub(client, os.Args[2:])
+		handleGitHub(client, args[1:])
 	case "builds":
-		handleBuilds(client, os.Args[2:])
+		handleBuilds(client, args[1:])
+	case "apply":
+		handleApply(client, args[1:])
+	case "diff":
+		handleDiff(client, args[1:])
+	case "destroy":
+		handleDestroy(client, args[1:])
+	case "context":
+		handleContext(cfg.configPath, args[1:])
 	case "help", "--help", "-h":
 		printGlobalUsage()
 	default:
-		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
 		printGlobalUsage()
 		os.Exit(1)
 	}
 }
 
+// resolveCLIConfig merges the layered config sources in precedence order:
+// built-in defaults, then the selected context from the config file, then
+// INFRCTL_API/INFRCTL_TOKEN, then explicit --context's file values are
+// themselves overridden by those env vars. There's no --base-url/--token
+// flag - env vars already cover "override for this one invocation" - so
+// flags only select *which* context and output format apply.
+func resolveCLIConfig(configPath, contextName, output string) cliConfig {
+	cfg := cliConfig{
+		baseURL:    "http://localhost:8080",
+		output:     "json",
+		configPath: configPath,
+	}
+
+	cf, err := cliconfig.Load(configPath)
+	if err == nil {
+		name := contextName
+		if name == "" {
+			name = cf.CurrentContext
+		}
+		if name != "" {
+			if ctx, ok := cf.Contexts[name]; ok {
+				cfg.baseURL = ctx.BaseURL
+				cfg.token = ctx.Token
+				cfg.defaultProject = ctx.DefaultProject
+				cfg.defaultEnv = ctx.DefaultEnv
+			} else {
+				fmt.Fprintf(os.Stderr, "warning: context %q not found in %s\n", name, configPath)
+			}
+		}
+	}
+
+	if v := os.Getenv("INFRCTL_API"); v != "" {
+		cfg.baseURL = v
+	}
+	if v := os.Getenv("INFRCTL_TOKEN"); v != "" {
+		cfg.token = v
+	}
+	if cfg.baseURL == "" {
+		cfg.baseURL = "http://localhost:8080"
+	}
+	cfg.baseURL = strings.TrimRight(cfg.baseURL, "/")
+
+	if output != "" {
+		cfg.output = output
+	}
+	return cfg
+}
+
 func handleProject(client apiClient, args []string) {
 	if len(args) == 0 {
 		printProjectUsage()
@@ -81,13 +169,13 @@ func handleProject(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
 	case "list":
 		body, err := client.get("/v1/projects")
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown project subcommand: %s\n", args[0])
 		printProjectUsage()
@@ -109,6 +197,9 @@ func handleService(client apiClient, args []string) {
 		port := fs.Int("port", 80, "Internal service port")
 		fs.Parse(args[1:])
 
+		if *projectID == "" {
+			*projectID = client.config.defaultProject
+		}
 		if *projectID == "" || *name == "" {
 			fmt.Fprintln(os.Stderr, "--project and --name are required")
 			fs.Usage()
@@ -128,12 +219,15 @@ func handleService(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
 	case "list":
 		fs := flag.NewFlagSet("service list", flag.ExitOnError)
 		projectID := fs.String("project", "", "Project ID")
 		fs.Parse(args[1:])
 
+		if *projectID == "" {
+			*projectID = client.config.defaultProject
+		}
 		if *projectID == "" {
 			fmt.Fprintln(os.Stderr, "--project is required")
 			fs.Usage()
@@ -145,7 +239,7 @@ func handleService(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown service subcommand: %s\n", args[0])
 		printServiceUsage()
@@ -163,7 +257,7 @@ func handleDomain(client apiClient, args []string) {
 		fs := flag.NewFlagSet("domain add", flag.ExitOnError)
 		serviceID := fs.String("service", "", "Service ID")
 		hostname := fs.String("hostname", "", "Hostname")
-		environment := fs.String("env", "production", "Environment name")
+		environment := fs.String("env", "", "Environment name (default production, or the context's default_env)")
 		fs.Parse(args[1:])
 
 		if *serviceID == "" || *hostname == "" {
@@ -171,6 +265,12 @@ func handleDomain(client apiClient, args []string) {
 			fs.Usage()
 			os.Exit(1)
 		}
+		if *environment == "" {
+			*environment = client.config.defaultEnv
+		}
+		if *environment == "" {
+			*environment = "production"
+		}
 
 		payload := map[string]string{
 			"hostname":    *hostname,
@@ -182,7 +282,7 @@ func handleDomain(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown domain subcommand: %s\n", args[0])
 		printDomainUsage()
@@ -200,7 +300,7 @@ func handleDeploy(client apiClient, args []string) {
 		fs := flag.NewFlagSet("deploy set", flag.ExitOnError)
 		serviceID := fs.String("service", "", "Service ID")
 		image := fs.String("image", "", "Container image reference")
-		environment := fs.String("env", "production", "Environment name")
+		environment := fs.String("env", "", "Environment name (default production, or the context's default_env)")
 		fs.Parse(args[1:])
 
 		if *serviceID == "" || *image == "" {
@@ -208,6 +308,12 @@ func handleDeploy(client apiClient, args []string) {
 			fs.Usage()
 			os.Exit(1)
 		}
+		if *environment == "" {
+			*environment = client.config.defaultEnv
+		}
+		if *environment == "" {
+			*environment = "production"
+		}
 
 		payload := map[string]string{
 			"image":       *image,
@@ -219,7 +325,7 @@ func handleDeploy(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown deploy subcommand: %s\n", args[0])
 		printDeployUsage()
@@ -227,6 +333,115 @@ func handleDeploy(client apiClient, args []string) {
 	}
 }
 
+// specClient adapts apiClient's unexported methods to spec.Client, so the
+// spec package can reconcile a manifest against the control plane without
+// importing package main.
+type specClient struct {
+	c apiClient
+}
+
+func (s specClient) Get(path string) ([]byte, error) { return s.c.get(path) }
+func (s specClient) PostJSON(path string, payload any) ([]byte, error) {
+	return s.c.postJSON(path, payload)
+}
+func (s specClient) PatchJSON(path string, payload any) ([]byte, error) {
+	return s.c.patchJSON(path, payload)
+}
+func (s specClient) Delete(path string) error { return s.c.delete(path) }
+
+func handleApply(client apiClient, args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	file := fs.String("f", "", "Path to the manifest file")
+	dryRun := fs.Bool("dry-run", false, "Print the plan without applying it")
+	prune := fs.Bool("prune", false, "Report projects/services/domains that exist on the control plane but aren't in the manifest")
+	fs.Parse(args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "-f is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	runPlan(client, *file, false, *prune, *dryRun)
+}
+
+func handleDiff(client apiClient, args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	file := fs.String("f", "", "Path to the manifest file")
+	prune := fs.Bool("prune", false, "Report projects/services/domains that exist on the control plane but aren't in the manifest")
+	fs.Parse(args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "-f is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	plan := buildPlan(client, *file, false, *prune)
+	printPlan(plan)
+}
+
+func handleDestroy(client apiClient, args []string) {
+	fs := flag.NewFlagSet("destroy", flag.ExitOnError)
+	file := fs.String("f", "", "Path to the manifest file")
+	dryRun := fs.Bool("dry-run", false, "Print the plan without applying it")
+	fs.Parse(args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "-f is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	runPlan(client, *file, true, false, *dryRun)
+}
+
+func buildPlan(client apiClient, file string, destroy, prune bool) spec.Plan {
+	m, err := spec.Load(file)
+	if err != nil {
+		exitWithError(err)
+	}
+	plan, err := spec.Build(specClient{c: client}, m, destroy, prune)
+	if err != nil {
+		exitWithError(err)
+	}
+	return plan
+}
+
+func printPlan(plan spec.Plan) {
+	for _, op := range plan.Ops {
+		fmt.Println(op.String())
+	}
+	fmt.Println(plan.Summary())
+}
+
+func runPlan(client apiClient, file string, destroy, prune, dryRun bool) {
+	plan := buildPlan(client, file, destroy, prune)
+	printPlan(plan)
+
+	if dryRun {
+		return
+	}
+
+	fmt.Println()
+	results := spec.Apply(specClient{c: client}, plan, false)
+	failures := 0
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			fmt.Printf("skip  %-8s %s (skipped after an earlier failure)\n", r.Action, r.Resource)
+		case r.Err != nil:
+			failures++
+			fmt.Printf("error %-8s %s: %v\n", r.Action, r.Resource, r.Err)
+		default:
+			fmt.Printf("ok    %-8s %s\n", r.Action, r.Resource)
+		}
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
 type apiClient struct {
 	config cliConfig
 }
@@ -302,6 +517,21 @@ func (c apiClient) patchJSON(path string, payload any) ([]byte, error) {
 	return body, nil
 }
 
+func (c apiClient) delete(path string) error {
+	req, err := c.newRequest(http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+	body, status, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return fmt.Errorf("api error %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
 func (c apiClient) get(path string) ([]byte, error) {
 	req, err := c.newRequest(http.MethodGet, path, nil)
 	if err != nil {
@@ -317,6 +547,28 @@ func (c apiClient) get(path string) ([]byte, error) {
 	return body, nil
 }
 
+// getStream issues a GET against path and returns the raw response body
+// for a caller to read framed SSE events off of. It uses a Client with no
+// read timeout, since http.DefaultClient's would cut a long-lived
+// `builds logs --follow` connection off well before the build finishes.
+func (c apiClient) getStream(path string) (io.ReadCloser, error) {
+	req, err := c.newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 0}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.Body, nil
+}
+
 func (c apiClient) do(req *http.Request) ([]byte, int, error) {
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -340,17 +592,234 @@ func printJSON(data []byte) {
 	fmt.Println(buf.String())
 }
 
+// render prints an API response body in format ("json", "yaml", or
+// "table"), falling back to printJSON for an empty or unrecognized
+// format so every existing call site keeps its old behavior by default.
+func render(body []byte, format string) {
+	switch format {
+	case "yaml":
+		renderYAML(body)
+	case "table":
+		renderTable(body)
+	default:
+		printJSON(body)
+	}
+}
+
+func renderYAML(body []byte) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		fmt.Println(string(body))
+		return
+	}
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		fmt.Println(string(body))
+		return
+	}
+	fmt.Print(string(out))
+}
+
+// renderTable tabulates a JSON array, the shape most list endpoints
+// return, or an array-valued field of a JSON object (how list endpoints
+// that wrap results, e.g. {"projects": [...]}, are shaped); when an object
+// has several array fields, which one is tabulated is not defined.
+// A single-object response (e.g. `project create`) renders as a two
+// column key/value table instead, rather than failing. Column layout
+// follows Woodpecker/Drone's tab-aligned list output.
+func renderTable(body []byte) {
+	var raw any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		fmt.Println(string(body))
+		return
+	}
+
+	var rows []any
+	switch v := raw.(type) {
+	case []any:
+		rows = v
+	case map[string]any:
+		for _, val := range v {
+			if list, ok := val.([]any); ok {
+				rows = list
+				break
+			}
+		}
+		if rows == nil {
+			renderKV(v)
+			return
+		}
+	default:
+		fmt.Println(string(body))
+		return
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("(no results)")
+		return
+	}
+	first, ok := rows[0].(map[string]any)
+	if !ok {
+		for _, r := range rows {
+			fmt.Println(r)
+		}
+		return
+	}
+
+	columns := make([]string, 0, len(first))
+	for k := range first {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, r := range rows {
+		row, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			cells[i] = fmt.Sprint(row[c])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+}
+
+func renderKV(obj map[string]any) {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%v\n", k, obj[k])
+	}
+	tw.Flush()
+}
+
+// handleContext manages named profiles in the config file at configPath:
+// `context list` prints them (marking current_context), `context use`
+// switches current_context, and `context set` creates or updates one.
+func handleContext(configPath string, args []string) {
+	if len(args) == 0 {
+		printContextUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		cf, err := cliconfig.Load(configPath)
+		if err != nil {
+			exitWithError(err)
+		}
+		names := make([]string, 0, len(cf.Contexts))
+		for name := range cf.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			marker := " "
+			if name == cf.CurrentContext {
+				marker = "*"
+			}
+			ctx := cf.Contexts[name]
+			fmt.Printf("%s %s\t%s\n", marker, name, ctx.BaseURL)
+		}
+	case "use":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: infrctl context use <name>")
+			os.Exit(1)
+		}
+		name := args[1]
+		cf, err := cliconfig.Load(configPath)
+		if err != nil {
+			exitWithError(err)
+		}
+		if _, ok := cf.Contexts[name]; !ok {
+			exitWithError(fmt.Errorf("context %q not found", name))
+		}
+		cf.CurrentContext = name
+		if err := cliconfig.Save(configPath, cf); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("switched to context %q\n", name)
+	case "set":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: infrctl context set <name> --url <url> --token <token> [--default-project <id>] [--default-env <name>]")
+			os.Exit(1)
+		}
+		name := args[1]
+		fs := flag.NewFlagSet("context set", flag.ExitOnError)
+		url := fs.String("url", "", "Control plane base URL")
+		token := fs.String("token", "", "Bearer token")
+		defaultProject := fs.String("default-project", "", "Project ID used when --project is omitted")
+		defaultEnv := fs.String("default-env", "", "Environment used when --env is omitted")
+		fs.Parse(args[2:])
+
+		cf, err := cliconfig.Load(configPath)
+		if err != nil {
+			exitWithError(err)
+		}
+		ctx := cf.Contexts[name]
+		if *url != "" {
+			ctx.BaseURL = *url
+		}
+		if *token != "" {
+			ctx.Token = *token
+		}
+		if *defaultProject != "" {
+			ctx.DefaultProject = *defaultProject
+		}
+		if *defaultEnv != "" {
+			ctx.DefaultEnv = *defaultEnv
+		}
+		cf.Contexts[name] = ctx
+		if cf.CurrentContext == "" {
+			cf.CurrentContext = name
+		}
+		if err := cliconfig.Save(configPath, cf); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("saved context %q\n", name)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown context subcommand: %s\n", args[0])
+		printContextUsage()
+		os.Exit(1)
+	}
+}
+
+func printContextUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  infrctl context list")
+	fmt.Println("  infrctl context use <name>")
+	fmt.Println("  infrctl context set <name> --url <url> --token <token> [--default-project <id>] [--default-env <name>]")
+}
+
 func printGlobalUsage() {
-	fmt.Println("Usage: infrctl <command> [<args>]")
+	fmt.Println("Usage: infrctl [--config <path>] [--context <name>] [--output json|yaml|table] <command> [<args>]")
 	fmt.Println("Commands:")
 	fmt.Println("  project create|list")
 	fmt.Println("  service create|list")
 	fmt.Println("  domain add")
 	fmt.Println("  deploy set")
 	fmt.Println("  github repos|register|installations")
-	fmt.Println("  builds list|update")
+	fmt.Println("  builds list|update|logs|worker")
+	fmt.Println("  apply -f <file> [--dry-run]")
+	fmt.Println("  diff -f <file>")
+	fmt.Println("  destroy -f <file> [--dry-run]")
+	fmt.Println("  context list|use|set")
 	fmt.Println("")
-	fmt.Println("Environment:")
+	fmt.Println("Global flags:")
+	fmt.Println("  --config  Path to config.yaml (default ~/.config/infrctl/config.yaml)")
+	fmt.Println("  --context Named context to use instead of current_context")
+	fmt.Println("  --output  Output format: json (default), yaml, or table")
+	fmt.Println("")
+	fmt.Println("Environment (overrides the selected context's values):")
 	fmt.Println("  INFRCTL_API   Control plane base URL (default http://localhost:8080)")
 	fmt.Println("  INFRCTL_TOKEN Bearer token for authenticated access")
 }
@@ -377,69 +846,90 @@ func printDeployUsage() {
 	fmt.Println("  infrctl deploy set --service <id> --image <ref> [--env <name>]")
 }
 
+func printApplyUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  infrctl apply -f <file> [--dry-run] [--prune]")
+	fmt.Println("  infrctl diff -f <file> [--prune]")
+	fmt.Println("  infrctl destroy -f <file> [--dry-run]")
+	fmt.Println("")
+	fmt.Println("-f points at a YAML manifest declaring projects/services/domains/")
+	fmt.Println("deployments/github bindings. apply reconciles the control plane to")
+	fmt.Println("match it; diff prints the plan without applying it; destroy plans")
+	fmt.Println("deletions, reporting any resource kind the control plane has no")
+	fmt.Println("delete endpoint for as unsupported rather than silently skipping it.")
+	fmt.Println("--prune additionally diffs in the other direction, reporting any")
+	fmt.Println("project/service/domain that exists on the control plane but isn't")
+	fmt.Println("declared in the manifest - also as unsupported, since none of those")
+	fmt.Println("three resource kinds has a delete endpoint to act on it with.")
+}
+
 func printBuildUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  infrctl builds list")
 	fmt.Println("  infrctl builds update --id <job-id> [--status pending|running|succeeded|failed] [--reason <text>]")
+	fmt.Println("  infrctl builds cancel --id <job-id>")
+	fmt.Println("  infrctl builds logs --id <job-id> [--since <n>] [--follow]")
 	fmt.Println("  infrctl builds worker [--name worker-1] [--interval 5s] [--auto-complete=true] [--reason text]")
+	fmt.Println("    [--registry host/org] [--registry-user <user>] [--registry-pass <pass>] [--workdir ./worker-tmp] [--concurrency N] [--no-push]")
+	fmt.Println("    [--lease 90s] [--shutdown-timeout 5m]")
 }
 
 func handleGitHub(client apiClient, args []string) {
-    if len(args) == 0 {
-        printGitHubUsage()
-        os.Exit(1)
-    }
-
-    switch args[0] {
-    case "repos":
-        body, err := client.get("/v1/github/repos")
-        if err != nil {
-            exitWithError(err)
-        }
-        printJSON(body)
-    case "register":
-        fs := flag.NewFlagSet("github register", flag.ExitOnError)
-        repo := fs.String("repo", "", "Repository in owner/name form")
-        branch := fs.String("branch", "main", "Default branch")
-        composePath := fs.String("compose", "docker-compose.yml", "Compose file path")
-        installation := fs.String("installation", "", "GitHub App installation ID (optional)")
-        serviceID := fs.String("service", "", "Service ID to deploy")
-        env := fs.String("env", "production", "Environment name")
-        fs.Parse(args[1:])
-
-        owner, name, err := splitRepo(*repo)
-        if err != nil {
-            fmt.Fprintf(os.Stderr, "invalid --repo: %v\n", err)
-            fs.Usage()
-            os.Exit(1)
-        }
-
-        payload := map[string]string{
-            "owner":          owner,
-            "name":           name,
-            "default_branch": *branch,
-            "compose_path":   *composePath,
-        }
-        if *installation != "" {
-            payload["installation_id"] = *installation
-        }
-        if *serviceID != "" {
-            payload["service_id"] = *serviceID
-            payload["environment"] = *env
-        }
-
-        body, err := client.postJSON("/v1/github/repos", payload)
-        if err != nil {
-            exitWithError(err)
-        }
-        printJSON(body)
-    case "installations":
-        handleGitHubInstallations(client, args[1:])
-    default:
-        fmt.Fprintf(os.Stderr, "unknown github subcommand: %s\n", args[0])
-        printGitHubUsage()
-        os.Exit(1)
-    }
+	if len(args) == 0 {
+		printGitHubUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "repos":
+		body, err := client.get("/v1/github/repos")
+		if err != nil {
+			exitWithError(err)
+		}
+		render(body, client.config.output)
+	case "register":
+		fs := flag.NewFlagSet("github register", flag.ExitOnError)
+		repo := fs.String("repo", "", "Repository in owner/name form")
+		branch := fs.String("branch", "main", "Default branch")
+		composePath := fs.String("compose", "docker-compose.yml", "Compose file path")
+		installation := fs.String("installation", "", "GitHub App installation ID (optional)")
+		serviceID := fs.String("service", "", "Service ID to deploy")
+		env := fs.String("env", "production", "Environment name")
+		fs.Parse(args[1:])
+
+		owner, name, err := splitRepo(*repo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --repo: %v\n", err)
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		payload := map[string]string{
+			"owner":          owner,
+			"name":           name,
+			"default_branch": *branch,
+			"compose_path":   *composePath,
+		}
+		if *installation != "" {
+			payload["installation_id"] = *installation
+		}
+		if *serviceID != "" {
+			payload["service_id"] = *serviceID
+			payload["environment"] = *env
+		}
+
+		body, err := client.postJSON("/v1/github/repos", payload)
+		if err != nil {
+			exitWithError(err)
+		}
+		render(body, client.config.output)
+	case "installations":
+		handleGitHubInstallations(client, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown github subcommand: %s\n", args[0])
+		printGitHubUsage()
+		os.Exit(1)
+	}
 }
 
 func handleGitHubInstallations(client apiClient, args []string) {
@@ -448,37 +938,99 @@ func handleGitHubInstallations(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
 		return
 	}
 
 	switch args[0] {
 	case "register":
-        fs := flag.NewFlagSet("github installations register", flag.ExitOnError)
-        account := fs.String("account", "", "Account login (org/user)")
-        external := fs.String("external-id", "", "GitHub installation ID")
-        secret := fs.String("secret", "", "Shared webhook secret (optional)")
-        fs.Parse(args[1:])
-
-        if *account == "" || *external == "" {
-            fmt.Fprintln(os.Stderr, "--account and --external-id are required")
-            fs.Usage()
-            os.Exit(1)
-        }
-
-        payload := map[string]string{
-            "account":     *account,
-            "external_id": *external,
-        }
-        if *secret != "" {
-            payload["webhook_secret"] = *secret
-        }
-
-        body, err := client.postJSON("/v1/github/installations", payload)
-        if err != nil {
-            exitWithError(err)
-        }
-        printJSON(body)
+		fs := flag.NewFlagSet("github installations register", flag.ExitOnError)
+		account := fs.String("account", "", "Account login (org/user)")
+		external := fs.String("external-id", "", "GitHub installation ID")
+		secret := fs.String("secret", "", "Shared webhook secret (optional)")
+		appID := fs.String("app-id", "", "Override GitHub App ID for this installation (optional)")
+		pemPath := fs.String("pem", "", "Path to this installation's GitHub App private key PEM (optional, requires --app-id)")
+		fs.Parse(args[1:])
+
+		if *account == "" || *external == "" {
+			fmt.Fprintln(os.Stderr, "--account and --external-id are required")
+			fs.Usage()
+			os.Exit(1)
+		}
+		if (*appID == "") != (*pemPath == "") {
+			fmt.Fprintln(os.Stderr, "--app-id and --pem must be given together")
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		payload := map[string]string{
+			"account":     *account,
+			"external_id": *external,
+		}
+		if *secret != "" {
+			payload["webhook_secret"] = *secret
+		}
+		if *appID != "" {
+			pem, err := os.ReadFile(*pemPath)
+			if err != nil {
+				exitWithError(err)
+			}
+			payload["app_id"] = *appID
+			payload["app_private_key"] = string(pem)
+		}
+
+		body, err := client.postJSON("/v1/github/installations", payload)
+		if err != nil {
+			exitWithError(err)
+		}
+		render(body, client.config.output)
+	case "refresh":
+		fs := flag.NewFlagSet("github installations refresh", flag.ExitOnError)
+		id := fs.String("id", "", "Installation ID")
+		fs.Parse(args[1:])
+
+		if *id == "" {
+			fmt.Fprintln(os.Stderr, "--id is required")
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		body, err := client.postJSON(fmt.Sprintf("/v1/github/installations/%s/refresh", *id), map[string]string{})
+		if err != nil {
+			exitWithError(err)
+		}
+		render(body, client.config.output)
+	case "token":
+		fs := flag.NewFlagSet("github installations token", flag.ExitOnError)
+		id := fs.String("id", "", "Installation ID")
+		fs.Parse(args[1:])
+
+		if *id == "" {
+			fmt.Fprintln(os.Stderr, "--id is required")
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		body, err := client.postJSON(fmt.Sprintf("/v1/github/installations/%s/token", *id), map[string]string{})
+		if err != nil {
+			exitWithError(err)
+		}
+		render(body, client.config.output)
+	case "delete":
+		fs := flag.NewFlagSet("github installations delete", flag.ExitOnError)
+		id := fs.String("id", "", "Installation ID")
+		fs.Parse(args[1:])
+
+		if *id == "" {
+			fmt.Fprintln(os.Stderr, "--id is required")
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		if err := client.delete(fmt.Sprintf("/v1/github/installations/%s", *id)); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("installation %s deleted\n", *id)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown github installations subcommand: %s\n", args[0])
 		fmt.Println("Usage: infrctl github installations [register --account org --external-id 12345]")
@@ -498,7 +1050,38 @@ func handleBuilds(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
+	case "logs":
+		fs := flag.NewFlagSet("builds logs", flag.ExitOnError)
+		id := fs.String("id", "", "Build job ID")
+		follow := fs.Bool("follow", false, "Stream new lines as they arrive")
+		since := fs.Int("since", 0, "Resume after this sequence number (see the previous call's \"next\")")
+		fs.Parse(args[1:])
+
+		if *id == "" {
+			fmt.Fprintln(os.Stderr, "--id is required")
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		if *follow {
+			followBuildLogs(client, *id, *since)
+			return
+		}
+
+		body, err := client.get(fmt.Sprintf("/v1/build-jobs/%s/logs?since=%d", *id, *since))
+		if err != nil {
+			exitWithError(err)
+		}
+		var decoded struct {
+			Lines []string `json:"lines"`
+		}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			exitWithError(err)
+		}
+		for _, line := range decoded.Lines {
+			printLogLine(line)
+		}
 	case "update":
 		fs := flag.NewFlagSet("builds update", flag.ExitOnError)
 		id := fs.String("id", "", "Build job ID")
@@ -524,16 +1107,54 @@ func handleBuilds(client apiClient, args []string) {
 		if err != nil {
 			exitWithError(err)
 		}
-		printJSON(body)
+		render(body, client.config.output)
+	case "cancel":
+		fs := flag.NewFlagSet("builds cancel", flag.ExitOnError)
+		id := fs.String("id", "", "Build job ID")
+		fs.Parse(args[1:])
+
+		if *id == "" {
+			fmt.Fprintln(os.Stderr, "--id is required")
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		body, err := client.postJSON(fmt.Sprintf("/v1/build-jobs/%s/cancel", *id), map[string]string{})
+		if err != nil {
+			exitWithError(err)
+		}
+		render(body, client.config.output)
 	case "worker":
 		fs := flag.NewFlagSet("builds worker", flag.ExitOnError)
 		name := fs.String("name", "local-worker", "Worker identifier")
 		interval := fs.Duration("interval", 5*time.Second, "Polling interval")
 		succeed := fs.Bool("auto-complete", true, "Automatically mark jobs succeeded")
 		reason := fs.String("reason", "", "Reason to attach on completion")
+		registry := fs.String("registry", os.Getenv("INFRCTL_REGISTRY"), "Registry prefix images are tagged/pushed under, e.g. ghcr.io/org")
+		registryUser := fs.String("registry-user", os.Getenv("INFRCTL_REGISTRY_USER"), "Registry username for docker login (optional)")
+		registryPass := fs.String("registry-pass", os.Getenv("INFRCTL_REGISTRY_PASS"), "Registry password/token for docker login (optional)")
+		workdir := fs.String("workdir", envOrDefault("INFRCTL_WORKDIR", "./worker-tmp"), "Directory clones and builds happen in")
+		concurrency := fs.Int("concurrency", 1, "Maximum number of build jobs to run at once")
+		noPush := fs.Bool("no-push", false, "Build images but skip the registry push (dry run)")
+		lease := fs.Duration("lease", 90*time.Second, "Must match (or undercut) the control plane's build-job lease; heartbeats are sent every lease/3")
+		shutdownTimeout := fs.Duration("shutdown-timeout", 5*time.Minute, "Grace period on SIGINT/SIGTERM to let in-flight jobs finish before they're aborted and requeued")
 		fs.Parse(args[1:])
 
-		runBuildWorker(client, *name, *interval, *succeed, *reason)
+		cfg := buildWorkerConfig{
+			name:            *name,
+			interval:        *interval,
+			autoComplete:    *succeed,
+			reason:          *reason,
+			registry:        strings.TrimRight(*registry, "/"),
+			registryUser:    *registryUser,
+			registryPass:    *registryPass,
+			workdir:         *workdir,
+			concurrency:     *concurrency,
+			push:            !*noPush,
+			lease:           *lease,
+			shutdownTimeout: *shutdownTimeout,
+		}
+		runBuildWorker(client, cfg)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown builds subcommand: %s\n", args[0])
 		printBuildUsage()
@@ -541,50 +1162,650 @@ func handleBuilds(client apiClient, args []string) {
 	}
 }
 
-func runBuildWorker(client apiClient, worker string, interval time.Duration, autoComplete bool, completionReason string) {
-	fmt.Printf("[worker %s] starting polling loop (interval %s)\n", worker, interval)
+// buildWorkerConfig holds `infrctl builds worker`'s flags: where to clone
+// and build (workdir), where to push (registry, plus optional docker login
+// credentials), how many jobs to run at once (concurrency), and how the
+// worker keeps its lease alive and winds down (lease, shutdownTimeout).
+type buildWorkerConfig struct {
+	name         string
+	interval     time.Duration
+	autoComplete bool
+	reason       string
+	registry     string
+	registryUser string
+	registryPass string
+	workdir      string
+	concurrency  int
+	push         bool
+	// lease is how long the control plane lets a claimed job go without a
+	// heartbeat before reclaiming it; the worker heartbeats at lease/3 to
+	// leave margin for a couple of missed beats before that happens.
+	lease time.Duration
+	// shutdownTimeout is how long SIGINT/SIGTERM waits for in-flight jobs
+	// to finish before their build is aborted and requeued.
+	shutdownTimeout time.Duration
+}
+
+// buildWorkerJob is the subset of a claimed BuildJob runBuildWorker acts on.
+type buildWorkerJob struct {
+	ID              string   `json:"id"`
+	Repository      string   `json:"repository"`
+	Ref             string   `json:"ref"`
+	Commit          string   `json:"commit"`
+	Provider        string   `json:"provider"`
+	Installation    string   `json:"installation"`
+	ServiceID       string   `json:"service_id"`
+	ComposePath     string   `json:"compose_path"`
+	Attempt         int      `json:"attempt"`
+	CancelRequested bool     `json:"cancel_requested"`
+	Secrets         []string `json:"secrets"`
+}
+
+// runBuildWorker polls /v1/build-jobs/claim on cfg.interval and fans claimed
+// jobs out to a pool of at most cfg.concurrency goroutines, each of which
+// clones the job's commit, builds and pushes its image, and PATCHes the
+// result back. Empty polls back off exponentially (capped at 60s, with
+// jitter) instead of retrying on a fixed interval, so an idle fleet of
+// these doesn't hammer the control plane.
+//
+// SIGINT/SIGTERM stop new claims and give in-flight jobs cfg.shutdownTimeout
+// to finish; a job still running once that elapses has its context canceled
+// (aborting its docker build) and is PATCHed back to pending with
+// reason=worker_shutdown so another worker can pick it up.
+func runBuildWorker(client apiClient, cfg buildWorkerConfig) {
+	if cfg.concurrency < 1 {
+		cfg.concurrency = 1
+	}
+	fmt.Printf("[worker %s] starting polling loop (interval %s, concurrency %d, lease %s)\n", cfg.name, cfg.interval, cfg.concurrency, cfg.lease)
+
+	if cfg.registry != "" && cfg.registryUser != "" {
+		if err := dockerLogin(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "[worker %s] docker login failed: %v\n", cfg.name, err)
+		}
+	}
+
+	shutdownCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	jobs := newActiveJobs()
+
+	const maxBackoff = 60 * time.Second
+	backoff := cfg.interval
+	slots := make(chan struct{}, cfg.concurrency)
+	var wg sync.WaitGroup
+
+pollLoop:
 	for {
-		body, status, err := client.postJSONStatus("/v1/build-jobs/claim", map[string]string{"worker": worker})
+		select {
+		case <-shutdownCtx.Done():
+			break pollLoop
+		default:
+		}
+
+		body, status, err := client.postJSONStatus("/v1/build-jobs/claim", map[string]string{"worker": cfg.name})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[worker %s] claim error: %v\n", worker, err)
-			time.Sleep(interval)
+			fmt.Fprintf(os.Stderr, "[worker %s] claim error: %v\n", cfg.name, err)
+			if sleepUnlessDone(shutdownCtx, jittered(backoff)) {
+				break pollLoop
+			}
+			backoff = nextBackoff(backoff, maxBackoff)
 			continue
 		}
 		if status == http.StatusNoContent {
-			time.Sleep(interval)
+			if sleepUnlessDone(shutdownCtx, jittered(backoff)) {
+				break pollLoop
+			}
+			backoff = nextBackoff(backoff, maxBackoff)
 			continue
 		}
+		backoff = cfg.interval
 
-		var job struct {
-			ID           string `json:"id"`
-			Repository   string `json:"repository"`
-			Ref          string `json:"ref"`
-			Commit       string `json:"commit"`
-			Installation string `json:"installation"`
-		}
+		var job buildWorkerJob
 		if err := json.Unmarshal(body, &job); err != nil {
-			fmt.Fprintf(os.Stderr, "[worker %s] decode claim response: %v\n", worker, err)
-			time.Sleep(interval)
+			fmt.Fprintf(os.Stderr, "[worker %s] decode claim response: %v\n", cfg.name, err)
 			continue
 		}
 
-		fmt.Printf("[worker %s] claimed job %s (%s @ %s)\n", worker, job.ID, job.Repository, job.Commit)
+		select {
+		case slots <- struct{}{}:
+		case <-shutdownCtx.Done():
+			break pollLoop
+		}
+
+		jobCtx, cancelJob := context.WithCancel(context.Background())
+		jobs.add(job.ID, cancelJob)
+		wg.Add(1)
+		go func(job buildWorkerJob) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer jobs.remove(job.ID)
+			runBuildWorkerJob(jobCtx, client, cfg, job)
+		}(job)
+	}
 
-		if autoComplete {
-			payload := map[string]string{
-				"status": "succeeded",
+	fmt.Printf("[worker %s] shutting down, waiting up to %s for %d in-flight job(s)\n", cfg.name, cfg.shutdownTimeout, jobs.count())
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cfg.shutdownTimeout):
+		fmt.Printf("[worker %s] shutdown grace period elapsed, aborting remaining job(s)\n", cfg.name)
+		jobs.cancelAll()
+		<-done
+	}
+}
+
+// sleepUnlessDone sleeps for d, returning early (and reporting true) if ctx
+// is canceled first - so a worker waiting out its poll backoff still reacts
+// to SIGINT/SIGTERM immediately instead of finishing the sleep.
+func sleepUnlessDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-ctx.Done():
+		return true
+	}
+}
+
+// activeJobs tracks the cancel funcs for jobs currently being built, so a
+// shutdown whose grace period elapses can abort whichever are still running.
+type activeJobs struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func newActiveJobs() *activeJobs {
+	return &activeJobs{cancels: map[string]context.CancelFunc{}}
+}
+
+func (j *activeJobs) add(id string, cancel context.CancelFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cancels[id] = cancel
+}
+
+func (j *activeJobs) remove(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.cancels, id)
+}
+
+func (j *activeJobs) count() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.cancels)
+}
+
+func (j *activeJobs) cancelAll() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, cancel := range j.cancels {
+		cancel()
+	}
+}
+
+// nextBackoff doubles d, capped at max.
+func nextBackoff(d, max time.Duration) time.Duration {
+	d *= 2
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// jittered returns d plus up to 20% extra, so a fleet of workers polling on
+// the same interval doesn't all retry in lockstep.
+func jittered(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// runBuildWorkerJob runs one claimed job to completion under jobCtx, sending
+// a heartbeat every cfg.lease/3 so the control plane doesn't reclaim it
+// mid-build. A heartbeat reporting CancelRequested, or jobCtx being canceled
+// by the worker's own shutdown, both abort the build (via jobCtx feeding
+// into every exec.CommandContext performBuild runs) but are reported back
+// differently: a cancellation fails the job, a shutdown requeues it.
+func runBuildWorkerJob(jobCtx context.Context, client apiClient, cfg buildWorkerConfig, job buildWorkerJob) {
+	fmt.Printf("[worker %s] claimed job %s (%s @ %s)\n", cfg.name, job.ID, job.Repository, job.Commit)
+
+	buildCtx, abortBuild := context.WithCancel(jobCtx)
+	defer abortBuild()
+	buildCtx = withBuildLogSink(buildCtx, newBuildLogWriter(client, job.ID))
+	canceled := make(chan struct{})
+	heartbeatDone := make(chan struct{})
+	go heartbeatLoop(buildCtx, client, cfg, job.ID, abortBuild, canceled, heartbeatDone)
+	defer close(heartbeatDone)
+
+	imageRef, err := performBuild(buildCtx, client, cfg, job)
+	if err != nil {
+		select {
+		case <-canceled:
+			fmt.Printf("[worker %s] job %s canceled by operator\n", cfg.name, job.ID)
+			postBuildLogLine(client, job.ID, "build canceled by operator")
+			if _, patchErr := client.patchJSON("/v1/build-jobs/"+job.ID, map[string]any{
+				"status": "failed",
+				"reason": "canceled by operator",
+			}); patchErr != nil {
+				fmt.Fprintf(os.Stderr, "[worker %s] failed to mark job %s canceled: %v\n", cfg.name, job.ID, patchErr)
 			}
-			if completionReason != "" {
-				payload["reason"] = completionReason
+		case <-jobCtx.Done():
+			fmt.Printf("[worker %s] job %s interrupted by shutdown, requeuing\n", cfg.name, job.ID)
+			if _, patchErr := client.patchJSON("/v1/build-jobs/"+job.ID, map[string]any{
+				"status": "pending",
+				"reason": "worker_shutdown",
+			}); patchErr != nil {
+				fmt.Fprintf(os.Stderr, "[worker %s] failed to requeue job %s: %v\n", cfg.name, job.ID, patchErr)
 			}
-			if _, err := client.patchJSON("/v1/build-jobs/"+job.ID, payload); err != nil {
-				fmt.Fprintf(os.Stderr, "[worker %s] failed to mark job %s: %v\n", worker, job.ID, err)
-			} else {
-				fmt.Printf("[worker %s] completed job %s\n", worker, job.ID)
+		default:
+			fmt.Fprintf(os.Stderr, "[worker %s] job %s failed: %v\n", cfg.name, job.ID, err)
+			postBuildLogLine(client, job.ID, fmt.Sprintf("build error: %v", err))
+			if _, patchErr := client.patchJSON("/v1/build-jobs/"+job.ID, map[string]any{
+				"status": "failed",
+				"reason": err.Error(),
+			}); patchErr != nil {
+				fmt.Fprintf(os.Stderr, "[worker %s] failed to mark job %s failed: %v\n", cfg.name, job.ID, patchErr)
 			}
 		}
+		return
+	}
 
-		time.Sleep(interval)
+	payload := map[string]any{"logs_url": fmt.Sprintf("/v1/build-jobs/%s/logs", job.ID)}
+	if cfg.autoComplete {
+		payload["status"] = "succeeded"
+	}
+	if cfg.reason != "" {
+		payload["reason"] = cfg.reason
+	}
+	if imageRef != "" && job.ServiceID != "" {
+		payload["image_refs"] = map[string]string{job.ServiceID: imageRef}
+	}
+	if _, err := client.patchJSON("/v1/build-jobs/"+job.ID, payload); err != nil {
+		fmt.Fprintf(os.Stderr, "[worker %s] failed to update job %s: %v\n", cfg.name, job.ID, err)
+		return
+	}
+	fmt.Printf("[worker %s] completed job %s\n", cfg.name, job.ID)
+}
+
+// heartbeatLoop POSTs /v1/build-jobs/{id}/heartbeat every cfg.lease/3 until
+// done is closed, even after buildCtx is canceled, keeping the control
+// plane's lease on jobID from expiring. If a response ever carries cancel_requested, it closes canceled
+// and calls abortBuild exactly once, then keeps heartbeating (a canceled
+// build still needs its lease held until it actually unwinds). Stops as
+// soon as done is closed by the caller, win or lose.
+func heartbeatLoop(buildCtx context.Context, client apiClient, cfg buildWorkerConfig, jobID string, abortBuild context.CancelFunc, canceled, done chan struct{}) {
+	interval := cfg.lease / 3
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			body, err := client.postJSON(fmt.Sprintf("/v1/build-jobs/%s/heartbeat", jobID), map[string]string{})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "heartbeat for job %s failed: %v\n", jobID, err)
+				continue
+			}
+			var decoded struct {
+				CancelRequested bool `json:"cancel_requested"`
+			}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				continue
+			}
+			if decoded.CancelRequested {
+				select {
+				case <-canceled:
+				default:
+					close(canceled)
+					abortBuild()
+				}
+			}
+		}
+	}
+}
+
+// performBuild clones job's commit into a fresh cfg.workdir/job.ID
+// workspace using an installation clone token, builds the image (via
+// `docker compose build` when the repo's compose_path points at one,
+// `docker build` against the workspace root otherwise), tags it
+// <registry>/<repository name>/<service ID>:<short commit>, with an
+// -r<attempt> suffix on a retried job (the middle path segment is the
+// lowercased repository name, not a project), pushes it unless cfg.push is
+// false, and returns the resulting image reference. Every step runs under
+// ctx, so canceling it (operator cancel, or worker shutdown) kills whatever
+// git/docker subprocess is in flight instead of leaving it to finish.
+func performBuild(ctx context.Context, client apiClient, cfg buildWorkerConfig, job buildWorkerJob) (string, error) {
+	owner, name, err := splitRepo(job.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	workdir := filepath.Join(cfg.workdir, job.ID)
+	if err := os.RemoveAll(workdir); err != nil {
+		return "", fmt.Errorf("clean workspace: %w", err)
+	}
+	defer os.RemoveAll(workdir)
+
+	postBuildLogLine(client, job.ID, fmt.Sprintf("Step 1/4: cloning %s@%s", job.Repository, job.Commit))
+	cloneURL, err := cloneURLForJob(client, job)
+	if err != nil {
+		return "", fmt.Errorf("clone token: %w", err)
+	}
+	if err := runCommand(ctx, "", "git", "clone", "--depth", "1", cloneURL, workdir); err != nil {
+		return "", fmt.Errorf("git clone: %w", err)
+	}
+	if err := runCommand(ctx, workdir, "git", "fetch", "--depth", "1", "origin", job.Commit); err != nil {
+		return "", fmt.Errorf("git fetch: %w", err)
+	}
+	if err := runCommand(ctx, workdir, "git", "checkout", job.Commit); err != nil {
+		return "", fmt.Errorf("git checkout: %w", err)
+	}
+	// Drop the embedded clone token from the remote URL so it doesn't
+	// linger in .git/config for the lifetime of the (soon-deleted) workspace.
+	_ = runCommand(ctx, workdir, "git", "remote", "set-url", "origin", fmt.Sprintf("https://github.com/%s.git", job.Repository))
+
+	service := job.ServiceID
+	if service == "" {
+		service = "app"
+	}
+	tag := shortSHA(job.Commit)
+	if job.Attempt > 0 {
+		tag = fmt.Sprintf("%s-r%d", tag, job.Attempt)
+	}
+	registry := cfg.registry
+	if registry == "" {
+		registry = fmt.Sprintf("ghcr.io/%s", strings.ToLower(owner))
+	}
+	imageName := fmt.Sprintf("%s/%s/%s:%s", registry, strings.ToLower(name), service, tag)
+
+	postBuildLogLine(client, job.ID, fmt.Sprintf("Step 2/4: building %s", imageName))
+	if job.ComposePath != "" {
+		// docker compose build has no equivalent of BuildKit's --secret
+		// flag for injecting per-service secrets, so job.Secrets only
+		// reaches the plain `docker build` path below. A compose-based
+		// service gets no build-time secrets from this worker.
+		if err := runCommand(ctx, workdir, "docker", "compose", "-f", job.ComposePath, "build"); err != nil {
+			return "", fmt.Errorf("docker compose build: %w", err)
+		}
+		if err := runCommand(ctx, workdir, "docker", "tag", fmt.Sprintf("%s-%s", filepath.Base(workdir), service), imageName); err != nil {
+			return "", fmt.Errorf("docker tag: %w", err)
+		}
+	} else {
+		secretDir, cleanup, err := writeBuildSecrets(job.Secrets)
+		if err != nil {
+			return "", fmt.Errorf("write build secrets: %w", err)
+		}
+		defer cleanup()
+
+		args := []string{"build", "-t", imageName}
+		for i := range job.Secrets {
+			args = append(args, "--secret", fmt.Sprintf("id=secret%d,src=%s", i, filepath.Join(secretDir, fmt.Sprintf("secret%d", i))))
+		}
+		args = append(args, ".")
+		if err := runCommand(ctx, workdir, "docker", args...); err != nil {
+			return "", fmt.Errorf("docker build: %w", err)
+		}
+	}
+
+	if !cfg.push {
+		postBuildLogLine(client, job.ID, "Step 3/4: skipping push (--no-push)")
+		postBuildLogLine(client, job.ID, "Step 4/4: done")
+		return imageName, nil
+	}
+
+	postBuildLogLine(client, job.ID, fmt.Sprintf("Step 3/4: pushing %s", imageName))
+	if err := runCommand(ctx, "", "docker", "push", imageName); err != nil {
+		return "", fmt.Errorf("docker push: %w", err)
+	}
+	postBuildLogLine(client, job.ID, "Step 4/4: done")
+	return imageName, nil
+}
+
+// writeBuildSecrets writes each secret value to its own 0600 file in a
+// fresh temp directory (outside workdir, so it's never part of the build
+// context) and returns the directory plus a cleanup func. Mirrors
+// build-worker's writeBuildSecrets so secrets built through this CLI get
+// the same BuildKit --secret handling as the standalone worker.
+func writeBuildSecrets(secrets []string) (string, func(), error) {
+	noop := func() {}
+	if len(secrets) == 0 {
+		return "", noop, nil
+	}
+	dir, err := os.MkdirTemp("", "build-secrets-")
+	if err != nil {
+		return "", noop, err
+	}
+	for i, secret := range secrets {
+		path := filepath.Join(dir, fmt.Sprintf("secret%d", i))
+		if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", noop, err
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+// cloneURLForJob fetches a short-lived clone token for job's installation
+// from the control plane (which exchanges it via the repo's Provider, so
+// this CLI never has to hold the installation's own credential) and embeds
+// it in an HTTPS clone URL. Falls back to an unauthenticated clone URL for
+// installation-less (public) repos.
+func cloneURLForJob(client apiClient, job buildWorkerJob) (string, error) {
+	if job.Installation == "" {
+		return fmt.Sprintf("https://github.com/%s.git", job.Repository), nil
+	}
+	body, err := client.postJSON(fmt.Sprintf("/v1/github/installations/%s/token", job.Installation), nil)
+	if err != nil {
+		return "", err
+	}
+	var decoded struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://x-access-token:%s@github.com/%s.git", decoded.Token, job.Repository), nil
+}
+
+// dockerLogin runs `docker login` against cfg.registry once at worker
+// startup, so pushes in performBuild don't each need their own credentials.
+func dockerLogin(cfg buildWorkerConfig) error {
+	cmd := exec.Command("docker", "login", cfg.registry, "-u", cfg.registryUser, "--password-stdin")
+	cmd.Stdin = strings.NewReader(cfg.registryPass)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// runCommand runs name(args...) in dir (the current directory if empty)
+// under ctx, streaming its stdout/stderr to this process's own (so
+// `builds worker` remains useful to watch directly) and, when ctx carries
+// a buildLogSink, mirroring it line-by-line to the job's remote log too.
+func runCommand(ctx context.Context, dir, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	if sink := buildLogSinkFromContext(ctx); sink != nil {
+		stdout = io.MultiWriter(stdout, sink)
+		stderr = io.MultiWriter(stderr, sink)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// shortSHA returns the first 12 characters of a commit SHA for use in an
+// image tag, or the whole string if it's already shorter (e.g. a branch
+// name used as a stand-in commit in tests/dev).
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// postBuildLogLine appends a single log line to jobID via the control
+// plane's companion POST .../logs endpoint, the same one a real builder
+// would stream output through. Failures are logged and swallowed since a
+// dropped log line shouldn't fail the build itself.
+func postBuildLogLine(client apiClient, jobID, line string) {
+	payload := map[string]any{"lines": []string{line}}
+	if _, err := client.postJSON(fmt.Sprintf("/v1/build-jobs/%s/logs", jobID), payload); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to post log line for %s: %v\n", jobID, err)
+	}
+}
+
+type buildLogSinkKey struct{}
+
+// withBuildLogSink attaches w to ctx so runCommand can pick it up and mirror
+// a subprocess's output into it, without threading a writer through every
+// runCommand call site individually.
+func withBuildLogSink(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, buildLogSinkKey{}, w)
+}
+
+func buildLogSinkFromContext(ctx context.Context) io.Writer {
+	w, _ := ctx.Value(buildLogSinkKey{}).(io.Writer)
+	return w
+}
+
+// buildLogWriter is an io.Writer that splits whatever it's given on "\n"
+// and forwards each complete line to the job's remote log via
+// postBuildLogLine, so `infrctl builds logs --follow` sees the build's
+// actual output instead of the fixed step announcements performBuild posts
+// directly. A trailing partial line is buffered until the next Write
+// completes it.
+type buildLogWriter struct {
+	client  apiClient
+	jobID   string
+	mu      sync.Mutex
+	partial string
+}
+
+func newBuildLogWriter(client apiClient, jobID string) *buildLogWriter {
+	return &buildLogWriter{client: client, jobID: jobID}
+}
+
+func (w *buildLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.partial += string(p)
+	lines := strings.Split(w.partial, "\n")
+	w.partial = lines[len(lines)-1]
+	complete := lines[:len(lines)-1]
+	w.mu.Unlock()
+
+	for _, line := range complete {
+		if line != "" {
+			postBuildLogLine(w.client, w.jobID, line)
+		}
+	}
+	return len(p), nil
+}
+
+// followBuildLogs drives `builds logs --follow`: opens the job's SSE log
+// stream starting after since and prints each line as it arrives, in the
+// spirit of Woodpecker/Drone's line-writer log views. Returns once the
+// server closes the connection, which it does as soon as the job reaches
+// a terminal status.
+func followBuildLogs(client apiClient, id string, since int) {
+	stream, err := client.getStream(fmt.Sprintf("/v1/build-jobs/%s/logs?follow=true&since=%d", id, since))
+	if err != nil {
+		exitWithError(err)
+	}
+	defer stream.Close()
+
+	reader := bufio.NewReader(stream)
+	for {
+		event, err := readSSE(reader)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "stream error: %v\n", err)
+			}
+			return
+		}
+		if event.Type != "log" {
+			continue
+		}
+		var payload struct {
+			Lines []string `json:"lines"`
+		}
+		if err := json.Unmarshal([]byte(event.Data), &payload); err != nil {
+			continue
+		}
+		for _, line := range payload.Lines {
+			printLogLine(line)
+		}
+	}
+}
+
+// printLogLine renders one build log line with an ANSI color keyed off
+// its step-prefix convention (see performBuild), so a scrolling follow
+// reads like Woodpecker/Drone's step-colored log view.
+func printLogLine(line string) {
+	const (
+		colorRed   = "\033[31m"
+		colorCyan  = "\033[36m"
+		colorGreen = "\033[32m"
+		colorReset = "\033[0m"
+	)
+	color := colorReset
+	switch {
+	case strings.Contains(strings.ToLower(line), "error"):
+		color = colorRed
+	case strings.HasPrefix(strings.TrimSpace(line), "Step"):
+		color = colorCyan
+	case strings.Contains(strings.ToLower(line), "done") || strings.Contains(strings.ToLower(line), "succeeded"):
+		color = colorGreen
+	}
+	fmt.Printf("%s%s%s\n", color, line, colorReset)
+}
+
+// sseEvent is one frame read off a text/event-stream response: its
+// "event:" type and the "data:" payload (joined back together if the
+// server split it across multiple data: lines, per the SSE spec).
+type sseEvent struct {
+	Type string
+	Data string
+}
+
+// readSSE reads the next frame from r, a bufio.Reader over an SSE
+// response body, returning io.EOF once the stream closes. Comment lines
+// (keep-alives, starting with ":") are skipped.
+func readSSE(r *bufio.Reader) (sseEvent, error) {
+	var event sseEvent
+	var data []string
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.Type = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		case line == "" && (event.Type != "" || len(data) > 0):
+			event.Data = strings.Join(data, "\n")
+			return event, nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				return sseEvent{}, io.EOF
+			}
+			return sseEvent{}, err
+		}
 	}
 }
 
@@ -605,7 +1826,10 @@ func printGitHubUsage() {
 	fmt.Println("  infrctl github repos")
 	fmt.Println("  infrctl github register --repo owner/name [--branch main] [--compose docker-compose.yml] [--installation <id>] [--service <service-id>] [--env production]")
 	fmt.Println("  infrctl github installations")
-	fmt.Println("  infrctl github installations register --account org --external-id 12345 [--secret <value>]")
+	fmt.Println("  infrctl github installations register --account org --external-id 12345 [--secret <value>] [--app-id <id> --pem <path>]")
+	fmt.Println("  infrctl github installations refresh --id <installation-id>")
+	fmt.Println("  infrctl github installations token --id <installation-id>")
+	fmt.Println("  infrctl github installations delete --id <installation-id>")
 }
 
 func exitWithError(err error) {
@@ -0,0 +1,57 @@
+package api
+
+import "sync"
+
+// buildJobEvent is one status transition or log append, published to
+// whoever is watching a build job's /events stream.
+type buildJobEvent struct {
+	Type   string   `json:"type"` // "status" or "log"
+	Status string   `json:"status,omitempty"`
+	Lines  []string `json:"lines,omitempty"`
+}
+
+// buildJobEvents fans status transitions and log appends out to SSE
+// subscribers of a single build job. Subscriptions are keyed by job ID so
+// fan-out cost stays proportional to jobs with an open connection, not
+// the whole queue.
+type buildJobEvents struct {
+	mu   sync.Mutex
+	subs map[string]map[chan buildJobEvent]struct{}
+}
+
+func newBuildJobEvents() *buildJobEvents {
+	return &buildJobEvents{subs: make(map[string]map[chan buildJobEvent]struct{})}
+}
+
+// subscribe registers a channel for jobID's events. Callers must invoke
+// cancel when done to avoid leaking the channel and its goroutine's slot.
+func (b *buildJobEvents) subscribe(jobID string) (ch chan buildJobEvent, cancel func()) {
+	ch = make(chan buildJobEvent, 16)
+	b.mu.Lock()
+	if b.subs[jobID] == nil {
+		b.subs[jobID] = make(map[chan buildJobEvent]struct{})
+	}
+	b.subs[jobID][ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs[jobID], ch)
+		if len(b.subs[jobID]) == 0 {
+			delete(b.subs, jobID)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// publish delivers event to every subscriber of jobID. Slow or gone
+// subscribers are dropped rather than blocking the caller.
+func (b *buildJobEvents) publish(jobID string, event buildJobEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[jobID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
+)
+
+// ciSkipDirective matches the Drone/Woodpecker "[ci skip]" / "[skip ci]"
+// convention, case-insensitively and tolerant of extra spacing.
+var ciSkipDirective = regexp.MustCompile(`(?i)\[(?:ci *skip|skip *ci)\]`)
+
+// deployEnvDirective overrides a job's Environment, e.g. "[deploy:staging]".
+var deployEnvDirective = regexp.MustCompile(`(?i)\[deploy:([^\]]+)\]`)
+
+// composePathDirective overrides a job's ComposePath, e.g.
+// "[compose:services/api/docker-compose.yml]".
+var composePathDirective = regexp.MustCompile(`(?i)\[compose:([^\]]+)\]`)
+
+// applyCommitDirectives scans message - a push's commit message, or a
+// pull/merge request's title - for build directives and applies them to
+// job, recording each one it finds on job.Directives for auditability.
+// Reports whether message asked for the build to be skipped entirely
+// ("[ci skip]"/"[skip ci]"), in which case the caller should not enqueue
+// job at all.
+func applyCommitDirectives(job *models.BuildJob, message string) (skip bool) {
+	if message == "" {
+		return false
+	}
+	if ciSkipDirective.MatchString(message) {
+		return true
+	}
+	if m := deployEnvDirective.FindStringSubmatch(message); m != nil {
+		job.Environment = strings.TrimSpace(m[1])
+		job.Directives = append(job.Directives, "deploy:"+job.Environment)
+	}
+	if m := composePathDirective.FindStringSubmatch(message); m != nil {
+		job.ComposePath = strings.TrimSpace(m[1])
+		job.Directives = append(job.Directives, "compose:"+job.ComposePath)
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/store"
+)
+
+// defaultIdempotencyTTL is how long a cached POST/PUT/PATCH response is
+// replayed for before its key is treated as unused again.
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyKeys serializes concurrent requests that share the same
+// idempotency key: the first one through runs the handler, the rest block
+// until it has either populated the store record or failed outright.
+type idempotencyKeys struct {
+	mu    sync.Mutex
+	inUse map[string]*sync.Mutex
+}
+
+func newIdempotencyKeys() *idempotencyKeys {
+	return &idempotencyKeys{inUse: make(map[string]*sync.Mutex)}
+}
+
+// lock blocks until key is free, then claims it, returning a func that
+// releases it. Callers must call the returned func exactly once.
+func (k *idempotencyKeys) lock(key string) func() {
+	k.mu.Lock()
+	m, ok := k.inUse[key]
+	if !ok {
+		m = &sync.Mutex{}
+		k.inUse[key] = m
+	}
+	k.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		k.mu.Lock()
+		delete(k.inUse, key)
+		k.mu.Unlock()
+		m.Unlock()
+	}
+}
+
+// withIdempotency caches POST/PUT/PATCH responses under a caller-supplied
+// Idempotency-Key header - or, on a provider's webhook route, its own
+// delivery ID header - so a retried request with the same key
+// replays the original response instead of repeating its side effects.
+// This is what keeps GitHub redelivering a webhook from creating a
+// duplicate BuildJob, and lets a worker safely retry a PATCH
+// /v1/build-jobs/{id} whose response it never saw. Requests without a key
+// always run; a key reused with a different body (or a different
+// Authorization header) gets a 409 instead of the cached response.
+func (s *Server) withIdempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			switch r.URL.Path {
+			case "/v1/github/webhook":
+				key = r.Header.Get("X-GitHub-Delivery")
+			case "/v1/gitea/webhook":
+				key = r.Header.Get("X-Gitea-Delivery")
+			case "/v1/gitlab/webhook":
+				key = r.Header.Get("X-Gitlab-Event-UUID")
+			case "/v1/bitbucket/webhook":
+				key = r.Header.Get("X-Request-UUID")
+			}
+		}
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := requestFingerprint(r.Header.Get("Authorization"), body)
+
+		release := s.idempotencyKeys.lock(key)
+		defer release()
+
+		if rec, err := s.store.GetIdempotencyRecord(key); err == nil {
+			if rec.RequestSHA256 != requestHash {
+				retryAfter := int(time.Until(rec.ExpiresAt).Seconds())
+				if retryAfter < 0 {
+					retryAfter = 0
+				}
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+				s.problem(w, r, http.StatusConflict, "idempotency key already used for a different request")
+				return
+			}
+			if rec.ContentType != "" {
+				w.Header().Set("Content-Type", rec.ContentType)
+			}
+			w.WriteHeader(rec.Status)
+			_, _ = w.Write([]byte(rec.ResponseBody))
+			return
+		} else if !errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		now := time.Now().UTC()
+		err = s.store.SaveIdempotencyRecord(&models.IdempotencyRecord{
+			Key:                key,
+			Method:             r.Method,
+			Path:               r.URL.Path,
+			RequestSHA256:      requestHash,
+			Status:             rec.status,
+			ResponseBody:       rec.body.String(),
+			ResponseBodySHA256: sha256Hex(rec.body.Bytes()),
+			ContentType:        rec.Header().Get("Content-Type"),
+			CreatedAt:          now,
+			ExpiresAt:          now.Add(defaultIdempotencyTTL),
+		})
+		if err != nil {
+			log.Printf("[idempotency] failed to save record for key %s: %v", key, err)
+		}
+	})
+}
+
+// idempotencyRecorder tees a handler's response into a buffer, alongside
+// writing it straight through to the real client, so it can be cached once
+// the handler returns.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// requestFingerprint hashes a request body together with its Authorization
+// header, so that replaying a cached response requires presenting the same
+// credential (or lack of one) the original request did, not just guessing
+// its idempotency key.
+func requestFingerprint(authHeader string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(authHeader))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// problemBody is an RFC 7807 application/problem+json error response.
+// Type is left as the RFC's "about:blank" default (omitted) since none of
+// the control plane's errors have a documented URI yet; Title is the
+// fixed, status-derived summary, Detail the request-specific explanation.
+type problemBody struct {
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// TraceID lets a client hand back a single value when reporting an
+	// issue instead of pasting the whole response.
+	TraceID string `json:"trace_id"`
+}
+
+// problem writes an RFC 7807 application/problem+json error response,
+// replacing the ad-hoc `{"error":"..."}` strings handlers used to build by
+// hand with fmt.Sprintf - which broke whenever detail contained a quote.
+func (s *Server) problem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problemBody{
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		TraceID:  newID(),
+	})
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
+)
+
+// compiledPushFilter is a models.PushFilter with every glob pre-compiled
+// to a regexp, so a malformed pattern is rejected once at the repository
+// admin API rather than silently never matching on every push thereafter.
+type compiledPushFilter struct {
+	allowBranches []*regexp.Regexp
+	denyBranches  []*regexp.Regexp
+	allowTags     []*regexp.Regexp
+	ignorePaths   []*regexp.Regexp
+}
+
+// compilePushFilter compiles every glob in filter and returns a
+// compiledPushFilter ready to evaluate. It reports an error naming the
+// first invalid pattern.
+func compilePushFilter(filter *models.PushFilter) (*compiledPushFilter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	var err error
+	compiled := &compiledPushFilter{}
+	if compiled.allowBranches, err = compileGlobs(filter.AllowBranches); err != nil {
+		return nil, err
+	}
+	if compiled.denyBranches, err = compileGlobs(filter.DenyBranches); err != nil {
+		return nil, err
+	}
+	if compiled.allowTags, err = compileGlobs(filter.AllowTags); err != nil {
+		return nil, err
+	}
+	if compiled.ignorePaths, err = compileGlobs(filter.IgnorePaths); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		re, err := compileGlob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// compileGlob turns a shell-style glob into an anchored regexp. "**"
+// matches any sequence including "/" (so "docs/**" reaches nested
+// files); a single "*" stops at "/"; "?" matches one character other
+// than "/". There's no vendored doublestar-style glob library in this
+// tree, so this is the minimal hand-rolled equivalent the paths-changed
+// and branch/tag filters need.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// matchAny reports whether name matches any of patterns.
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluatePush decides whether a push to ref (with changedPaths, if the
+// provider reported any) should be built. When it returns a non-empty
+// reason the caller must not enqueue a build job and should surface the
+// reason instead.
+func (f *compiledPushFilter) evaluatePush(ref string, changedPaths []string) (reason string) {
+	if f == nil {
+		return ""
+	}
+	if strings.HasPrefix(ref, "refs/tags/") {
+		tag := strings.TrimPrefix(ref, "refs/tags/")
+		if len(f.allowTags) > 0 && !matchAny(f.allowTags, tag) {
+			return fmt.Sprintf("tag %q not in allowed tags", tag)
+		}
+	} else {
+		branch := normalizeGitRef(ref)
+		if len(f.denyBranches) > 0 && matchAny(f.denyBranches, branch) {
+			return fmt.Sprintf("branch %q denied by push filter", branch)
+		}
+		if len(f.allowBranches) > 0 && !matchAny(f.allowBranches, branch) {
+			return fmt.Sprintf("branch %q not in allowed branches", branch)
+		}
+	}
+
+	if len(f.ignorePaths) > 0 && len(changedPaths) > 0 {
+		allIgnored := true
+		for _, changed := range changedPaths {
+			if !matchAny(f.ignorePaths, changed) {
+				allIgnored = false
+				break
+			}
+		}
+		if allIgnored {
+			return "all changed paths match ignore_paths"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,36 @@
+package api
+
+import "testing"
+
+func TestCompileGlobMatch(t *testing.T) {
+	cases := []struct {
+		name  string
+		glob  string
+		input string
+		want  bool
+	}{
+		{"exact match", "main", "main", true},
+		{"exact mismatch", "main", "develop", false},
+		{"single star stops at slash", "services/*", "services/api", true},
+		{"single star does not cross slash", "services/*", "services/api/main.go", false},
+		{"doublestar crosses slashes", "docs/**", "docs/guides/intro.md", true},
+		{"doublestar requires prefix", "docs/**", "other/docs/intro.md", false},
+		{"question mark matches one char", "v?.0", "v1.0", true},
+		{"question mark does not match slash", "v?.0", "v/.0", false},
+		{"question mark does not match two chars", "v?.0", "v10.0", false},
+		{"literal dots are escaped, not wildcards", "v1.0", "v1x0", false},
+		{"prefix is not a suffix match", "services/api", "services/api-gateway", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			re, err := compileGlob(tc.glob)
+			if err != nil {
+				t.Fatalf("compileGlob(%q) returned error: %v", tc.glob, err)
+			}
+			if got := re.MatchString(tc.input); got != tc.want {
+				t.Errorf("compileGlob(%q).MatchString(%q) = %v, want %v", tc.glob, tc.input, got, tc.want)
+			}
+		})
+	}
+}
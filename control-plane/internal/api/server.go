@@ -1,9 +1,7 @@
 package api
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,54 +14,145 @@ import (
 	"time"
 
 	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/objectstore"
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/providers"
 	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/store"
 )
 
+// defaultPreviewTTL is how long a closed PR's preview environment sticks
+// around before the sweeper reaps it, when neither Config.PreviewTTL nor
+// the owning Installation's PreviewTTL says otherwise.
+const defaultPreviewTTL = 7 * 24 * time.Hour
+
+// defaultPreviewSweepInterval is how often StartPreviewSweeper checks for
+// expired preview environments.
+const defaultPreviewSweepInterval = 10 * time.Minute
+
 // Server exposes HTTP handlers for the control plane API.
 type Server struct {
-	store      *store.Store
-	apiToken   string
-	leResolver string
+	store           store.Store
+	apiToken        string
+	leResolver      string
+	providers       *providers.Registry
+	previewBase     string
+	previewTTL      time.Duration
+	version         *configVersion
+	objectStore     *objectstore.Client
+	buildQueue      *configVersion
+	buildEvents     *buildJobEvents
+	idempotencyKeys *idempotencyKeys
+	webhookQueue    *webhookQueue
 }
 
 // Config defines initialization values for Server.
 type Config struct {
-	Store      *store.Store
+	Store      store.Store
 	APIToken   string
 	LEResolver string
+
+	// GitHubAppID and GitHubAppPrivateKey enable installation token
+	// exchange so the webhook receiver can read repo contents (the
+	// compose file) at an exact commit. Leave GitHubAppPrivateKey empty
+	// to disable the feature; GitHub webhooks are still received either
+	// way.
+	GitHubAppID         string
+	GitHubAppPrivateKey []byte
+	// GitLabBaseURL and GiteaBaseURL point at the GitLab/Gitea instance
+	// API base, e.g. "https://gitlab.com" or a self-managed Gitea's
+	// "https://git.example.com". GitLabBaseURL defaults to the public
+	// gitlab.com when empty; GiteaBaseURL has no such default, so leaving
+	// it empty disables that provider's ListRepos/RegisterWebhook calls
+	// (its webhook receiver still works, since that never calls out).
+	GitLabBaseURL string
+	GiteaBaseURL  string
+	// PreviewBaseDomain is the root domain PR preview hostnames are cut
+	// from, e.g. "pr-12.myservice.<PreviewBaseDomain>". Leave
+	// empty to skip materializing preview domains. An Installation with
+	// its own PreviewBaseDomain set overrides this per-repo.
+	PreviewBaseDomain string
+	// PreviewTTL is how long a closed PR's preview environment survives
+	// before StartPreviewSweeper reaps it. Zero uses defaultPreviewTTL.
+	// An Installation with its own PreviewTTL set overrides this per-repo.
+	PreviewTTL time.Duration
+	// Storage configures the S3-compatible bucket build artifacts are
+	// presigned against. Leave Storage.Endpoint empty to disable the
+	// /v1/build-jobs/{id}/artifacts endpoint.
+	Storage objectstore.Config
 }
 
 // New constructs a Server.
 func New(cfg Config) *Server {
-	return &Server{
-		store:      cfg.Store,
-		apiToken:   cfg.APIToken,
-		leResolver: cfg.LEResolver,
-	}
+	githubProvider, err := providers.NewGitHubProvider(cfg.GitHubAppID, cfg.GitHubAppPrivateKey)
+	if err != nil {
+		log.Printf("[webhook] github app disabled: %v", err)
+		githubProvider, _ = providers.NewGitHubProvider("", nil)
+	}
+	gitlabBase := cfg.GitLabBaseURL
+	if gitlabBase == "" {
+		gitlabBase = "https://gitlab.com"
+	}
+	registry := providers.NewRegistry(
+		githubProvider,
+		providers.NewGitLabProvider(gitlabBase),
+		providers.NewGiteaProvider(cfg.GiteaBaseURL),
+		providers.NewBitbucketProvider(),
+	)
+
+	objectStore, ok := objectstore.New(cfg.Storage)
+	if !ok {
+		log.Printf("[artifacts] object storage disabled: no storage endpoint configured")
+	}
+	previewTTL := cfg.PreviewTTL
+	if previewTTL <= 0 {
+		previewTTL = defaultPreviewTTL
+	}
+	s := &Server{
+		store:           cfg.Store,
+		apiToken:        cfg.APIToken,
+		leResolver:      cfg.LEResolver,
+		providers:       registry,
+		previewBase:     cfg.PreviewBaseDomain,
+		previewTTL:      previewTTL,
+		version:         newConfigVersion(),
+		objectStore:     objectStore,
+		buildQueue:      newConfigVersion(),
+		buildEvents:     newBuildJobEvents(),
+		idempotencyKeys: newIdempotencyKeys(),
+	}
+	s.webhookQueue = newWebhookQueue(defaultWebhookQueueWorkers, s.processWebhookTask)
+	return s
 }
 
 // Handler returns the HTTP handler for muxing routes.
 func (s *Server) Handler() http.Handler {
+	var si ServerInterface = s
 	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", s.handleHealth)
-	mux.HandleFunc("/v1/projects", s.requireAuth(s.handleProjects))
-	mux.HandleFunc("/v1/projects/", s.requireAuth(s.handleProjectSubroutes))
-	mux.HandleFunc("/v1/services/", s.requireAuth(s.handleServiceSubroutes))
-	mux.HandleFunc("/v1/github/repos", s.requireAuth(s.handleRepositories))
-	mux.HandleFunc("/v1/github/installations", s.requireAuth(s.handleInstallations))
-	mux.HandleFunc("/v1/github/webhook", s.handleGitHubWebhook)
-	mux.HandleFunc("/v1/service-compose/", s.requireAuth(s.handleServiceCompose))
-	mux.HandleFunc("/v1/state/services", s.requireAuth(s.handleServiceState))
-	mux.HandleFunc("/v1/build-jobs/claim", s.requireAuth(s.handleBuildJobClaim))
-	mux.HandleFunc("/v1/build-jobs", s.requireAuth(s.handleBuildJobs))
-	mux.HandleFunc("/v1/build-jobs/", s.requireAuth(s.handleBuildJob))
-	mux.HandleFunc("/v1/traefik/config", s.requireAuth(s.handleTraefikConfig))
-	return s.withJSON(mux)
+	mux.HandleFunc("/healthz", si.Health)
+	mux.HandleFunc("/v1/projects", s.requireAuth(si.Projects))
+	mux.HandleFunc("/v1/projects/", s.requireAuth(si.ProjectSubroutes))
+	mux.HandleFunc("/v1/services/", s.requireAuth(si.ServiceSubroutes))
+	mux.HandleFunc("/v1/github/repos", s.requireAuth(si.Repositories))
+	mux.HandleFunc("/v1/github/repos/", s.requireAuth(si.RepositorySubroutes))
+	mux.HandleFunc("/v1/github/installations", s.requireAuth(si.Installations))
+	mux.HandleFunc("/v1/github/installations/", s.requireAuth(si.InstallationSubroutes))
+	mux.HandleFunc("/v1/github/webhook", s.handleProviderWebhook("github"))
+	mux.HandleFunc("/v1/gitlab/webhook", s.handleProviderWebhook("gitlab"))
+	mux.HandleFunc("/v1/gitea/webhook", s.handleProviderWebhook("gitea"))
+	mux.HandleFunc("/v1/bitbucket/webhook", s.handleProviderWebhook("bitbucket"))
+	mux.HandleFunc("/v1/service-compose/", s.requireAuth(si.ServiceCompose))
+	mux.HandleFunc("/v1/service-routing/", s.requireAuth(si.ServiceRouting))
+	mux.HandleFunc("/v1/state/services", s.requireAuth(si.ServiceState))
+	mux.HandleFunc("/v1/build-jobs/claim", s.requireAuth(si.BuildJobClaim))
+	mux.HandleFunc("/v1/build-jobs", s.requireAuth(si.BuildJobs))
+	mux.HandleFunc("/v1/build-jobs/", s.requireAuth(si.BuildJob))
+	mux.HandleFunc("/v1/traefik/config", s.requireAuth(si.TraefikConfig))
+	mux.HandleFunc("/v1/events", s.requireAuth(si.Events))
+	return s.withJSON(s.withIdempotency(mux))
 }
 
 func (s *Server) withJSON(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.HasPrefix(r.URL.Path, "/v1/traefik/config") {
+		if !strings.HasPrefix(r.URL.Path, "/v1/traefik/config") && !strings.HasPrefix(r.URL.Path, "/v1/events") {
 			w.Header().Set("Content-Type", "application/json")
 		}
 		next.ServeHTTP(w, r)
@@ -79,7 +168,7 @@ func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 
 		auth := r.Header.Get("Authorization")
 		if auth != "Bearer "+s.apiToken {
-			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			s.problem(w, r, http.StatusUnauthorized, "unauthorized")
 			return
 		}
 		next(w, r)
@@ -98,14 +187,14 @@ func (s *Server) handleProjects(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		s.createProject(w, r)
 	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
 func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
 	projects, err := s.store.ListProjects()
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 	_ = json.NewEncoder(w).Encode(map[string]any{"projects": projects})
@@ -117,11 +206,11 @@ func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 		Slug string `json:"slug"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		s.problem(w, r, http.StatusBadRequest, "invalid json")
 		return
 	}
 	if payload.Name == "" {
-		http.Error(w, `{"error":"name required"}`, http.StatusBadRequest)
+		s.problem(w, r, http.StatusBadRequest, "name required")
 		return
 	}
 	if payload.Slug == "" {
@@ -135,7 +224,7 @@ func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.store.CreateProject(project); err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		s.problem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -157,7 +246,7 @@ func (s *Server) handleProjectSubroutes(w http.ResponseWriter, r *http.Request)
 		case http.MethodGet:
 			s.getProject(w, r, projectID)
 		default:
-			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 		}
 		return
 	}
@@ -174,16 +263,16 @@ func (s *Server) getProject(w http.ResponseWriter, r *http.Request, projectID st
 	project, err := s.store.GetProject(projectID)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			http.Error(w, `{"error":"project not found"}`, http.StatusNotFound)
+			s.problem(w, r, http.StatusNotFound, "project not found")
 			return
 		}
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
 	services, err := s.store.ListServicesByProject(projectID)
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
@@ -198,14 +287,14 @@ func (s *Server) handleProjectServices(w http.ResponseWriter, r *http.Request, p
 	case http.MethodGet:
 		services, err := s.store.ListServicesByProject(projectID)
 		if err != nil {
-			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 		_ = json.NewEncoder(w).Encode(map[string]any{"services": services})
 	case http.MethodPost:
 		s.createService(w, r, projectID)
 	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
@@ -214,26 +303,29 @@ func (s *Server) handleRepositories(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		repos, err := s.store.ListRepositories()
 		if err != nil {
-			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 		_ = json.NewEncoder(w).Encode(map[string]any{"repositories": repos})
 	case http.MethodPost:
 		var payload struct {
+			Provider      string `json:"provider"`
 			Owner         string `json:"owner"`
 			Name          string `json:"name"`
 			DefaultBranch string `json:"default_branch"`
 			ComposePath   string `json:"compose_path"`
 			Installation  string `json:"installation_id"`
+			ServiceID     string `json:"service_id"`
+			Environment   string `json:"environment"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
 			return
 		}
 		payload.Owner = strings.TrimSpace(payload.Owner)
 		payload.Name = strings.TrimSpace(payload.Name)
 		if payload.Owner == "" || payload.Name == "" {
-			http.Error(w, `{"error":"owner and name required"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "owner and name required")
 			return
 		}
 		if payload.DefaultBranch == "" {
@@ -242,25 +334,199 @@ func (s *Server) handleRepositories(w http.ResponseWriter, r *http.Request) {
 		if payload.ComposePath == "" {
 			payload.ComposePath = "docker-compose.yml"
 		}
+		if payload.Provider == "" {
+			payload.Provider = "github"
+		}
 
 		repo := &models.Repository{
 			ID:            repositoryID(payload.Owner, payload.Name),
+			Provider:      payload.Provider,
 			Owner:         payload.Owner,
 			Name:          payload.Name,
 			DefaultBranch: payload.DefaultBranch,
-			ComposePath:   payload.ComposePath,
 			Installation:  payload.Installation,
 		}
+		if payload.ServiceID != "" {
+			if payload.Environment == "" {
+				payload.Environment = "production"
+			}
+			repo.Services = []models.RepositoryService{{
+				ServiceID:   payload.ServiceID,
+				ComposePath: payload.ComposePath,
+				Environment: payload.Environment,
+			}}
+		}
 
 		if err := s.store.UpsertRepository(repo); err != nil {
-			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(w).Encode(repo)
 	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleRepositorySubroutes dispatches "/v1/github/repos/{id}" and its
+// "push-filter" sub-resource, mirroring handleProjectSubroutes.
+func (s *Server) handleRepositorySubroutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/github/repos/")
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	repoID := parts[0]
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			repo, err := s.store.GetRepository(repoID)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					s.problem(w, r, http.StatusNotFound, "repository not found")
+					return
+				}
+				s.problem(w, r, http.StatusInternalServerError, "internal error")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(repo)
+		default:
+			s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	switch parts[1] {
+	case "push-filter":
+		s.handleRepositoryPushFilter(w, r, repoID)
+	case "services":
+		s.handleRepositoryServices(w, r, repoID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleRepositoryServices manages repo's Services list: the compose
+// stacks a push/PR build fans out to, each path-prefix-scoped for
+// monorepo support. GET lists them; POST appends or replaces (by
+// ServiceID) an entry; DELETE removes one by ?service_id=.
+func (s *Server) handleRepositoryServices(w http.ResponseWriter, r *http.Request, repoID string) {
+	repo, err := s.store.GetRepository(repoID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "repository not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]any{"services": repo.Services})
+	case http.MethodPost:
+		var rs models.RepositoryService
+		if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if rs.ServiceID == "" {
+			s.problem(w, r, http.StatusBadRequest, "service_id required")
+			return
+		}
+		if rs.ComposePath == "" {
+			rs.ComposePath = "docker-compose.yml"
+		}
+		if rs.Environment == "" {
+			rs.Environment = "production"
+		}
+		replaced := false
+		for i, existing := range repo.Services {
+			if existing.ServiceID == rs.ServiceID {
+				repo.Services[i] = rs
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			repo.Services = append(repo.Services, rs)
+		}
+		if err := s.store.UpsertRepository(repo); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to persist service")
+			return
+		}
+		if !replaced {
+			w.WriteHeader(http.StatusCreated)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"services": repo.Services})
+	case http.MethodDelete:
+		serviceID := r.URL.Query().Get("service_id")
+		if serviceID == "" {
+			s.problem(w, r, http.StatusBadRequest, "service_id query parameter required")
+			return
+		}
+		kept := repo.Services[:0]
+		for _, existing := range repo.Services {
+			if existing.ServiceID != serviceID {
+				kept = append(kept, existing)
+			}
+		}
+		repo.Services = kept
+		if err := s.store.UpsertRepository(repo); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to persist service removal")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleRepositoryPushFilter manages a repository's PushFilter: the
+// branch/tag/paths-changed trigger rules handlePushEvent evaluates before
+// enqueueing a BuildJob for a push.
+func (s *Server) handleRepositoryPushFilter(w http.ResponseWriter, r *http.Request, repoID string) {
+	repo, err := s.store.GetRepository(repoID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "repository not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]any{"push_filter": repo.PushFilter})
+	case http.MethodPut:
+		var filter models.PushFilter
+		if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if _, err := compilePushFilter(&filter); err != nil {
+			s.problem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		repo.PushFilter = &filter
+		if err := s.store.UpsertRepository(repo); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to persist push filter")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(repo.PushFilter)
+	case http.MethodDelete:
+		repo.PushFilter = nil
+		if err := s.store.UpsertRepository(repo); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to clear push filter")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
@@ -269,44 +535,250 @@ func (s *Server) handleInstallations(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		installations, err := s.store.ListInstallations()
 		if err != nil {
-			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
-		_ = json.NewEncoder(w).Encode(map[string]any{"installations": installations})
+		redacted := make([]*models.Installation, len(installations))
+		for i, inst := range installations {
+			redacted[i] = withoutInstallationSecrets(inst)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"installations": redacted})
 	case http.MethodPost:
 		var payload struct {
-			Account       string `json:"account"`
-			ExternalID    string `json:"external_id"`
-			WebhookSecret string `json:"webhook_secret"`
+			Provider          string `json:"provider"`
+			Account           string `json:"account"`
+			ExternalID        string `json:"external_id"`
+			WebhookSecret     string `json:"webhook_secret"`
+			AccessToken       string `json:"access_token"`
+			AppID             string `json:"app_id"`
+			AppPrivateKey     string `json:"app_private_key"`
+			PreviewBaseDomain string `json:"preview_base_domain"`
+			PreviewTTL        string `json:"preview_ttl"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
 			return
 		}
 		payload.Account = strings.TrimSpace(payload.Account)
 		payload.ExternalID = strings.TrimSpace(payload.ExternalID)
 		if payload.Account == "" || payload.ExternalID == "" {
-			http.Error(w, `{"error":"account and external_id required"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "account and external_id required")
 			return
 		}
+		if payload.Provider == "" {
+			payload.Provider = "github"
+		}
+		if payload.PreviewTTL != "" {
+			if _, err := time.ParseDuration(payload.PreviewTTL); err != nil {
+				s.problem(w, r, http.StatusBadRequest, "invalid preview_ttl: "+err.Error())
+				return
+			}
+		}
 
 		inst := &models.Installation{
-			ID:            installationID(payload.Account, payload.ExternalID),
-			Account:       payload.Account,
-			ExternalID:    payload.ExternalID,
-			WebhookSecret: payload.WebhookSecret,
+			ID:                installationID(payload.Account, payload.ExternalID),
+			Provider:          payload.Provider,
+			Account:           payload.Account,
+			ExternalID:        payload.ExternalID,
+			WebhookSecret:     payload.WebhookSecret,
+			AccessToken:       payload.AccessToken,
+			AppID:             payload.AppID,
+			AppPrivateKey:     payload.AppPrivateKey,
+			PreviewBaseDomain: payload.PreviewBaseDomain,
+			PreviewTTL:        payload.PreviewTTL,
 		}
 
 		if err := s.store.UpsertInstallation(inst); err != nil {
-			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(w).Encode(inst)
 	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleInstallationSubroutes dispatches "/v1/github/installations/{id}"
+// (GET/DELETE) and its "token"/"refresh" sub-resources, mirroring
+// handleRepositorySubroutes.
+func (s *Server) handleInstallationSubroutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/github/installations/")
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	installationID := parts[0]
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			inst, err := s.store.GetInstallation(installationID)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					s.problem(w, r, http.StatusNotFound, "installation not found")
+					return
+				}
+				s.problem(w, r, http.StatusInternalServerError, "internal error")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(withoutInstallationSecrets(inst))
+		case http.MethodDelete:
+			if err := s.store.DeleteInstallation(installationID); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					s.problem(w, r, http.StatusNotFound, "installation not found")
+					return
+				}
+				s.problem(w, r, http.StatusInternalServerError, "internal error")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	switch parts[1] {
+	case "token":
+		s.handleInstallationToken(w, r, installationID)
+	case "refresh":
+		s.handleInstallationRefresh(w, r, installationID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// installationProvider resolves the Provider an installation uses and the
+// credential seed IssueCloneToken/IssueInstallationToken expects for it:
+// GitHub exchanges its ExternalID (installation ID) for a token via its
+// App; every other provider has no app-level credential, so its stored
+// AccessToken is passed straight through.
+func (s *Server) installationProvider(inst *models.Installation) (providers.Provider, string, error) {
+	providerName := inst.Provider
+	if providerName == "" {
+		providerName = "github"
+	}
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return nil, "", fmt.Errorf("unknown provider: %s", providerName)
+	}
+	tokenSeed := inst.ExternalID
+	if providerName != "github" {
+		tokenSeed = inst.AccessToken
+	}
+	return provider, tokenSeed, nil
+}
+
+// handleInstallationToken exchanges an installation's long-lived credential
+// for a short-lived clone token. When the provider implements the richer
+// InstallationTokenIssuer capability (GitHub), the cached token's expiry
+// and the repositories it grants access to come back alongside it, so a
+// build worker can see everything it needs in one call; other providers
+// fall back to the plain IssueCloneToken and just return {"token": ...}.
+func (s *Server) handleInstallationToken(w http.ResponseWriter, r *http.Request, installationID string) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	inst, err := s.store.GetInstallation(installationID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "installation not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	provider, tokenSeed, err := s.installationProvider(inst)
+	if err != nil {
+		s.problem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if issuer, ok := provider.(providers.InstallationTokenIssuer); ok {
+		token, expiresAt, repos, err := issuer.IssueInstallationToken(r.Context(), tokenSeed, inst.AppID, []byte(inst.AppPrivateKey))
+		if err != nil {
+			s.problem(w, r, http.StatusBadGateway, "installation token exchange failed: "+err.Error())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"token":        token,
+			"expires_at":   expiresAt,
+			"repositories": repos,
+		})
+		return
+	}
+
+	token, err := provider.IssueCloneToken(r.Context(), tokenSeed)
+	if err != nil {
+		s.problem(w, r, http.StatusBadGateway, "clone token exchange failed: "+err.Error())
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"token": token})
+}
+
+// handleInstallationRefresh re-syncs the repositories an installation
+// grants access to: it mints a fresh installation token (or reuses a
+// cached one), lists repositories with it, and upserts each into the
+// repository store the same way handleInstallationEvent does for the
+// "installation"/"installation_repositories" webhooks, so repo discovery
+// doesn't depend on GitHub redelivering one of those events.
+func (s *Server) handleInstallationRefresh(w http.ResponseWriter, r *http.Request, installationID string) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	inst, err := s.store.GetInstallation(installationID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "installation not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	provider, tokenSeed, err := s.installationProvider(inst)
+	if err != nil {
+		s.problem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	issuer, ok := provider.(providers.InstallationTokenIssuer)
+	if !ok {
+		s.problem(w, r, http.StatusBadRequest, "provider does not support installation token refresh: "+provider.Name())
+		return
+	}
+	_, _, repos, err := issuer.IssueInstallationToken(r.Context(), tokenSeed, inst.AppID, []byte(inst.AppPrivateKey))
+	if err != nil {
+		s.problem(w, r, http.StatusBadGateway, "installation token exchange failed: "+err.Error())
+		return
+	}
+
+	for _, repo := range repos {
+		if repo.Owner == "" || repo.Name == "" {
+			continue
+		}
+		repoModel := &models.Repository{
+			ID:            repositoryID(repo.Owner, repo.Name),
+			Provider:      inst.Provider,
+			Owner:         repo.Owner,
+			Name:          repo.Name,
+			DefaultBranch: repo.DefaultBranch,
+			Installation:  inst.ExternalID,
+		}
+		if err := s.store.UpsertRepository(repoModel); err != nil {
+			log.Printf("[installations] failed to register repository %s/%s: %v", repo.Owner, repo.Name, err)
+		}
 	}
+
+	_ = json.NewEncoder(w).Encode(map[string]any{"repositories": repos})
 }
 
 func (s *Server) createService(w http.ResponseWriter, r *http.Request, projectID string) {
@@ -316,11 +788,11 @@ func (s *Server) createService(w http.ResponseWriter, r *http.Request, projectID
 		InternalPort int    `json:"internal_port"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		s.problem(w, r, http.StatusBadRequest, "invalid json")
 		return
 	}
 	if payload.Name == "" {
-		http.Error(w, `{"error":"name required"}`, http.StatusBadRequest)
+		s.problem(w, r, http.StatusBadRequest, "name required")
 		return
 	}
 	if payload.InternalPort == 0 {
@@ -338,12 +810,36 @@ func (s *Server) createService(w http.ResponseWriter, r *http.Request, projectID
 	}
 
 	if err := s.store.CreateService(service); err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusBadRequest)
+		s.problem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
+	s.version.bump()
 
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(service)
+	_ = json.NewEncoder(w).Encode(withoutSecrets(service))
+}
+
+// withoutSecrets returns a shallow copy of service with Secrets cleared, so
+// handlers that echo a service back to the caller never round-trip secret
+// values. Use handleServiceSecrets to manage them instead.
+func withoutSecrets(service *models.Service) *models.Service {
+	out := *service
+	out.Secrets = nil
+	return &out
+}
+
+// withoutInstallationSecrets returns a shallow copy of inst with
+// WebhookSecret, AccessToken, and AppPrivateKey cleared, so GET handlers
+// never hand out GitHub App impersonation capability (or another
+// provider's API token) to anyone who can call the API. Installations are
+// created with these values in a single POST and never need to be read
+// back afterward.
+func withoutInstallationSecrets(inst *models.Installation) *models.Installation {
+	out := *inst
+	out.WebhookSecret = ""
+	out.AccessToken = ""
+	out.AppPrivateKey = ""
+	return &out
 }
 
 func (s *Server) handleServiceSubroutes(w http.ResponseWriter, r *http.Request) {
@@ -360,7 +856,7 @@ func (s *Server) handleServiceSubroutes(w http.ResponseWriter, r *http.Request)
 		case http.MethodGet:
 			s.getService(w, r, serviceID)
 		default:
-			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 		}
 		return
 	}
@@ -369,12 +865,68 @@ func (s *Server) handleServiceSubroutes(w http.ResponseWriter, r *http.Request)
 	case "domains":
 		s.handleServiceDomains(w, r, serviceID)
 	case "deployments":
+		if len(parts) >= 4 {
+			switch parts[3] {
+			case "promote":
+				s.handleDeploymentPromote(w, r, serviceID, parts[2])
+			case "rollback":
+				s.handleDeploymentRollback(w, r, serviceID, parts[2])
+			default:
+				http.NotFound(w, r)
+			}
+			return
+		}
 		s.handleServiceDeployments(w, r, serviceID)
+	case "secrets":
+		s.handleServiceSecrets(w, r, serviceID)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
+// handleServiceSecrets manages build-time secrets for a service. Values are
+// write-only: GET returns only the configured secret names so a client can
+// tell what's set without ever reading a value back over the API. Values
+// are handed to a build worker at job-claim time and are the worker's
+// responsibility to redact from build output (see SecretRedactor).
+func (s *Server) handleServiceSecrets(w http.ResponseWriter, r *http.Request, serviceID string) {
+	service, err := s.store.GetService(serviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "service not found")
+		} else {
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		names := make([]string, 0, len(service.Secrets))
+		for name := range service.Secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		_ = json.NewEncoder(w).Encode(map[string]any{"names": names})
+	case http.MethodPut:
+		var payload struct {
+			Secrets map[string]string `json:"secrets"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		service.Secrets = payload.Secrets
+		if err := s.store.UpdateService(service); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to update")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
 func (s *Server) handleServiceCompose(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/v1/service-compose/")
 	parts := strings.Split(path, "/")
@@ -386,9 +938,9 @@ func (s *Server) handleServiceCompose(w http.ResponseWriter, r *http.Request) {
 	service, err := s.store.GetService(serviceID)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			http.Error(w, `{"error":"service not found"}`, http.StatusNotFound)
+			s.problem(w, r, http.StatusNotFound, "service not found")
 		} else {
-			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 		}
 		return
 	}
@@ -401,24 +953,86 @@ func (s *Server) handleServiceCompose(w http.ResponseWriter, r *http.Request) {
 			Compose string `json:"compose"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := applyCompose(service, payload.Compose); err != nil {
+			s.problem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := s.store.UpdateService(service); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to update")
+			return
+		}
+		s.version.bump()
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleServiceRouting manages the Traefik-facing routing options that
+// don't fit naturally under /domains or /service-compose: middleware
+// chains, sticky sessions, load balancer health checks, and raw TCP/UDP
+// passthrough. GET echoes the current configuration; PUT/POST replaces it
+// wholesale, same as handleServiceCompose.
+func (s *Server) handleServiceRouting(w http.ResponseWriter, r *http.Request) {
+	serviceID := strings.TrimPrefix(r.URL.Path, "/v1/service-routing/")
+	if serviceID == "" {
+		http.NotFound(w, r)
+		return
+	}
+	service, err := s.store.GetService(serviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "service not found")
+		} else {
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"middlewares":     service.Middlewares,
+			"sticky_sessions": service.StickySessions,
+			"health_check":    service.HealthCheck,
+			"tcp_route":       service.TCPRoute,
+			"udp_route":       service.UDPRoute,
+		})
+	case http.MethodPut, http.MethodPost:
+		var payload struct {
+			Middlewares    []models.Middleware        `json:"middlewares"`
+			StickySessions bool                       `json:"sticky_sessions"`
+			HealthCheck    *models.ServiceHealthCheck `json:"health_check"`
+			TCPRoute       *models.TCPRoute           `json:"tcp_route"`
+			UDPRoute       *models.UDPRoute           `json:"udp_route"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
 			return
 		}
-		service.Compose = payload.Compose
+		service.Middlewares = payload.Middlewares
+		service.StickySessions = payload.StickySessions
+		service.HealthCheck = payload.HealthCheck
+		service.TCPRoute = payload.TCPRoute
+		service.UDPRoute = payload.UDPRoute
 		if err := s.store.UpdateService(service); err != nil {
-			http.Error(w, `{"error":"failed to update"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "failed to update")
 			return
 		}
+		s.version.bump()
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
 func (s *Server) handleServiceState(w http.ResponseWriter, r *http.Request) {
 	projects, err := s.store.ListProjects()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
@@ -435,7 +1049,7 @@ func (s *Server) handleServiceState(w http.ResponseWriter, r *http.Request) {
 	for _, project := range projects {
 		list, err := s.store.ListServicesByProject(project.ID)
 		if err != nil {
-			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 		for _, svc := range list {
@@ -457,23 +1071,23 @@ func (s *Server) getService(w http.ResponseWriter, r *http.Request, serviceID st
 	service, err := s.store.GetService(serviceID)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			http.Error(w, `{"error":"service not found"}`, http.StatusNotFound)
+			s.problem(w, r, http.StatusNotFound, "service not found")
 			return
 		}
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
-	_ = json.NewEncoder(w).Encode(service)
+	_ = json.NewEncoder(w).Encode(withoutSecrets(service))
 }
 
 func (s *Server) handleServiceDomains(w http.ResponseWriter, r *http.Request, serviceID string) {
 	service, err := s.store.GetService(serviceID)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			http.Error(w, `{"error":"service not found"}`, http.StatusNotFound)
+			s.problem(w, r, http.StatusNotFound, "service not found")
 			return
 		}
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
@@ -482,70 +1096,92 @@ func (s *Server) handleServiceDomains(w http.ResponseWriter, r *http.Request, se
 		_ = json.NewEncoder(w).Encode(map[string]any{"domains": service.Domains})
 	case http.MethodPost:
 		var payload struct {
-			Environment string `json:"environment"`
-			Hostname    string `json:"hostname"`
+			Environment  string   `json:"environment"`
+			Hostname     string   `json:"hostname"`
+			CertResolver string   `json:"cert_resolver"`
+			Middlewares  []string `json:"middlewares"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
 			return
 		}
 		if payload.Environment == "" {
 			payload.Environment = "production"
 		}
 		if payload.Hostname == "" {
-			http.Error(w, `{"error":"hostname required"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "hostname required")
 			return
 		}
 
 		domain := models.Domain{
-			ID:          newID(),
-			ServiceID:   serviceID,
-			Environment: payload.Environment,
-			Hostname:    payload.Hostname,
-			CreatedAt:   time.Now().UTC(),
+			ID:           newID(),
+			ServiceID:    serviceID,
+			Environment:  payload.Environment,
+			Hostname:     payload.Hostname,
+			CertResolver: payload.CertResolver,
+			Middlewares:  payload.Middlewares,
+			CreatedAt:    time.Now().UTC(),
 		}
 
 		service.Domains = append(service.Domains, domain)
 		if err := s.store.UpdateService(service); err != nil {
-			http.Error(w, `{"error":"failed to persist domain"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "failed to persist domain")
 			return
 		}
+		s.version.bump()
 
 		w.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(w).Encode(domain)
 	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
+// maxDeploymentHistory bounds how many deployments handleServiceDeployments
+// keeps per environment, so a service redeployed thousands of times
+// doesn't grow its record without bound. Rollback only ever needs the
+// immediately preceding superseded deployment, so trimming the oldest
+// entries first is safe.
+const maxDeploymentHistory = 20
+
 func (s *Server) handleServiceDeployments(w http.ResponseWriter, r *http.Request, serviceID string) {
 	service, err := s.store.GetService(serviceID)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			http.Error(w, `{"error":"service not found"}`, http.StatusNotFound)
+			s.problem(w, r, http.StatusNotFound, "service not found")
 			return
 		}
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
 	switch r.Method {
 	case http.MethodGet:
-		_ = json.NewEncoder(w).Encode(map[string]any{"deployments": service.Deployments})
+		deployments := service.Deployments
+		if env := r.URL.Query().Get("environment"); env != "" {
+			filtered := make([]models.Deployment, 0, len(deployments))
+			for _, d := range deployments {
+				if d.Environment == env {
+					filtered = append(filtered, d)
+				}
+			}
+			deployments = filtered
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"deployments": deployments})
 	case http.MethodPost:
 		var payload struct {
 			Environment string `json:"environment"`
 			Image       string `json:"image"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
 			return
 		}
 		if payload.Environment == "" {
 			payload.Environment = "production"
 		}
 		if payload.Image == "" {
-			http.Error(w, `{"error":"image required"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "image required")
 			return
 		}
 
@@ -554,38 +1190,183 @@ func (s *Server) handleServiceDeployments(w http.ResponseWriter, r *http.Request
 			ServiceID:   serviceID,
 			Environment: payload.Environment,
 			Image:       payload.Image,
+			Status:      "pending",
 			CreatedAt:   time.Now().UTC(),
 		}
+		service.Deployments = append(service.Deployments, deployment)
+		service.Deployments = trimDeploymentHistory(service.Deployments, payload.Environment, maxDeploymentHistory)
 
-		replaced := false
-		for idx, d := range service.Deployments {
-			if d.Environment == payload.Environment {
-				service.Deployments[idx] = deployment
-				replaced = true
-				break
-			}
+		if err := s.store.UpdateService(service); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to persist deployment")
+			return
 		}
-		if !replaced {
-			service.Deployments = append(service.Deployments, deployment)
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(deployment)
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// trimDeploymentHistory drops the oldest deployments in environment once
+// there are more than limit, leaving other environments' history alone.
+func trimDeploymentHistory(deployments []models.Deployment, environment string, limit int) []models.Deployment {
+	count := 0
+	for _, d := range deployments {
+		if d.Environment == environment {
+			count++
+		}
+	}
+	if count <= limit {
+		return deployments
+	}
+	drop := count - limit
+	out := make([]models.Deployment, 0, len(deployments)-drop)
+	for _, d := range deployments {
+		if d.Environment == environment && drop > 0 {
+			drop--
+			continue
 		}
+		out = append(out, d)
+	}
+	return out
+}
 
-		service.Image = payload.Image
-		if err := s.store.UpdateService(service); err != nil {
-			http.Error(w, `{"error":"failed to persist deployment"}`, http.StatusInternalServerError)
+// handleDeploymentPromote flips traffic to depID's image: it marks any
+// currently-healthy deployment in the same environment "superseded",
+// marks depID "healthy", and updates Service.Image so the next Traefik
+// render and agent reconcile pick it up. Callers are expected to have
+// already run whatever health check they need - this endpoint is the
+// "flip" step, not the prober.
+func (s *Server) handleDeploymentPromote(w http.ResponseWriter, r *http.Request, serviceID, depID string) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	service, err := s.store.GetService(serviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "service not found")
 			return
 		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
 
-		w.WriteHeader(http.StatusCreated)
-		_ = json.NewEncoder(w).Encode(deployment)
-	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+	idx := deploymentIndex(service.Deployments, depID)
+	if idx < 0 {
+		s.problem(w, r, http.StatusNotFound, "deployment not found")
+		return
+	}
+	target := service.Deployments[idx]
+
+	now := time.Now().UTC()
+	for i := range service.Deployments {
+		d := &service.Deployments[i]
+		if d.ID == target.ID {
+			continue
+		}
+		if d.Environment == target.Environment && d.Status == "healthy" {
+			d.Status = "superseded"
+		}
+	}
+	service.Deployments[idx].Status = "healthy"
+	service.Deployments[idx].PromotedAt = now
+	service.Image = target.Image
+
+	if err := s.store.UpdateService(service); err != nil {
+		s.problem(w, r, http.StatusInternalServerError, "failed to promote deployment")
+		return
 	}
+	s.version.bump()
+
+	_ = json.NewEncoder(w).Encode(service.Deployments[idx])
+}
+
+// handleDeploymentRollback restores the image of the most recently
+// superseded deployment in depID's environment, marking depID
+// "rolled_back" and the restored deployment "healthy" again.
+func (s *Server) handleDeploymentRollback(w http.ResponseWriter, r *http.Request, serviceID, depID string) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	service, err := s.store.GetService(serviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "service not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	idx := deploymentIndex(service.Deployments, depID)
+	if idx < 0 {
+		s.problem(w, r, http.StatusNotFound, "deployment not found")
+		return
+	}
+	current := service.Deployments[idx]
+
+	restoreIdx := -1
+	for i := len(service.Deployments) - 1; i >= 0; i-- {
+		d := service.Deployments[i]
+		if d.ID == current.ID {
+			continue
+		}
+		if d.Environment == current.Environment && d.Status == "superseded" {
+			restoreIdx = i
+			break
+		}
+	}
+	if restoreIdx < 0 {
+		s.problem(w, r, http.StatusConflict, "no previous healthy deployment to roll back to")
+		return
+	}
+
+	now := time.Now().UTC()
+	service.Deployments[idx].Status = "rolled_back"
+	service.Deployments[restoreIdx].Status = "healthy"
+	service.Deployments[restoreIdx].PromotedAt = now
+	service.Image = service.Deployments[restoreIdx].Image
+
+	if err := s.store.UpdateService(service); err != nil {
+		s.problem(w, r, http.StatusInternalServerError, "failed to roll back deployment")
+		return
+	}
+	s.version.bump()
+
+	_ = json.NewEncoder(w).Encode(service.Deployments[restoreIdx])
+}
+
+func deploymentIndex(deployments []models.Deployment, id string) int {
+	for i, d := range deployments {
+		if d.ID == id {
+			return i
+		}
+	}
+	return -1
 }
 
+// handleTraefikConfig serves the rendered Traefik dynamic config. A caller
+// that passes ?since=<version> and ?wait=<duration> long-polls: if the
+// version hasn't advanced past since, the request blocks (up to wait) for
+// the next change before responding, so an agent can react without
+// waiting out a fixed poll interval. Callers that omit since/wait get the
+// pre-existing immediate-response behavior. The version served is always
+// echoed back in the X-Config-Version header.
 func (s *Server) handleTraefikConfig(w http.ResponseWriter, r *http.Request) {
+	since, hasSince := parseUintQuery(r, "since")
+	wait := parseDurationQuery(r, "wait")
+
+	version := s.version.get()
+	if hasSince && wait > 0 && since == version {
+		version = s.version.wait(r.Context(), since, timeoutChan(wait))
+	}
+
 	projects, err := s.store.ListProjects()
 	if err != nil {
-		http.Error(w, `internal error`, http.StatusInternalServerError)
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
@@ -593,23 +1374,95 @@ func (s *Server) handleTraefikConfig(w http.ResponseWriter, r *http.Request) {
 	for _, project := range projects {
 		svcList, err := s.store.ListServicesByProject(project.ID)
 		if err != nil {
-			http.Error(w, `internal error`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 		services = append(services, svcList...)
 	}
 
 	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Header().Set("X-Config-Version", strconv.FormatUint(version, 10))
 	config := renderTraefikConfig(services, s.leResolver)
 	_, _ = w.Write([]byte(config))
 }
 
+// handleEvents streams `traefik.updated` / `services.updated` SSE events
+// carrying the new config version, so a subscribed agent can react in
+// sub-second time instead of polling. Both event names fire together on
+// every version bump: nearly every mutation that changes the rendered
+// Traefik config (domains, images) also changes the agent's service
+// state feed, so there's no cheaper way to split them that wouldn't be a
+// false economy of complexity.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.problem(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	updates, cancel := s.version.subscribe()
+	defer cancel()
+
+	fmt.Fprintf(w, "event: hello\ndata: %d\n\n", s.version.get())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case v := <-updates:
+			fmt.Fprintf(w, "event: traefik.updated\ndata: %d\n\n", v)
+			fmt.Fprintf(w, "event: services.updated\ndata: %d\n\n", v)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// parseUintQuery parses a non-negative integer query parameter, reporting
+// whether it was present and well-formed.
+func parseUintQuery(r *http.Request, name string) (uint64, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// parseDurationQuery parses a Go duration query parameter (e.g. "30s"),
+// returning 0 if absent or malformed.
+func parseDurationQuery(r *http.Request, name string) time.Duration {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
 func (s *Server) handleBuildJobs(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		jobs, err := s.store.ListBuildJobs()
 		if err != nil {
-			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 		_ = json.NewEncoder(w).Encode(map[string]any{"build_jobs": jobs})
@@ -618,6 +1471,7 @@ func (s *Server) handleBuildJobs(w http.ResponseWriter, r *http.Request) {
 			Repository   string   `json:"repository"`
 			Ref          string   `json:"ref"`
 			Commit       string   `json:"commit"`
+			Provider     string   `json:"provider"`
 			Installation string   `json:"installation"`
 			Status       string   `json:"status"`
 			ServiceID    string   `json:"service_id"`
@@ -626,18 +1480,22 @@ func (s *Server) handleBuildJobs(w http.ResponseWriter, r *http.Request) {
 			ComposePath  string   `json:"compose_path"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
 			return
 		}
 		if payload.Repository == "" || payload.Commit == "" {
-			http.Error(w, `{"error":"repository and commit required"}`, http.StatusBadRequest)
+			s.problem(w, r, http.StatusBadRequest, "repository and commit required")
 			return
 		}
+		if payload.Provider == "" {
+			payload.Provider = "github"
+		}
 		job := &models.BuildJob{
 			ID:           newID(),
 			Repository:   payload.Repository,
 			Ref:          payload.Ref,
 			Commit:       payload.Commit,
+			Provider:     payload.Provider,
 			Installation: payload.Installation,
 			Status:       payload.Status,
 			ServiceID:    payload.ServiceID,
@@ -646,470 +1504,1498 @@ func (s *Server) handleBuildJobs(w http.ResponseWriter, r *http.Request) {
 			ComposePath:  payload.ComposePath,
 		}
 		if err := s.store.CreateBuildJob(job); err != nil {
-			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err), http.StatusInternalServerError)
+			s.problem(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
+		s.buildQueue.bump()
 		w.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(w).Encode(job)
 	default:
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
 func (s *Server) handleBuildJob(w http.ResponseWriter, r *http.Request) {
-    if !strings.HasPrefix(r.URL.Path, "/v1/build-jobs/") {
-        http.NotFound(w, r)
-        return
-    }
-    id := strings.TrimPrefix(r.URL.Path, "/v1/build-jobs/")
-    if id == "" {
-        http.NotFound(w, r)
-        return
-    }
-
-    switch r.Method {
-    case http.MethodGet:
-        job, err := s.store.GetBuildJob(id)
-        if err != nil {
-            if errors.Is(err, store.ErrNotFound) {
-                http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
-                return
-            }
-            http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
-            return
-        }
-        _ = json.NewEncoder(w).Encode(job)
-    case http.MethodPatch, http.MethodPost:
-        job, err := s.store.GetBuildJob(id)
-        if err != nil {
-            if errors.Is(err, store.ErrNotFound) {
-                http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
-                return
-            }
-            http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
-            return
-        }
-        var payload struct {
-            Status      string   `json:"status"`
-            Reason      string   `json:"reason"`
-            Artifacts   []string `json:"artifacts"`
-            ComposePath string   `json:"compose_path"`
-        }
-        if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-            http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
-            return
-        }
-        if payload.Status != "" {
-            job.Status = payload.Status
-        }
-        if payload.Artifacts != nil {
-            job.Artifacts = payload.Artifacts
-        }
-        if payload.ComposePath != "" {
-            job.ComposePath = payload.ComposePath
-        }
-        job.Reason = payload.Reason
-        if err := s.store.UpdateBuildJob(job); err != nil {
-            http.Error(w, `{"error":"failed to update"}`, http.StatusInternalServerError)
-            return
-        }
-        _ = json.NewEncoder(w).Encode(job)
-    default:
-        http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
-    }
-}
-
-func (s *Server) handleBuildJobClaim(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+	if !strings.HasPrefix(r.URL.Path, "/v1/build-jobs/") {
+		http.NotFound(w, r)
 		return
 	}
-
-	var payload struct {
-		Worker string `json:"worker"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+	id := strings.TrimPrefix(r.URL.Path, "/v1/build-jobs/")
+	if id == "" {
+		http.NotFound(w, r)
 		return
 	}
-	worker := payload.Worker
-	if worker == "" {
-		worker = "worker-" + newID()
+
+	if idx := strings.IndexByte(id, '/'); idx >= 0 {
+		sub := id[idx+1:]
+		id = id[:idx]
+		switch sub {
+		case "logs":
+			s.handleBuildJobLogs(w, r, id)
+		case "heartbeat":
+			s.handleBuildJobHeartbeat(w, r, id)
+		case "restart":
+			s.handleBuildJobRestart(w, r, id)
+		case "cancel":
+			s.handleBuildJobCancel(w, r, id)
+		case "artifacts":
+			s.handleBuildJobArtifacts(w, r, id)
+		case "events":
+			s.handleBuildJobEvents(w, r, id)
+		default:
+			http.NotFound(w, r)
+		}
+		return
 	}
 
-	job, err := s.store.ClaimNextPendingBuildJob(worker)
-	if err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			w.WriteHeader(http.StatusNoContent)
+	switch r.Method {
+	case http.MethodGet:
+		job, err := s.store.GetBuildJob(id)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				s.problem(w, r, http.StatusNotFound, "not found")
+				return
+			}
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
-		return
+		_ = json.NewEncoder(w).Encode(job)
+	case http.MethodPatch, http.MethodPost:
+		job, err := s.store.GetBuildJob(id)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				s.problem(w, r, http.StatusNotFound, "not found")
+				return
+			}
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		var payload struct {
+			Status         string            `json:"status"`
+			Reason         string            `json:"reason"`
+			Artifacts      []string          `json:"artifacts"`
+			ComposePath    string            `json:"compose_path"`
+			Builder        string            `json:"builder"`
+			Language       string            `json:"language"`
+			BuilderVersion string            `json:"builder_version"`
+			ImageRefs      map[string]string `json:"image_refs"`
+			LogsURL        string            `json:"logs_url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if payload.Status != "" {
+			job.Status = payload.Status
+		}
+		if payload.Artifacts != nil {
+			job.Artifacts = payload.Artifacts
+		}
+		if payload.ComposePath != "" {
+			job.ComposePath = payload.ComposePath
+		}
+		if payload.Builder != "" {
+			job.Builder = payload.Builder
+		}
+		if payload.Language != "" {
+			job.Language = payload.Language
+		}
+		if payload.BuilderVersion != "" {
+			job.BuilderVersion = payload.BuilderVersion
+		}
+		if payload.ImageRefs != nil {
+			job.ImageRefs = payload.ImageRefs
+		}
+		if payload.LogsURL != "" {
+			job.LogsURL = payload.LogsURL
+		}
+		job.Reason = payload.Reason
+		if err := s.store.UpdateBuildJob(job); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "failed to update")
+			return
+		}
+		if payload.Status != "" {
+			s.buildEvents.publish(id, buildJobEvent{Type: "status", Status: job.Status})
+		}
+		if conclusion, ok := checkRunConclusion[job.Status]; ok {
+			s.reportCheckRun(r.Context(), job, "completed", conclusion, job.Reason)
+		}
+		_ = json.NewEncoder(w).Encode(job)
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
+}
 
-	_ = json.NewEncoder(w).Encode(job)
+func (s *Server) handleBuildJobLogs(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		since, _ := parseUintQuery(r, "since")
+		if r.URL.Query().Get("follow") == "true" {
+			s.streamBuildJobLogs(w, r, id, int(since))
+			return
+		}
+		lines, next, err := s.store.GetBuildJobLogsSince(id, int(since))
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				s.problem(w, r, http.StatusNotFound, "not found")
+				return
+			}
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"lines": lines, "next": next})
+	case http.MethodPost:
+		var payload struct {
+			Sequence int      `json:"sequence"`
+			Lines    []string `json:"lines"`
+			Final    bool     `json:"final"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := s.store.AppendBuildJobLogs(id, payload.Lines); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				s.problem(w, r, http.StatusNotFound, "not found")
+				return
+			}
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if len(payload.Lines) > 0 {
+			s.buildEvents.publish(id, buildJobEvent{Type: "log", Lines: payload.Lines})
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]any{"sequence": payload.Sequence, "accepted": len(payload.Lines)})
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
 }
 
-func (s *Server) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+// streamBuildJobLogs is GET .../logs?follow=true's SSE mode: it replays
+// whatever's still buffered after since as one "log" event, then streams
+// each later append the same way, so a reconnecting `infrctl builds logs
+// --follow --since N` picks up mid-stream instead of re-printing
+// everything or missing lines appended in the gap. Ends itself once the
+// job reaches a terminal status or the client disconnects, same as
+// handleBuildJobEvents.
+func (s *Server) streamBuildJobLogs(w http.ResponseWriter, r *http.Request, id string, since int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.problem(w, r, http.StatusInternalServerError, "streaming unsupported")
 		return
 	}
 
-	payload, err := io.ReadAll(r.Body)
+	job, err := s.store.GetBuildJob(id)
 	if err != nil {
-		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
-	event := r.Header.Get("X-GitHub-Event")
-	deliveryID := r.Header.Get("X-GitHub-Delivery")
-	installationIDHeader := r.Header.Get("X-GitHub-Installation-Id")
-
-	installationID := installationIDHeader
-	if installationID == "" {
-		installationID = extractInstallationID(payload)
+	lines, _, err := s.store.GetBuildJobLogsSince(id, since)
+	if err != nil {
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
 	}
 
-	var inst *models.Installation
-	if installationID != "" {
-		installation, err := s.store.FindInstallationByExternalID(installationID)
-		if err == nil {
-			inst = installation
-		} else if err != nil && !errors.Is(err, store.ErrNotFound) {
-			log.Printf("[webhook] lookup installation %s failed: %v", installationID, err)
-		}
-	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
 
-	sig := r.Header.Get("X-Hub-Signature-256")
-	if inst != nil && inst.WebhookSecret != "" {
-		if err := verifySignature(sig, payload, inst.WebhookSecret); err != nil {
-			http.Error(w, fmt.Sprintf(`{"error":"signature invalid: %s"}`, err), http.StatusUnauthorized)
-			return
-		}
-	} else if sig != "" {
-		log.Printf("[webhook] signature provided but no secret registered for installation %s", installationID)
-	}
+	events, cancel := s.buildEvents.subscribe(id)
+	defer cancel()
 
-	response := map[string]any{
-		"status":        "accepted",
-		"event":         event,
-		"delivery_id":   deliveryID,
-		"installation_id": installationID,
+	if len(lines) > 0 {
+		data, _ := json.Marshal(buildJobEvent{Type: "log", Lines: lines})
+		fmt.Fprintf(w, "event: log\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	if isTerminalBuildStatus(job.Status) {
+		return
 	}
 
-	switch event {
-	case "push":
-		if info, err := parsePushEvent(payload); err == nil {
-			response["repository"] = info.Repository
-			response["ref"] = info.Ref
-			response["commit"] = info.After
-			if info.Repository != "" && info.After != "" {
-				job := &models.BuildJob{
-					ID:           newID(),
-					Repository:   info.Repository,
-					Ref:          info.Ref,
-					Commit:       info.After,
-					Installation: installationID,
-					Status:       "pending",
-				}
-				if owner, name, err := splitRepoFullName(info.Repository); err == nil {
-					repoID := repositoryID(owner, name)
-					repo, repoErr := s.store.GetRepository(repoID)
-					if repoErr == nil {
-						job.ServiceID = repo.ServiceID
-						if repo.Environment != "" {
-							job.Environment = repo.Environment
-						} else if repo.ServiceID != "" {
-							job.Environment = "production"
-						}
-						job.ComposePath = repo.ComposePath
-					} else if repoErr != nil && !errors.Is(repoErr, store.ErrNotFound) {
-						log.Printf("[webhook] repository lookup failed: %v", repoErr)
-					}
-				} else {
-					log.Printf("[webhook] invalid repository name %s: %v", info.Repository, err)
-				}
-				if err := s.store.CreateBuildJob(job); err != nil {
-					log.Printf("[webhook] failed to enqueue build job: %v", err)
-				} else {
-					response["build_job_id"] = job.ID
-				}
-			}
-		} else {
-			log.Printf("[webhook] failed to parse push payload: %v", err)
-		}
-	case "installation_repositories":
-		if info, err := parseInstallationReposEvent(payload); err == nil {
-			response["action"] = info.Action
-			response["repositories"] = info.Existing
-			response["added"] = info.Added
-			response["removed"] = info.Removed
-
-			// Upsert existing repositories to keep metadata fresh.
-			for _, repo := range info.Existing {
-				owner, name := resolveRepoOwnerName(repo)
-				if owner == "" || name == "" {
-					continue
-				}
-				repoModel := &models.Repository{
-					ID:            repositoryID(owner, name),
-					Owner:         owner,
-					Name:          name,
-					DefaultBranch: repo.DefaultBranch,
-					ComposePath:   "docker-compose.yml",
-					Installation:  installationID,
-				}
-				if err := s.store.UpsertRepository(repoModel); err != nil {
-					log.Printf("[webhook] failed to upsert repository %s/%s: %v", owner, name, err)
-				}
-			}
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
 
-			// Ensure added repositories are recorded explicitly.
-			for _, repo := range info.Added {
-				owner, name := resolveRepoOwnerName(repo)
-				if owner == "" || name == "" {
-					continue
-				}
-				repoModel := &models.Repository{
-					ID:            repositoryID(owner, name),
-					Owner:         owner,
-					Name:          name,
-					DefaultBranch: repo.DefaultBranch,
-					ComposePath:   "docker-compose.yml",
-					Installation:  installationID,
-				}
-				if err := s.store.UpsertRepository(repoModel); err != nil {
-					log.Printf("[webhook] failed to register repository %s/%s: %v", owner, name, err)
-				}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if event.Type == "log" {
+				data, _ := json.Marshal(event)
+				fmt.Fprintf(w, "event: log\ndata: %s\n\n", data)
+				flusher.Flush()
 			}
-
-			// Remove repositories that were deleted from the installation.
-			for _, repo := range info.Removed {
-				owner, name := resolveRepoOwnerName(repo)
-				if owner == "" || name == "" {
-					continue
-				}
-				id := repositoryID(owner, name)
-				if err := s.store.DeleteRepository(id); err != nil && !errors.Is(err, store.ErrNotFound) {
-					log.Printf("[webhook] failed to delete repository %s/%s: %v", owner, name, err)
-				}
+			if event.Type == "status" && isTerminalBuildStatus(event.Status) {
+				return
 			}
-		} else {
-			log.Printf("[webhook] failed to parse installation_repositories payload: %v", err)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
 		}
-	default:
-		log.Printf("[webhook] received %s event (delivery %s)", event, deliveryID)
 	}
-
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(response)
-}
-
-func slugify(input string) string {
-	input = strings.TrimSpace(strings.ToLower(input))
-	input = strings.ReplaceAll(input, " ", "-")
-	input = strings.ReplaceAll(input, "_", "-")
-	return input
-}
-
-func repositoryID(owner, name string) string {
-	return sanitizeKey(owner) + "-" + sanitizeKey(name)
-}
-
-func installationID(account, external string) string {
-	return sanitizeKey(account) + "-" + sanitizeKey(external)
 }
 
-func splitRepoFullName(full string) (string, string, error) {
-	parts := strings.Split(full, "/")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid repository name: %s", full)
-	}
-	owner := strings.TrimSpace(parts[0])
-	name := strings.TrimSpace(parts[1])
-	if owner == "" || name == "" {
-		return "", "", fmt.Errorf("invalid repository name: %s", full)
+func (s *Server) handleBuildJobHeartbeat(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
 	}
-	return owner, name, nil
-}
-
-func resolveRepoOwnerName(info repoInfo) (string, string) {
-	owner := info.Owner
-	name := info.Name
-	if (owner == "" || name == "") && info.FullName != "" {
-		parts := strings.Split(info.FullName, "/")
-		if len(parts) == 2 {
-			if owner == "" {
-				owner = parts[0]
-			}
-			if name == "" {
-				name = parts[1]
-			}
+	job, err := s.store.HeartbeatBuildJob(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "not found")
+			return
 		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
 	}
-	return strings.TrimSpace(owner), strings.TrimSpace(name)
+	_ = json.NewEncoder(w).Encode(job)
 }
 
-func extractInstallationID(payload []byte) string {
-	var body struct {
-		Installation struct {
-			ID int64 `json:"id"`
-		} `json:"installation"`
-	}
-	if err := json.Unmarshal(payload, &body); err != nil {
-		return ""
+// handleBuildJobCancel flags a job as cancel-requested; it doesn't change
+// the job's status itself since the control plane has no way to reach into
+// a worker and kill its build. A running job's worker notices via its next
+// heartbeat (handleBuildJobHeartbeat's response). A still-pending job is
+// not stopped: claiming it clears CancelRequested, so it builds as usual.
+func (s *Server) handleBuildJobCancel(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
 	}
-	if body.Installation.ID == 0 {
-		return ""
+	job, err := s.store.CancelBuildJob(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
 	}
-	return strconv.FormatInt(body.Installation.ID, 10)
+	_ = json.NewEncoder(w).Encode(job)
 }
 
-func verifySignature(signatureHeader string, payload []byte, secret string) error {
-	const prefix = "sha256="
-	if signatureHeader == "" {
-		return errors.New("missing signature header")
-	}
-	if !strings.HasPrefix(signatureHeader, prefix) {
-		return fmt.Errorf("unexpected signature format")
+func (s *Server) handleBuildJobRestart(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
 	}
-	sigBytes, err := hex.DecodeString(signatureHeader[len(prefix):])
+	job, err := s.store.RestartBuildJob(id)
 	if err != nil {
-		return fmt.Errorf("decode signature: %w", err)
-	}
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(payload)
-	expected := mac.Sum(nil)
-	if !hmac.Equal(expected, sigBytes) {
-		return errors.New("signature mismatch")
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
 	}
-	return nil
-}
-
-type pushEventInfo struct {
-	Repository string
-	Ref        string
-	After      string
+	s.buildEvents.publish(id, buildJobEvent{Type: "status", Status: job.Status})
+	s.buildQueue.bump()
+	_ = json.NewEncoder(w).Encode(job)
 }
 
-func parsePushEvent(payload []byte) (pushEventInfo, error) {
-	var body struct {
-		Ref  string `json:"ref"`
-		After string `json:"after"`
-		Repository struct {
-			FullName string `json:"full_name"`
-			Name     string `json:"name"`
-			Owner    struct {
-				Login string `json:"login"`
-			} `json:"owner"`
-		} `json:"repository"`
-	}
-	if err := json.Unmarshal(payload, &body); err != nil {
-		return pushEventInfo{}, err
+// artifactPresignExpiry is how long a presigned artifact URL stays valid.
+// Workers and the runtime fetching a compose bundle are expected to start
+// the transfer well within this window.
+const artifactPresignExpiry = 15 * time.Minute
+
+// handleBuildJobArtifacts presigns direct-to-bucket URLs for build
+// artifacts (image tarballs, compose renders) so workers and the runtime
+// never have to proxy blob bytes through the control plane. POST mints an
+// upload URL and records the object key on the job; GET mints a download
+// URL for a key the job already owns.
+func (s *Server) handleBuildJobArtifacts(w http.ResponseWriter, r *http.Request, id string) {
+	if s.objectStore == nil {
+		s.problem(w, r, http.StatusServiceUnavailable, "object storage not configured")
+		return
 	}
-	repo := body.Repository.FullName
-	if repo == "" && body.Repository.Owner.Login != "" && body.Repository.Name != "" {
-		repo = body.Repository.Owner.Login + "/" + body.Repository.Name
+	job, err := s.store.GetBuildJob(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			s.problem(w, r, http.StatusBadRequest, "key is required")
+			return
+		}
+		found := false
+		for _, existing := range job.Artifacts {
+			if existing == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.problem(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		url, err := s.objectStore.PresignGET(key, artifactPresignExpiry)
+		if err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"key":        key,
+			"url":        url,
+			"expires_in": int(artifactPresignExpiry.Seconds()),
+		})
+	case http.MethodPost:
+		var payload struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if payload.Name == "" {
+			s.problem(w, r, http.StatusBadRequest, "name is required")
+			return
+		}
+		key := fmt.Sprintf("build-jobs/%s/%s-%s", id, sanitizeKey(payload.Name), newID())
+		url, err := s.objectStore.PresignPUT(key, artifactPresignExpiry)
+		if err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		job.Artifacts = append(job.Artifacts, key)
+		if err := s.store.UpdateBuildJob(job); err != nil {
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"key":        key,
+			"upload_url": url,
+			"expires_in": int(artifactPresignExpiry.Seconds()),
+		})
+	default:
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
-	return pushEventInfo{
-		Repository: repo,
-		Ref:        body.Ref,
-		After:      body.After,
-	}, nil
 }
 
-type repoInfo struct {
-	FullName     string
-	Owner        string
-	Name         string
-	DefaultBranch string
+// handleBuildJobEvents streams a single build job's status transitions and
+// log line appends over SSE, so a CLI or dashboard watching one job can
+// react the instant something changes instead of re-polling GET
+// /v1/build-jobs/{id}. The connection ends itself (freeing its subscriber
+// channel) as soon as the job reaches a terminal status or the client
+// goes away, so a forgotten tab doesn't leak a goroutine forever.
+func (s *Server) handleBuildJobEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.problem(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	job, err := s.store.GetBuildJob(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		s.problem(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	events, cancel := s.buildEvents.subscribe(id)
+	defer cancel()
+
+	fmt.Fprintf(w, "event: status\ndata: %s\n\n", job.Status)
+	flusher.Flush()
+	if isTerminalBuildStatus(job.Status) {
+		return
+	}
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+			if event.Type == "status" && isTerminalBuildStatus(event.Status) {
+				return
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
 }
 
-type installationReposInfo struct {
-    Action   string
-    Added    []repoInfo
-    Removed  []repoInfo
-    Existing []repoInfo
+func isTerminalBuildStatus(status string) bool {
+	return status == "succeeded" || status == "failed"
 }
 
-func resolveRepoOwnerName(info repoInfo) (string, string) {
-	owner := strings.TrimSpace(info.Owner)
-	name := strings.TrimSpace(info.Name)
-	if owner == "" || name == "" {
-		if info.FullName != "" {
-			parts := strings.Split(info.FullName, "/")
-			if len(parts) == 2 {
-				if owner == "" {
-					owner = strings.TrimSpace(parts[0])
-				}
-				if name == "" {
-					name = strings.TrimSpace(parts[1])
+func (s *Server) handleBuildJobClaim(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var payload struct {
+		Worker   string `json:"worker"`
+		Active   int    `json:"active"`   // jobs this worker is currently running
+		Capacity int    `json:"capacity"` // max concurrent jobs this worker will run
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		s.problem(w, r, http.StatusBadRequest, "invalid json")
+		return
+	}
+	worker := payload.Worker
+	if worker == "" {
+		worker = "worker-" + newID()
+	}
+	// Reported load isn't used to pick among workers yet - ClaimNextPendingBuildJob
+	// just hands out the oldest pending job - but logging it now means we have
+	// data to build fair scheduling on top of later.
+	log.Printf("[claim] worker=%s load=%d/%d", worker, payload.Active, payload.Capacity)
+
+	wait := parseDurationQuery(r, "wait")
+	deadline := time.Now().Add(wait)
+	for {
+		job, err := s.store.ClaimNextPendingBuildJob(worker)
+		if err == nil {
+			s.buildEvents.publish(job.ID, buildJobEvent{Type: "status", Status: job.Status})
+			s.reportCheckRun(r.Context(), job, "in_progress", "", "")
+			_ = json.NewEncoder(w).Encode(job)
+			return
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			s.problem(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		remaining := time.Until(deadline)
+		if wait <= 0 || remaining <= 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		since := s.buildQueue.get()
+		s.buildQueue.wait(r.Context(), since, timeoutChan(remaining))
+		if r.Context().Err() != nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+}
+
+// providerEventHeader returns the HTTP header a provider's webhooks carry
+// their event-type in.
+func providerEventHeader(providerName string) string {
+	switch providerName {
+	case "gitlab":
+		return "X-Gitlab-Event"
+	case "gitea":
+		return "X-Gitea-Event"
+	case "bitbucket":
+		return "X-Event-Key"
+	default:
+		return "X-GitHub-Event"
+	}
+}
+
+// hasWebhookSignature reports whether the request carries any of the
+// three providers' signature/token headers, so a webhook whose secret
+// isn't registered yet can still be logged instead of silently accepted.
+func hasWebhookSignature(h http.Header) bool {
+	return h.Get("X-Hub-Signature-256") != "" || h.Get("X-Gitea-Signature") != "" || h.Get("X-Gitlab-Token") != ""
+}
+
+// findWebhookInstallation resolves the Installation a webhook belongs to.
+// GitHub carries an installation ID in a header (or the payload, for
+// installation-lifecycle events); GitLab and Gitea have no such app-wide
+// concept, so externalInstallationID is empty there. Falls back to
+// whatever the target repository was already registered under.
+func (s *Server) findWebhookInstallation(externalInstallationID, repository string) *models.Installation {
+	if externalInstallationID != "" {
+		inst, err := s.store.FindInstallationByExternalID(externalInstallationID)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				log.Printf("[webhook] lookup installation %s failed: %v", externalInstallationID, err)
+			}
+			return nil
+		}
+		return inst
+	}
+	if repository == "" {
+		return nil
+	}
+	owner, name, err := splitRepoFullName(repository)
+	if err != nil {
+		return nil
+	}
+	repo, err := s.store.GetRepository(repositoryID(owner, name))
+	if err != nil || repo.Installation == "" {
+		return nil
+	}
+	inst, err := s.store.FindInstallationByExternalID(repo.Installation)
+	if err != nil {
+		return nil
+	}
+	return inst
+}
+
+// handleProviderWebhook builds the webhook receiver for one registered
+// provider. Verification is shared across GitHub, GitLab, Gitea, and
+// Bitbucket; only decoding the raw payload into a normalized
+// providers.Event is provider-specific, and that lives in the Provider
+// implementation itself. Once an event is parsed and signature-verified,
+// the handler only persists a WebhookTask and hands it to s.webhookQueue
+// before responding 202 - the actual repo upsert / BuildJob creation runs
+// on a worker goroutine (see processWebhookTask), so a slow store or a
+// burst of redeliveries never ties up the request. Redelivery dedup
+// itself is handled one layer up, by withIdempotency keying off
+// Idempotency-Key (or the provider's own delivery ID). Owner/name parsing
+// for the repository a payload refers to is centralized in
+// splitRepoFullName below rather than duplicated per call site.
+func (s *Server) handleProviderWebhook(providerName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			s.problem(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		provider, ok := s.providers.Get(providerName)
+		if !ok {
+			s.problem(w, r, http.StatusNotFound, "provider not configured")
+			return
+		}
+
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.problem(w, r, http.StatusBadRequest, "invalid body")
+			return
+		}
+
+		eventType := r.Header.Get(providerEventHeader(providerName))
+		deliveryID := r.Header.Get("X-GitHub-Delivery")
+		if deliveryID == "" {
+			deliveryID = r.Header.Get("X-Gitea-Delivery")
+		}
+		if deliveryID == "" {
+			deliveryID = r.Header.Get("X-Gitlab-Event-UUID")
+		}
+		if deliveryID == "" {
+			deliveryID = r.Header.Get("X-Request-UUID") // Bitbucket Cloud
+		}
+
+		event, matched, err := provider.ParseEvent(eventType, payload)
+		if err != nil {
+			log.Printf("[webhook] failed to parse %s %s payload: %v", providerName, eventType, err)
+			s.problem(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+
+		externalInstallationID := r.Header.Get("X-GitHub-Installation-Id")
+		if externalInstallationID == "" {
+			externalInstallationID = event.InstallationID
+		}
+		inst := s.findWebhookInstallation(externalInstallationID, event.Repository)
+		if inst != nil && externalInstallationID == "" {
+			externalInstallationID = inst.ExternalID
+		}
+
+		if inst != nil && inst.WebhookSecret != "" {
+			if err := provider.VerifySignature(r.Header, payload, inst.WebhookSecret); err != nil {
+				s.problem(w, r, http.StatusUnauthorized, "signature invalid: "+err.Error())
+				return
+			}
+		} else if hasWebhookSignature(r.Header) {
+			log.Printf("[webhook] signature provided but no secret registered for installation %s", externalInstallationID)
+		}
+
+		response := map[string]any{
+			"status":          "accepted",
+			"event":           eventType,
+			"delivery_id":     deliveryID,
+			"installation_id": externalInstallationID,
+		}
+
+		if !matched {
+			log.Printf("[webhook] received %s %s event (delivery %s), no action taken", providerName, eventType, deliveryID)
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		eventJSON, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("[webhook] failed to marshal %s event for queueing: %v", providerName, err)
+			s.problem(w, r, http.StatusInternalServerError, "failed to queue event")
+			return
+		}
+		task := &models.WebhookTask{
+			ID:                     newID(),
+			Provider:               providerName,
+			ExternalInstallationID: externalInstallationID,
+			EventJSON:              string(eventJSON),
+			Status:                 "pending",
+			CreatedAt:              time.Now().UTC(),
+		}
+		if err := s.store.SaveWebhookTask(task); err != nil {
+			log.Printf("[webhook] failed to persist webhook task: %v", err)
+			s.problem(w, r, http.StatusInternalServerError, "failed to queue event")
+			return
+		}
+		response["task_id"] = task.ID
+		s.webhookQueue.submit(task)
+
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+// dispatchProviderEvent applies the store side effects for a normalized
+// Event, identical regardless of which provider produced it.
+func (s *Server) dispatchProviderEvent(ctx context.Context, providerName, externalInstallationID string, event providers.Event, response map[string]any) {
+	switch event.Kind {
+	case "push":
+		s.handlePushEvent(ctx, providerName, externalInstallationID, event, response)
+	case "pull_request":
+		s.handlePullRequestEvent(ctx, event, response)
+	case "installation":
+		s.handleInstallationEvent(providerName, externalInstallationID, event, response)
+	case "check":
+		s.enqueueRecheckBuild(ctx, providerName, event, response)
+	default:
+		log.Printf("[webhook] %s event with unrecognized kind %q, no action taken", providerName, event.Kind)
+	}
+}
+
+// handlePushEvent enqueues a build for a push that passes repo's
+// PushFilter (or, absent one, for a push to repo's default branch only,
+// the same way GitHub Actions path filters would).
+func (s *Server) handlePushEvent(ctx context.Context, providerName, externalInstallationID string, event providers.Event, response map[string]any) {
+	response["repository"] = event.Repository
+	response["ref"] = event.Ref
+	response["commit"] = event.Commit
+	if event.Repository == "" || event.Commit == "" {
+		return
+	}
+
+	var repo *models.Repository
+	if owner, name, err := splitRepoFullName(event.Repository); err == nil {
+		repoID := repositoryID(owner, name)
+		if found, repoErr := s.store.GetRepository(repoID); repoErr == nil {
+			repo = found
+		} else if !errors.Is(repoErr, store.ErrNotFound) {
+			log.Printf("[webhook] repository lookup failed: %v", repoErr)
+		}
+	} else {
+		log.Printf("[webhook] invalid repository name %s: %v", event.Repository, err)
+	}
+
+	changedPaths := s.changedPathsForPush(ctx, repo, event)
+
+	if repo != nil && repo.PushFilter != nil {
+		filter, err := compilePushFilter(repo.PushFilter)
+		if err != nil {
+			log.Printf("[webhook] repository %s has an invalid push filter: %v", event.Repository, err)
+		} else if reason := filter.evaluatePush(event.Ref, changedPaths); reason != "" {
+			log.Printf("[webhook] push %s to %s skipped by push filter: %s", event.Commit, event.Ref, reason)
+			response["skipped"] = reason
+			return
+		}
+	} else if repo != nil && repo.DefaultBranch != "" && normalizeGitRef(event.Ref) != repo.DefaultBranch {
+		log.Printf("[webhook] push to %s is not the default branch (%s), skipping build", event.Ref, repo.DefaultBranch)
+		response["skipped"] = fmt.Sprintf("not the default branch (%s)", repo.DefaultBranch)
+		return
+	}
+
+	if repo == nil || len(repo.Services) == 0 {
+		job := &models.BuildJob{
+			ID:           newID(),
+			Repository:   event.Repository,
+			Ref:          event.Ref,
+			Commit:       event.Commit,
+			Provider:     providerName,
+			Installation: externalInstallationID,
+			Status:       "pending",
+		}
+		if repo != nil && repo.Provider != "" {
+			job.Provider = repo.Provider
+		}
+		if applyCommitDirectives(job, event.Message) {
+			log.Printf("[webhook] push %s skipped via ci-skip commit-message directive", event.Commit)
+			response["skipped"] = "ci skip directive"
+			return
+		}
+		if len(job.Directives) > 0 {
+			response["directives"] = job.Directives
+		}
+		if err := s.store.CreateBuildJob(job); err != nil {
+			log.Printf("[webhook] failed to enqueue build job: %v", err)
+			return
+		}
+		s.buildQueue.bump()
+		response["build_job_id"] = job.ID
+		s.reportCheckRun(ctx, job, "queued", "", "")
+		return
+	}
+
+	var jobIDs []string
+	for _, rs := range repo.Services {
+		if !repositoryServiceMatchesPaths(rs, changedPaths) {
+			continue
+		}
+		job := &models.BuildJob{
+			ID:           newID(),
+			Repository:   event.Repository,
+			Ref:          event.Ref,
+			Commit:       event.Commit,
+			Provider:     repo.Provider,
+			Installation: externalInstallationID,
+			Status:       "pending",
+			ServiceID:    rs.ServiceID,
+			ComposePath:  rs.ComposePath,
+		}
+		if job.Provider == "" {
+			job.Provider = providerName
+		}
+		if rs.Environment != "" {
+			job.Environment = rs.Environment
+		} else {
+			job.Environment = "production"
+		}
+		if applyCommitDirectives(job, event.Message) {
+			log.Printf("[webhook] push %s skipped via ci-skip commit-message directive", event.Commit)
+			response["skipped"] = "ci skip directive"
+			return
+		}
+		if len(job.Directives) > 0 {
+			response["directives"] = job.Directives
+		}
+		if err := s.store.CreateBuildJob(job); err != nil {
+			log.Printf("[webhook] failed to enqueue build job for service %s: %v", rs.ServiceID, err)
+			continue
+		}
+		s.buildQueue.bump()
+		jobIDs = append(jobIDs, job.ID)
+		s.reportCheckRun(ctx, job, "queued", "", "")
+		s.refreshServiceCompose(ctx, repo, rs, event.Commit)
+	}
+	if len(jobIDs) == 0 {
+		response["skipped"] = "no service's path_prefix matched the changed paths"
+		return
+	}
+	response["build_job_ids"] = jobIDs
+}
+
+// repositoryServiceMatchesPaths reports whether rs should build for a push
+// whose changed files are changedPaths. An empty PathPrefix always
+// matches (the right behavior for a single-service repo); nil
+// changedPaths means the diff couldn't be determined, so every service
+// matches rather than silently skipping a build.
+func repositoryServiceMatchesPaths(rs models.RepositoryService, changedPaths []string) bool {
+	if rs.PathPrefix == "" || changedPaths == nil {
+		return true
+	}
+	prefix := strings.TrimSuffix(rs.PathPrefix, "/")
+	for _, p := range changedPaths {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// changedPathsForPush returns the files event's push touched, preferring
+// a GitHub commits/compare API lookup (covers every commit in the push,
+// not just the latest one Event.ChangedPaths was built from) when the
+// repo's provider supports DiffFetcher and the push carried a BeforeSHA
+// to diff against. Falls back to event.ChangedPaths - nil if the
+// provider never reported one - on any error, since this is a
+// monorepo-fan-out nicety, not a precondition for building at all.
+func (s *Server) changedPathsForPush(ctx context.Context, repo *models.Repository, event providers.Event) []string {
+	if repo == nil || repo.Installation == "" || event.BeforeSHA == "" {
+		return event.ChangedPaths
+	}
+	providerName := repo.Provider
+	if providerName == "" {
+		providerName = "github"
+	}
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return event.ChangedPaths
+	}
+	differ, ok := provider.(providers.DiffFetcher)
+	if !ok {
+		return event.ChangedPaths
+	}
+	inst, err := s.store.FindInstallationByExternalID(repo.Installation)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("[webhook] installation lookup failed for %s: %v", repo.ID, err)
+		}
+		return event.ChangedPaths
+	}
+	tokenSeed := inst.ExternalID
+	if providerName != "github" {
+		tokenSeed = inst.AccessToken
+	}
+	token, err := provider.IssueCloneToken(ctx, tokenSeed)
+	if err != nil {
+		log.Printf("[webhook] clone token exchange failed for %s: %v", repo.ID, err)
+		return event.ChangedPaths
+	}
+	paths, err := differ.ChangedFiles(ctx, token, repo.Owner, repo.Name, event.BeforeSHA, event.Commit)
+	if err != nil {
+		log.Printf("[webhook] changed-file lookup failed for %s: %v", repo.ID, err)
+		return event.ChangedPaths
+	}
+	return paths
+}
+
+// handlePullRequestEvent opens or closes a preview environment as a
+// pull/merge request moves through its lifecycle. Event.Action is
+// normalized to the GitHub vocabulary by every Provider implementation.
+func (s *Server) handlePullRequestEvent(ctx context.Context, event providers.Event, response map[string]any) {
+	response["action"] = event.Action
+	response["pr_number"] = event.PRNumber
+	response["repository"] = event.Repository
+
+	owner, name, err := splitRepoFullName(event.Repository)
+	if err != nil {
+		log.Printf("[webhook] invalid repository name %s: %v", event.Repository, err)
+		return
+	}
+	repo, repoErr := s.store.GetRepository(repositoryID(owner, name))
+	switch {
+	case repoErr != nil:
+		if !errors.Is(repoErr, store.ErrNotFound) {
+			log.Printf("[webhook] repository lookup failed: %v", repoErr)
+		}
+	case len(repo.Services) == 0:
+		log.Printf("[webhook] repository %s has no linked service, ignoring pull_request", event.Repository)
+	default:
+		results := make([]map[string]any, 0, len(repo.Services))
+		for _, rs := range repo.Services {
+			service, svcErr := s.store.GetService(rs.ServiceID)
+			if svcErr != nil {
+				log.Printf("[webhook] linked service %s not found: %v", rs.ServiceID, svcErr)
+				continue
+			}
+			result := map[string]any{"service_id": rs.ServiceID}
+			switch event.Action {
+			case "opened", "reopened", "synchronize":
+				s.openPreviewEnvironment(ctx, repo, rs, service, event, result)
+			case "closed":
+				if closePreviewEnvironment(service, event.PRNumber, time.Now().UTC()) {
+					if err := s.store.UpdateService(service); err != nil {
+						log.Printf("[webhook] failed to close preview for PR #%d: %v", event.PRNumber, err)
+					} else {
+						s.version.bump()
+					}
 				}
+				s.enqueuePreviewTeardown(repo, rs, service, event, result)
 			}
+			results = append(results, result)
 		}
+		response["services"] = results
+	}
+}
+
+// handleInstallationEvent records an installation and reconciles the
+// repositories it grants access to, covering both GitHub's "installation"
+// webhook (App-level lifecycle) and "installation_repositories" webhook
+// (repo grants added/removed under an existing install) once normalized
+// into an Event.
+func (s *Server) handleInstallationEvent(providerName, externalInstallationID string, event providers.Event, response map[string]any) {
+	response["action"] = event.Action
+	response["repositories"] = event.Repos
+	response["removed"] = event.RemovedRepos
+
+	switch event.Action {
+	case "deleted", "suspend":
+		log.Printf("[webhook] installation %s event for %s, no store changes made", event.Action, event.Account)
+		return
+	}
+
+	if event.Account != "" && (externalInstallationID != "" || event.InstallationID != "") {
+		s.upsertInstallationFromEvent(providerName, event)
+	}
+
+	for _, repo := range event.Repos {
+		if repo.Owner == "" || repo.Name == "" {
+			continue
+		}
+		repoModel := &models.Repository{
+			ID:            repositoryID(repo.Owner, repo.Name),
+			Provider:      providerName,
+			Owner:         repo.Owner,
+			Name:          repo.Name,
+			DefaultBranch: repo.DefaultBranch,
+			Installation:  externalInstallationID,
+		}
+		if err := s.store.UpsertRepository(repoModel); err != nil {
+			log.Printf("[webhook] failed to register repository %s/%s: %v", repo.Owner, repo.Name, err)
+		}
+	}
+
+	for _, repo := range event.RemovedRepos {
+		if repo.Owner == "" || repo.Name == "" {
+			continue
+		}
+		id := repositoryID(repo.Owner, repo.Name)
+		if err := s.store.DeleteRepository(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("[webhook] failed to delete repository %s/%s: %v", repo.Owner, repo.Name, err)
+		}
+	}
+}
+
+func slugify(input string) string {
+	input = strings.TrimSpace(strings.ToLower(input))
+	input = strings.ReplaceAll(input, " ", "-")
+	input = strings.ReplaceAll(input, "_", "-")
+	return input
+}
+
+func repositoryID(owner, name string) string {
+	return sanitizeKey(owner) + "-" + sanitizeKey(name)
+}
+
+func installationID(account, external string) string {
+	return sanitizeKey(account) + "-" + sanitizeKey(external)
+}
+
+// splitRepoFullName splits "owner/name" or, for providers like GitLab that
+// allow nested groups, "group/subgroup/.../name" into an owner path and a
+// repository name.
+func splitRepoFullName(full string) (string, string, error) {
+	parts := strings.Split(full, "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("invalid repository name: %s", full)
+	}
+	name := strings.TrimSpace(parts[len(parts)-1])
+	owner := strings.TrimSpace(strings.Join(parts[:len(parts)-1], "/"))
+	if owner == "" || name == "" {
+		return "", "", fmt.Errorf("invalid repository name: %s", full)
+	}
+	return owner, name, nil
+}
+
+// normalizeGitRef strips the "refs/heads/" prefix GitHub sends on push
+// events so a ref can be compared against Repository.DefaultBranch.
+func normalizeGitRef(ref string) string {
+	return strings.TrimPrefix(ref, "refs/heads/")
+}
+
+// previewEnvironment names the per-PR environment preview Domains and
+// Deployments are filed under, so concurrently open PRs on the same
+// service don't collide on the single-slot-per-environment semantics
+// handleServiceDeployments already relies on.
+func previewEnvironment(prNumber int) string {
+	return fmt.Sprintf("preview-pr-%d", prNumber)
+}
+
+// resolvePreviewConfig returns the preview base domain and TTL that apply
+// to repo, letting repo's Installation override the server-wide defaults
+// so different GitHub App installs can cut previews from different
+// domains or retain them for different windows.
+func (s *Server) resolvePreviewConfig(repo *models.Repository) (baseDomain string, ttl time.Duration) {
+	baseDomain, ttl = s.previewBase, s.previewTTL
+	if repo == nil || repo.Installation == "" {
+		return baseDomain, ttl
+	}
+	inst, err := s.store.FindInstallationByExternalID(repo.Installation)
+	if err != nil {
+		return baseDomain, ttl
+	}
+	if inst.PreviewBaseDomain != "" {
+		baseDomain = inst.PreviewBaseDomain
+	}
+	if inst.PreviewTTL != "" {
+		if d, err := time.ParseDuration(inst.PreviewTTL); err == nil {
+			ttl = d
+		} else {
+			log.Printf("[webhook] installation %s has invalid preview_ttl %q: %v", inst.ID, inst.PreviewTTL, err)
+		}
+	}
+	return baseDomain, ttl
+}
+
+// openPreviewEnvironment materializes a preview Domain for the PR (if a
+// preview base domain is configured), enqueues a build tagged with the
+// PR's head commit, and best-effort refreshes the service's compose
+// file from that commit.
+func (s *Server) openPreviewEnvironment(ctx context.Context, repo *models.Repository, rs models.RepositoryService, service *models.Service, event providers.Event, response map[string]any) {
+	base, _ := s.resolvePreviewConfig(repo)
+	if base == "" {
+		log.Printf("[webhook] no preview base domain configured, skipping domain for PR #%d", event.PRNumber)
+	} else if materializePreviewDomain(service, event.PRNumber, base) {
+		if err := s.store.UpdateService(service); err != nil {
+			log.Printf("[webhook] failed to persist preview domain for PR #%d: %v", event.PRNumber, err)
+		} else {
+			s.version.bump()
+		}
+	}
+
+	job := &models.BuildJob{
+		ID:           newID(),
+		Repository:   repo.Owner + "/" + repo.Name,
+		Ref:          event.HeadRef,
+		Commit:       event.HeadSHA,
+		Provider:     repo.Provider,
+		Installation: repo.Installation,
+		Status:       "pending",
+		ServiceID:    service.ID,
+		Environment:  previewEnvironment(event.PRNumber),
+		ComposePath:  rs.ComposePath,
+		PullRequest:  event.PRNumber,
+	}
+	if applyCommitDirectives(job, event.Message) {
+		log.Printf("[webhook] preview build for PR #%d skipped via ci-skip commit-message directive", event.PRNumber)
+		response["skipped"] = "ci skip directive"
+		return
+	}
+	if len(job.Directives) > 0 {
+		response["directives"] = job.Directives
+	}
+	if err := s.store.CreateBuildJob(job); err != nil {
+		log.Printf("[webhook] failed to enqueue preview build for PR #%d: %v", event.PRNumber, err)
+	} else {
+		s.buildQueue.bump()
+		response["build_job_id"] = job.ID
+		s.reportCheckRun(ctx, job, "queued", "", fmt.Sprintf("preview build for PR #%d", event.PRNumber))
+	}
+
+	s.refreshServiceCompose(ctx, repo, rs, event.HeadSHA)
+}
+
+// enqueuePreviewTeardown dispatches a "teardown" BuildJob for the preview
+// environment a closed PR owned, so a worker tears its compose stack
+// down promptly instead of leaving it running until the TTL sweeper
+// reaps the now-closed Domain.
+func (s *Server) enqueuePreviewTeardown(repo *models.Repository, rs models.RepositoryService, service *models.Service, event providers.Event, response map[string]any) {
+	job := &models.BuildJob{
+		ID:           newID(),
+		Repository:   repo.Owner + "/" + repo.Name,
+		Commit:       event.HeadSHA,
+		Provider:     repo.Provider,
+		Installation: repo.Installation,
+		Status:       "pending",
+		ServiceID:    service.ID,
+		Environment:  previewEnvironment(event.PRNumber),
+		ComposePath:  rs.ComposePath,
+		PullRequest:  event.PRNumber,
+		Kind:         "teardown",
+	}
+	if err := s.store.CreateBuildJob(job); err != nil {
+		log.Printf("[webhook] failed to enqueue preview teardown for PR #%d: %v", event.PRNumber, err)
+		return
+	}
+	s.buildQueue.bump()
+	response["teardown_job_id"] = job.ID
+}
+
+// materializePreviewDomain appends an ephemeral "pr-<num>.<service>.<base>"
+// Domain for the PR's preview environment, unless one is already there. A
+// domain left over from a since-closed PR (e.g. someone pushed a new
+// commit before the sweeper reaped it) is revived in place rather than
+// duplicated. Reports whether it changed service.Domains.
+func materializePreviewDomain(service *models.Service, prNumber int, base string) bool {
+	env := previewEnvironment(prNumber)
+	for i, d := range service.Domains {
+		if d.Environment != env {
+			continue
+		}
+		if d.ClosedAt.IsZero() {
+			return false
+		}
+		service.Domains[i].ClosedAt = time.Time{}
+		return true
+	}
+	serviceKey := sanitizeKey(service.Name)
+	if serviceKey == "" {
+		serviceKey = sanitizeKey(service.ID)
+	}
+	service.Domains = append(service.Domains, models.Domain{
+		ID:          newID(),
+		ServiceID:   service.ID,
+		Environment: env,
+		Hostname:    fmt.Sprintf("pr-%d.%s.%s", prNumber, serviceKey, base),
+		CreatedAt:   time.Now().UTC(),
+	})
+	return true
+}
+
+// removePreviewEnvironments deletes every Domain and Deployment filed
+// under one of envs, so the next renderTraefikConfig no longer emits a
+// router for them. Reports whether it changed the service.
+func removePreviewEnvironments(service *models.Service, envs map[string]bool) bool {
+	if len(envs) == 0 {
+		return false
+	}
+	changed := false
+
+	domains := service.Domains[:0]
+	for _, d := range service.Domains {
+		if envs[d.Environment] {
+			changed = true
+			continue
+		}
+		domains = append(domains, d)
+	}
+	service.Domains = domains
+
+	deployments := service.Deployments[:0]
+	for _, d := range service.Deployments {
+		if envs[d.Environment] {
+			changed = true
+			continue
+		}
+		deployments = append(deployments, d)
+	}
+	service.Deployments = deployments
+
+	return changed
+}
+
+// closePreviewEnvironment marks the PR's preview Domain as closed rather
+// than deleting it outright, so a preview reopened (or given a new
+// commit) shortly after the PR closes can be revived by
+// materializePreviewDomain instead of losing its hostname. The sweeper
+// started by StartPreviewSweeper does the actual teardown once the
+// installation's preview TTL has elapsed. Reports whether it changed the
+// service.
+func closePreviewEnvironment(service *models.Service, prNumber int, closedAt time.Time) bool {
+	env := previewEnvironment(prNumber)
+	changed := false
+	for i, d := range service.Domains {
+		if d.Environment == env && d.ClosedAt.IsZero() {
+			service.Domains[i].ClosedAt = closedAt
+			changed = true
+		}
+	}
+	return changed
+}
+
+// sweepExpiredPreviews tears down every preview environment on service
+// whose Domain was closed more than ttl ago. Reports whether it changed
+// the service.
+func sweepExpiredPreviews(service *models.Service, now time.Time, ttl time.Duration) bool {
+	expired := map[string]bool{}
+	for _, d := range service.Domains {
+		if !d.ClosedAt.IsZero() && now.Sub(d.ClosedAt) >= ttl {
+			expired[d.Environment] = true
+		}
+	}
+	return removePreviewEnvironments(service, expired)
+}
+
+// StartPreviewSweeper runs sweepPreviews on interval until ctx is
+// canceled, reaping preview environments whose PR closed more than the
+// applicable installation's (or the server default) TTL ago. Callers
+// typically run this in a goroutine for the lifetime of the process,
+// same as the HTTP server itself. interval <= 0 uses
+// defaultPreviewSweepInterval.
+func (s *Server) StartPreviewSweeper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPreviewSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweepPreviews()
+			}
+		}
+	}()
+}
+
+// sweepPreviews walks every service and reaps expired preview
+// environments, resolving each service's TTL through the repo (if any)
+// linking it to a GitHub installation.
+func (s *Server) sweepPreviews() {
+	repos, err := s.store.ListRepositories()
+	if err != nil {
+		log.Printf("[preview-sweep] failed to list repositories: %v", err)
+		return
+	}
+	repoByService := make(map[string]*models.Repository, len(repos))
+	for _, repo := range repos {
+		for _, rs := range repo.Services {
+			if rs.ServiceID != "" {
+				repoByService[rs.ServiceID] = repo
+			}
+		}
+	}
+
+	projects, err := s.store.ListProjects()
+	if err != nil {
+		log.Printf("[preview-sweep] failed to list projects: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, project := range projects {
+		services, err := s.store.ListServicesByProject(project.ID)
+		if err != nil {
+			log.Printf("[preview-sweep] failed to list services for project %s: %v", project.ID, err)
+			continue
+		}
+		for _, service := range services {
+			_, ttl := s.resolvePreviewConfig(repoByService[service.ID])
+			if ttl <= 0 {
+				ttl = defaultPreviewTTL
+			}
+			if !sweepExpiredPreviews(service, now, ttl) {
+				continue
+			}
+			if err := s.store.UpdateService(service); err != nil {
+				log.Printf("[preview-sweep] failed to persist swept service %s: %v", service.ID, err)
+				continue
+			}
+			s.version.bump()
+		}
+	}
+}
+
+// refreshServiceCompose reads rs's compose file out of repo at commit via
+// the owning provider's clone token and stores it on rs's linked service,
+// so a build enqueued off this event builds from the compose that was
+// actually committed rather than a stale copy. No-op if the provider
+// isn't registered, doesn't support reading a file at a ref (only GitHub
+// does today), the repo has no installation, or rs isn't linked to a
+// service; failures are logged and otherwise swallowed since this is
+// best-effort freshness, not a precondition for the build job itself.
+func (s *Server) refreshServiceCompose(ctx context.Context, repo *models.Repository, rs models.RepositoryService, commit string) {
+	if repo.Installation == "" || rs.ServiceID == "" {
+		return
+	}
+	providerName := repo.Provider
+	if providerName == "" {
+		providerName = "github"
+	}
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return
+	}
+	fetcher, ok := provider.(providers.FileFetcher)
+	if !ok {
+		return
+	}
+	inst, err := s.store.FindInstallationByExternalID(repo.Installation)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("[webhook] installation lookup failed for %s: %v", repo.ID, err)
+		}
+		return
+	}
+	tokenSeed := inst.ExternalID
+	if providerName != "github" {
+		tokenSeed = inst.AccessToken
+	}
+	token, err := provider.IssueCloneToken(ctx, tokenSeed)
+	if err != nil {
+		log.Printf("[webhook] clone token exchange failed for %s: %v", repo.ID, err)
+		return
+	}
+	composePath := rs.ComposePath
+	if composePath == "" {
+		composePath = "docker-compose.yml"
+	}
+	content, err := fetcher.FetchFile(ctx, token, repo.Owner, repo.Name, composePath, commit)
+	if err != nil {
+		log.Printf("[webhook] failed to read %s at %s: %v", composePath, commit, err)
+		return
+	}
+	service, err := s.store.GetService(rs.ServiceID)
+	if err != nil {
+		log.Printf("[webhook] linked service %s not found: %v", rs.ServiceID, err)
+		return
+	}
+	if err := applyCompose(service, content); err != nil {
+		log.Printf("[webhook] invalid compose for service %s at %s: %v", rs.ServiceID, commit, err)
+		return
+	}
+	if err := s.store.UpdateService(service); err != nil {
+		log.Printf("[webhook] failed to persist compose for service %s: %v", rs.ServiceID, err)
+		return
+	}
+	s.version.bump()
+}
+
+// checkRunName is the check shown on a PR/commit for every BuildJob this
+// control plane reports progress for.
+const checkRunName = "infrctl build"
+
+// checkRunConclusion maps a terminal BuildJob.Status onto the GitHub
+// Checks API conclusion reported alongside status "completed".
+var checkRunConclusion = map[string]string{
+	"succeeded": "success",
+	"failed":    "failure",
+}
+
+// reportCheckRun surfaces job's status on its originating provider via
+// the optional ChecksReporter capability (GitHub today), creating a
+// check run the first time and PATCHing the same one (job.CheckRunID)
+// on every later call. Swallows and logs failures: a check-run update
+// is a nicety for the PR author, never a precondition for the build
+// itself, the same posture as refreshServiceCompose.
+func (s *Server) reportCheckRun(ctx context.Context, job *models.BuildJob, status, conclusion, summary string) {
+	if job.Installation == "" || job.Commit == "" || job.Kind == "teardown" {
+		return
+	}
+	providerName := job.Provider
+	if providerName == "" {
+		providerName = "github"
+	}
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return
+	}
+	reporter, ok := provider.(providers.ChecksReporter)
+	if !ok {
+		return
+	}
+	owner, name, err := splitRepoFullName(job.Repository)
+	if err != nil {
+		return
+	}
+	inst, err := s.store.FindInstallationByExternalID(job.Installation)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("[checks] installation lookup failed for job %s: %v", job.ID, err)
+		}
+		return
+	}
+	tokenSeed := inst.ExternalID
+	if providerName != "github" {
+		tokenSeed = inst.AccessToken
+	}
+	token, err := provider.IssueCloneToken(ctx, tokenSeed)
+	if err != nil {
+		log.Printf("[checks] token exchange failed for job %s: %v", job.ID, err)
+		return
+	}
+	checkRunID, err := reporter.ReportCheckRun(ctx, token, owner, name, job.Commit, job.CheckRunID, providers.CheckRunUpdate{
+		Name:       checkRunName,
+		Status:     status,
+		Conclusion: conclusion,
+		Summary:    summary,
+	})
+	if err != nil {
+		log.Printf("[checks] failed to report %s for job %s: %v", status, job.ID, err)
+		return
+	}
+	if checkRunID != job.CheckRunID {
+		job.CheckRunID = checkRunID
+		if err := s.store.UpdateBuildJob(job); err != nil {
+			log.Printf("[checks] failed to persist check run id for job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// upsertInstallationFromEvent records an installation discovered from a
+// GitHub "installation" webhook rather than a manual POST to
+// /v1/github/installations, so an App install works out of the box.
+// GitLab and Gitea have no equivalent app-level lifecycle event, so this
+// is only ever called with providerName "github". WebhookSecret and
+// AccessToken are left blank; operators who want signature verification
+// or file-fetch support still register those manually.
+func (s *Server) upsertInstallationFromEvent(providerName string, event providers.Event) {
+	if event.Account == "" || event.InstallationID == "" {
+		return
+	}
+	inst := &models.Installation{
+		ID:         installationID(event.Account, event.InstallationID),
+		Provider:   providerName,
+		Account:    event.Account,
+		ExternalID: event.InstallationID,
+	}
+	if err := s.store.UpsertInstallation(inst); err != nil {
+		log.Printf("[webhook] failed to upsert installation %s: %v", event.Account, err)
+	}
+}
+
+// enqueueRecheckBuild handles the "rerequested" action GitHub/Gitea send
+// for check_run/check_suite (normalized to Event.Kind "check"): a fresh
+// BuildJob for the same commit rather than waiting for another push.
+func (s *Server) enqueueRecheckBuild(ctx context.Context, providerName string, event providers.Event, response map[string]any) {
+	response["action"] = event.Action
+	response["repository"] = event.Repository
+	if event.Action != "rerequested" {
+		return
+	}
+	if event.Repository == "" || event.HeadSHA == "" {
+		log.Printf("[webhook] %s check rerequested with no commit, ignoring", providerName)
+		return
+	}
+	owner, name, err := splitRepoFullName(event.Repository)
+	if err != nil {
+		log.Printf("[webhook] invalid repository name %s: %v", event.Repository, err)
+		return
+	}
+	repo, err := s.store.GetRepository(repositoryID(owner, name))
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("[webhook] repository lookup failed: %v", err)
+		}
+		return
+	}
+	if len(repo.Services) == 0 {
+		log.Printf("[webhook] repository %s has no linked service, ignoring %s check", event.Repository, providerName)
+		return
+	}
+
+	var jobIDs []string
+	for _, rs := range repo.Services {
+		environment := rs.Environment
+		if event.PRNumber > 0 {
+			environment = previewEnvironment(event.PRNumber)
+		} else if environment == "" {
+			environment = "production"
+		}
+
+		job := &models.BuildJob{
+			ID:           newID(),
+			Repository:   event.Repository,
+			Commit:       event.HeadSHA,
+			Provider:     repo.Provider,
+			Installation: repo.Installation,
+			Status:       "pending",
+			ServiceID:    rs.ServiceID,
+			Environment:  environment,
+			ComposePath:  rs.ComposePath,
+			PullRequest:  event.PRNumber,
+		}
+		if err := s.store.CreateBuildJob(job); err != nil {
+			log.Printf("[webhook] failed to enqueue rerequested build for %s: %v", event.Repository, err)
+			continue
+		}
+		s.buildQueue.bump()
+		jobIDs = append(jobIDs, job.ID)
+		s.reportCheckRun(ctx, job, "queued", "", "rerequested")
+		s.refreshServiceCompose(ctx, repo, rs, event.HeadSHA)
+	}
+	if len(jobIDs) > 0 {
+		response["build_job_ids"] = jobIDs
 	}
-	return owner, name
-}
-
-func parseInstallationReposEvent(payload []byte) (installationReposInfo, error) {
-    var body struct {
-        Action string `json:"action"`
-        Repositories []struct {
-            FullName      string `json:"full_name"`
-            Name          string `json:"name"`
-            DefaultBranch string `json:"default_branch"`
-            Owner         struct {
-                Login string `json:"login"`
-            } `json:"owner"`
-        } `json:"repositories"`
-        RepositoriesAdded []struct {
-            FullName      string `json:"full_name"`
-            Name          string `json:"name"`
-            DefaultBranch string `json:"default_branch"`
-            Owner         struct {
-                Login string `json:"login"`
-            } `json:"owner"`
-        } `json:"repositories_added"`
-        RepositoriesRemoved []struct {
-            FullName      string `json:"full_name"`
-            Name          string `json:"name"`
-            DefaultBranch string `json:"default_branch"`
-            Owner         struct {
-                Login string `json:"login"`
-            } `json:"owner"`
-        } `json:"repositories_removed"`
-    }
-    if err := json.Unmarshal(payload, &body); err != nil {
-        return installationReposInfo{}, err
-    }
-
-    conv := func(full, owner, name, branch string) repoInfo {
-        if full == "" && owner != "" && name != "" {
-            full = owner + "/" + name
-        }
-        if branch == "" {
-            branch = "main"
-        }
-        return repoInfo{
-            FullName: full,
-            Owner:    owner,
-            Name:     name,
-            DefaultBranch: branch,
-        }
-    }
-
-    info := installationReposInfo{Action: body.Action}
-
-    for _, repo := range body.Repositories {
-        info.Existing = append(info.Existing, conv(repo.FullName, repo.Owner.Login, repo.Name, repo.DefaultBranch))
-    }
-    for _, repo := range body.RepositoriesAdded {
-        info.Added = append(info.Added, conv(repo.FullName, repo.Owner.Login, repo.Name, repo.DefaultBranch))
-    }
-    for _, repo := range body.RepositoriesRemoved {
-        info.Removed = append(info.Removed, conv(repo.FullName, repo.Owner.Login, repo.Name, repo.DefaultBranch))
-    }
-
-    return info, nil
 }
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// configVersion is a monotonically increasing counter bumped whenever a
+// mutation could change the rendered Traefik config or the agent's
+// service state feed. It backs both the `/v1/traefik/config?wait=&since=`
+// long-poll and the `/v1/events` SSE stream, so agents can react to
+// changes in sub-second time instead of waiting out a poll interval.
+type configVersion struct {
+	mu      sync.Mutex
+	current uint64
+	waiters map[chan uint64]struct{}
+}
+
+func newConfigVersion() *configVersion {
+	return &configVersion{waiters: make(map[chan uint64]struct{})}
+}
+
+// bump advances the version and wakes every long-poll and SSE waiter.
+func (c *configVersion) bump() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current++
+	v := c.current
+	for ch := range c.waiters {
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+	return v
+}
+
+// get returns the current version.
+func (c *configVersion) get() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+// wait blocks until the version advances past since, ctx is canceled, or
+// timeout elapses, returning whatever the version is at that point.
+func (c *configVersion) wait(ctx context.Context, since uint64, timeout <-chan struct{}) uint64 {
+	c.mu.Lock()
+	if c.current != since {
+		v := c.current
+		c.mu.Unlock()
+		return v
+	}
+	ch := make(chan uint64, 1)
+	c.waiters[ch] = struct{}{}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiters, ch)
+		c.mu.Unlock()
+	}()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-ctx.Done():
+		return c.get()
+	case <-timeout:
+		return c.get()
+	}
+}
+
+// timeoutChan adapts a time.Duration into the <-chan struct{} shape wait
+// expects, so callers can pass time.After-style deadlines without wait
+// itself depending on the concrete timer type.
+func timeoutChan(d time.Duration) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		time.Sleep(d)
+		close(ch)
+	}()
+	return ch
+}
+
+// subscribe registers a channel that receives every new version as it's
+// bumped, for the SSE stream. Callers must invoke cancel when done.
+func (c *configVersion) subscribe() (ch chan uint64, cancel func()) {
+	ch = make(chan uint64, 8)
+	c.mu.Lock()
+	c.waiters[ch] = struct{}{}
+	c.mu.Unlock()
+	return ch, func() {
+		c.mu.Lock()
+		delete(c.waiters, ch)
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"log"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
+)
+
+// traefikDynamic mirrors the subset of Traefik's dynamic configuration
+// file format this control plane emits. yaml.v3 sorts map keys on
+// marshal, so building these as plain maps (rather than hand-sorted
+// slices of pre-rendered blocks) keeps the output byte-for-byte
+// deterministic for the agent's version-hash comparison.
+type traefikDynamic struct {
+	HTTP *traefikHTTP `yaml:"http,omitempty"`
+	TCP  *traefikTCP  `yaml:"tcp,omitempty"`
+	UDP  *traefikUDP  `yaml:"udp,omitempty"`
+}
+
+type traefikHTTP struct {
+	Routers     map[string]httpRouter     `yaml:"routers"`
+	Services    map[string]httpService    `yaml:"services"`
+	Middlewares map[string]middlewareSpec `yaml:"middlewares,omitempty"`
+}
+
+type httpRouter struct {
+	Rule        string     `yaml:"rule"`
+	Service     string     `yaml:"service"`
+	EntryPoints []string   `yaml:"entryPoints"`
+	Middlewares []string   `yaml:"middlewares,omitempty"`
+	TLS         *routerTLS `yaml:"tls,omitempty"`
+}
+
+type routerTLS struct {
+	CertResolver string `yaml:"certResolver,omitempty"`
+}
+
+type httpService struct {
+	LoadBalancer loadBalancer `yaml:"loadBalancer"`
+}
+
+type loadBalancer struct {
+	Servers     []lbServer   `yaml:"servers"`
+	Sticky      *stickyConf  `yaml:"sticky,omitempty"`
+	HealthCheck *healthCheck `yaml:"healthCheck,omitempty"`
+}
+
+type lbServer struct {
+	URL string `yaml:"url"`
+}
+
+type stickyConf struct {
+	Cookie stickyCookie `yaml:"cookie"`
+}
+
+type stickyCookie struct {
+	Name string `yaml:"name"`
+}
+
+type healthCheck struct {
+	Path     string `yaml:"path"`
+	Interval string `yaml:"interval,omitempty"`
+	Timeout  string `yaml:"timeout,omitempty"`
+}
+
+// middlewareSpec is a Traefik middleware definition; exactly one field is
+// expected to be set per models.Middleware entry.
+type middlewareSpec struct {
+	RedirectScheme *redirectSchemeConf `yaml:"redirectScheme,omitempty"`
+	RateLimit      *rateLimitConf      `yaml:"rateLimit,omitempty"`
+	BasicAuth      *basicAuthConf      `yaml:"basicAuth,omitempty"`
+	IPAllowList    *ipAllowListConf    `yaml:"ipAllowList,omitempty"`
+	Compress       *compressConf       `yaml:"compress,omitempty"`
+	Headers        *headersConf        `yaml:"headers,omitempty"`
+}
+
+type redirectSchemeConf struct {
+	Scheme    string `yaml:"scheme"`
+	Permanent bool   `yaml:"permanent"`
+}
+
+type rateLimitConf struct {
+	Average int `yaml:"average"`
+	Burst   int `yaml:"burst,omitempty"`
+}
+
+type basicAuthConf struct {
+	Users []string `yaml:"users"`
+}
+
+type ipAllowListConf struct {
+	SourceRange []string `yaml:"sourceRange"`
+}
+
+type compressConf struct{}
+
+type headersConf struct {
+	CustomResponseHeaders map[string]string `yaml:"customResponseHeaders,omitempty"`
+}
+
+type traefikTCP struct {
+	Routers  map[string]tcpRouter  `yaml:"routers"`
+	Services map[string]tcpService `yaml:"services"`
+}
+
+type tcpRouter struct {
+	Rule        string   `yaml:"rule"`
+	Service     string   `yaml:"service"`
+	EntryPoints []string `yaml:"entryPoints"`
+}
+
+type tcpService struct {
+	LoadBalancer tcpLoadBalancer `yaml:"loadBalancer"`
+}
+
+type tcpLoadBalancer struct {
+	Servers []tcpServer `yaml:"servers"`
+}
+
+type tcpServer struct {
+	Address string `yaml:"address"`
+}
+
+type traefikUDP struct {
+	Routers  map[string]udpRouter  `yaml:"routers"`
+	Services map[string]udpService `yaml:"services"`
+}
+
+type udpRouter struct {
+	Service     string   `yaml:"service"`
+	EntryPoints []string `yaml:"entryPoints"`
+}
+
+type udpService struct {
+	LoadBalancer udpLoadBalancer `yaml:"loadBalancer"`
+}
+
+type udpLoadBalancer struct {
+	Servers []udpServer `yaml:"servers"`
+}
+
+type udpServer struct {
+	Address string `yaml:"address"`
+}
+
+// renderTraefikConfig builds the Traefik dynamic config for every Service
+// across every project: one HTTP router per Domain (or, for compose-based
+// services, one per compose service's mdp.domain hostnames), plus whatever
+// middlewares, sticky sessions, health checks, and TCP/UDP routes those
+// services declare. resolver is the cert resolver used when a Domain
+// doesn't override it.
+func renderTraefikConfig(services []*models.Service, resolver string) string {
+	if resolver == "" {
+		resolver = "le"
+	}
+
+	http := &traefikHTTP{
+		Routers:     map[string]httpRouter{},
+		Services:    map[string]httpService{},
+		Middlewares: map[string]middlewareSpec{},
+	}
+	var tcp *traefikTCP
+	var udp *traefikUDP
+
+	for _, svc := range services {
+		if svc == nil {
+			continue
+		}
+		baseKey := sanitizeKey(svc.Name)
+		if baseKey == "" {
+			baseKey = sanitizeKey(svc.ID)
+		}
+
+		for _, mw := range svc.Middlewares {
+			name := sanitizeKey(mw.Name)
+			if name == "" {
+				continue
+			}
+			http.Middlewares[name] = renderMiddleware(mw)
+		}
+
+		if len(svc.ComposeServices) == 0 {
+			port := svc.InternalPort
+			if port == 0 {
+				port = 80
+			}
+			http.Services[baseKey] = renderHTTPService(port, svc.StickySessions, svc.HealthCheck)
+
+			for _, domain := range svc.Domains {
+				routerName := baseKey + "-" + sanitizeKey(domain.Environment) + "-" + sanitizeKey(domain.Hostname)
+				if routerName == "" {
+					routerName = baseKey + "-" + newID()
+				}
+				http.Routers[routerName] = renderHTTPRouter(domain.Hostname, baseKey, domain.CertResolver, domain.Middlewares, resolver)
+			}
+		} else {
+			// Multi-container stacks get one Traefik service per compose
+			// service, routed to that container's own port and mdp.domain
+			// hostnames rather than the parent Service's.
+			for _, compSvc := range svc.ComposeServices {
+				serviceKey := baseKey + "-" + sanitizeKey(compSvc.Name)
+				port := compSvc.InternalPort
+				if port == 0 {
+					port = 80
+				}
+				http.Services[serviceKey] = renderHTTPService(port, svc.StickySessions, svc.HealthCheck)
+
+				for _, hostname := range compSvc.Domains {
+					routerName := serviceKey + "-" + sanitizeKey(hostname)
+					if routerName == "" {
+						routerName = serviceKey + "-" + newID()
+					}
+					http.Routers[routerName] = renderHTTPRouter(hostname, serviceKey, "", nil, resolver)
+				}
+			}
+		}
+
+		if route := svc.TCPRoute; route != nil {
+			if tcp == nil {
+				tcp = &traefikTCP{Routers: map[string]tcpRouter{}, Services: map[string]tcpService{}}
+			}
+			tcp.Services[baseKey] = tcpService{LoadBalancer: tcpLoadBalancer{Servers: []tcpServer{{Address: fmtAddr(route.Port)}}}}
+			tcp.Routers[baseKey] = tcpRouter{Rule: "HostSNI(`*`)", Service: baseKey, EntryPoints: []string{route.EntryPoint}}
+		}
+		if route := svc.UDPRoute; route != nil {
+			if udp == nil {
+				udp = &traefikUDP{Routers: map[string]udpRouter{}, Services: map[string]udpService{}}
+			}
+			udp.Services[baseKey] = udpService{LoadBalancer: udpLoadBalancer{Servers: []udpServer{{Address: fmtAddr(route.Port)}}}}
+			udp.Routers[baseKey] = udpRouter{Service: baseKey, EntryPoints: []string{route.EntryPoint}}
+		}
+	}
+
+	out, err := yaml.Marshal(&traefikDynamic{HTTP: http, TCP: tcp, UDP: udp})
+	if err != nil {
+		log.Printf("[traefik] failed to marshal dynamic config: %v", err)
+		return "http:\n  routers: {}\n  services: {}\n"
+	}
+	return string(out)
+}
+
+func renderHTTPRouter(hostname, serviceKey, certResolver string, middlewares []string, defaultResolver string) httpRouter {
+	resolver := certResolver
+	if resolver == "" {
+		resolver = defaultResolver
+	}
+	return httpRouter{
+		Rule:        "Host(`" + hostname + "`)",
+		Service:     serviceKey,
+		EntryPoints: []string{"websecure"},
+		Middlewares: middlewares,
+		TLS:         &routerTLS{CertResolver: resolver},
+	}
+}
+
+func renderHTTPService(port int, sticky bool, hc *models.ServiceHealthCheck) httpService {
+	lb := loadBalancer{Servers: []lbServer{{URL: "http://127.0.0.1:" + strconv.Itoa(port)}}}
+	if sticky {
+		lb.Sticky = &stickyConf{Cookie: stickyCookie{Name: "mdp_sticky"}}
+	}
+	if hc != nil {
+		lb.HealthCheck = &healthCheck{Path: hc.Path, Interval: hc.Interval, Timeout: hc.Timeout}
+	}
+	return httpService{LoadBalancer: lb}
+}
+
+func renderMiddleware(mw models.Middleware) middlewareSpec {
+	var spec middlewareSpec
+	switch {
+	case mw.RedirectToHTTPS:
+		spec.RedirectScheme = &redirectSchemeConf{Scheme: "https", Permanent: true}
+	case mw.RateLimit != nil:
+		spec.RateLimit = &rateLimitConf{Average: mw.RateLimit.Average, Burst: mw.RateLimit.Burst}
+	case len(mw.BasicAuthUsers) > 0:
+		spec.BasicAuth = &basicAuthConf{Users: mw.BasicAuthUsers}
+	case len(mw.IPAllowList) > 0:
+		spec.IPAllowList = &ipAllowListConf{SourceRange: mw.IPAllowList}
+	case mw.Compress:
+		spec.Compress = &compressConf{}
+	case len(mw.ResponseHeaders) > 0:
+		spec.Headers = &headersConf{CustomResponseHeaders: mw.ResponseHeaders}
+	}
+	return spec
+}
+
+func fmtAddr(port int) string {
+	return "127.0.0.1:" + strconv.Itoa(port)
+}
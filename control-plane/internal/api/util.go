@@ -8,72 +8,53 @@ import (
 	"strings"
 	"time"
 
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/compose"
 	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
 )
 
-func newID() string {
-	b := make([]byte, 12)
-	if _, err := rand.Read(b); err != nil {
-		return strconv.FormatInt(time.Now().UnixNano(), 16)
+// applyCompose parses and validates raw compose YAML and, on success,
+// stores it on service along with the per-container routing metadata
+// renderTraefikConfig needs. It leaves service untouched on error so
+// callers can reject the request without partially updating state.
+func applyCompose(service *models.Service, raw string) error {
+	if raw == "" {
+		service.Compose = ""
+		service.ComposeServices = nil
+		return nil
 	}
-	return hex.EncodeToString(b)
-}
 
-func renderTraefikConfig(services []*models.Service, resolver string) string {
-	if resolver == "" {
-		resolver = "le"
+	project, err := compose.Parse(raw, service.Secrets)
+	if err != nil {
+		return err
 	}
 
-	var routerBlocks []string
-	var serviceBlocks []string
-
-	for _, svc := range services {
-		if svc == nil {
-			continue
-		}
-		serviceKey := sanitizeKey(svc.Name)
-		if serviceKey == "" {
-			serviceKey = sanitizeKey(svc.ID)
-		}
-		port := svc.InternalPort
-		if port == 0 {
-			port = 80
-		}
-
-		serviceBlocks = append(serviceBlocks, renderServiceBlock(serviceKey, port))
+	names := make([]string, 0, len(project.Services))
+	for name := range project.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-		for _, domain := range svc.Domains {
-			routerName := serviceKey + "-" + sanitizeKey(domain.Environment) + "-" + sanitizeKey(domain.Hostname)
-			if routerName == "" {
-				routerName = serviceKey + "-" + newID()
-			}
-			routerBlocks = append(routerBlocks, renderRouterBlock(routerName, domain.Hostname, serviceKey, resolver))
-		}
+	composeServices := make([]models.ComposeService, 0, len(names))
+	for _, name := range names {
+		svc := project.Services[name]
+		composeServices = append(composeServices, models.ComposeService{
+			Name:         svc.Name,
+			InternalPort: svc.InternalPort,
+			Domains:      svc.Domains,
+		})
 	}
 
-	sort.Strings(routerBlocks)
-	sort.Strings(serviceBlocks)
+	service.Compose = raw
+	service.ComposeServices = composeServices
+	return nil
+}
 
-	var builder strings.Builder
-	builder.WriteString("http:\n")
-	builder.WriteString("  routers:\n")
-	if len(routerBlocks) == 0 {
-		builder.WriteString("    {}\n")
-	} else {
-		for _, block := range routerBlocks {
-			builder.WriteString(block)
-		}
-	}
-	builder.WriteString("  services:\n")
-	if len(serviceBlocks) == 0 {
-		builder.WriteString("    {}\n")
-	} else {
-		for _, block := range serviceBlocks {
-			builder.WriteString(block)
-		}
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
 	}
-
-	return builder.String()
+	return hex.EncodeToString(b)
 }
 
 func sanitizeKey(value string) string {
@@ -88,36 +69,3 @@ func sanitizeKey(value string) string {
 	}
 	return strings.Trim(builder.String(), "-")
 }
-
-func renderRouterBlock(name, hostname, serviceKey, resolver string) string {
-	var builder strings.Builder
-	builder.WriteString("    ")
-	builder.WriteString(name)
-	builder.WriteString(":\n")
-	builder.WriteString("      rule: Host(`")
-	builder.WriteString(hostname)
-	builder.WriteString("`)\n")
-	builder.WriteString("      service: ")
-	builder.WriteString(serviceKey)
-	builder.WriteString("\n")
-	builder.WriteString("      entryPoints:\n")
-	builder.WriteString("        - websecure\n")
-	builder.WriteString("      tls:\n")
-	builder.WriteString("        certResolver: ")
-	builder.WriteString(resolver)
-	builder.WriteString("\n")
-	return builder.String()
-}
-
-func renderServiceBlock(name string, port int) string {
-	var builder strings.Builder
-	builder.WriteString("    ")
-	builder.WriteString(name)
-	builder.WriteString(":\n")
-	builder.WriteString("      loadBalancer:\n")
-	builder.WriteString("        servers:\n")
-	builder.WriteString("          - url: http://127.0.0.1:")
-	builder.WriteString(strconv.Itoa(port))
-	builder.WriteString("\n")
-	return builder.String()
-}
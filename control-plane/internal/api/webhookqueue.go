@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/providers"
+)
+
+// defaultWebhookQueueWorkers bounds how many webhook tasks dispatchProviderEvent
+// runs concurrently, so a burst of redeliveries can't pile up unbounded
+// goroutines against the store.
+const defaultWebhookQueueWorkers = 4
+
+// webhookQueueBuffer is how many persisted-but-unclaimed tasks may sit in
+// the in-memory channel before submit blocks; sized generously since the
+// slow part (dispatchProviderEvent) already happened synchronously before
+// this existed, so callers tolerate some queueing.
+const webhookQueueBuffer = 256
+
+// webhookQueue decouples the HTTP handler from applying a parsed webhook
+// event's store side effects (repo upsert, BuildJob creation, Checks
+// reporting), so a redelivery-heavy webhook doesn't tie up request
+// goroutines and the handler returns as soon as the task is persisted.
+// Every task is saved via the store before being handed to a worker, so
+// ReplayPendingWebhookTasks can pick it back up if the process restarts
+// before a worker gets to it.
+type webhookQueue struct {
+	tasks chan *models.WebhookTask
+}
+
+func newWebhookQueue(workers int, handle func(context.Context, *models.WebhookTask)) *webhookQueue {
+	if workers <= 0 {
+		workers = defaultWebhookQueueWorkers
+	}
+	q := &webhookQueue{tasks: make(chan *models.WebhookTask, webhookQueueBuffer)}
+	for i := 0; i < workers; i++ {
+		go q.run(handle)
+	}
+	return q
+}
+
+func (q *webhookQueue) run(handle func(context.Context, *models.WebhookTask)) {
+	for task := range q.tasks {
+		handle(context.Background(), task)
+	}
+}
+
+// submit hands task to a worker, blocking only if every worker and the
+// buffer are saturated - which just reproduces the backpressure the old
+// inline handler already had, rather than ever dropping a delivery.
+func (q *webhookQueue) submit(task *models.WebhookTask) {
+	q.tasks <- task
+}
+
+// processWebhookTask decodes task's stored event and runs the same store
+// side effects dispatchProviderEvent always has, then persists the
+// outcome so a redelivered request replays cleanly and ReplayPendingWebhookTasks
+// doesn't requeue work that already completed.
+func (s *Server) processWebhookTask(ctx context.Context, task *models.WebhookTask) {
+	var event providers.Event
+	if err := json.Unmarshal([]byte(task.EventJSON), &event); err != nil {
+		log.Printf("[webhook] task %s: invalid stored event: %v", task.ID, err)
+		task.Status = "failed"
+		task.Error = err.Error()
+		if err := s.store.UpdateWebhookTask(task); err != nil {
+			log.Printf("[webhook] task %s: failed to persist failure: %v", task.ID, err)
+		}
+		return
+	}
+
+	response := map[string]any{}
+	s.dispatchProviderEvent(ctx, task.Provider, task.ExternalInstallationID, event, response)
+
+	task.Status = "done"
+	task.ProcessedAt = time.Now().UTC()
+	if err := s.store.UpdateWebhookTask(task); err != nil {
+		log.Printf("[webhook] task %s: failed to persist completion: %v", task.ID, err)
+	}
+}
+
+// ReplayPendingWebhookTasks re-enqueues any WebhookTask a prior process
+// left "pending", so an event persisted just before a crash or restart
+// isn't silently dropped. Call once at startup, after Handler() has wired
+// up routes but before traffic starts flowing.
+func (s *Server) ReplayPendingWebhookTasks() {
+	tasks, err := s.store.ListPendingWebhookTasks()
+	if err != nil {
+		log.Printf("[webhook] failed to list pending webhook tasks: %v", err)
+		return
+	}
+	for _, task := range tasks {
+		log.Printf("[webhook] replaying pending task %s (%s)", task.ID, task.Provider)
+		s.webhookQueue.submit(task)
+	}
+}
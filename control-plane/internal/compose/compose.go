@@ -0,0 +1,394 @@
+// Package compose parses and validates Compose Specification YAML and
+// derives the routing metadata the control plane needs from it: which
+// internal port a service listens on and which hostnames it should answer
+// to, read off `ports`/`expose` and the `mdp.domain` label.
+package compose
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Project is a parsed and validated compose file.
+type Project struct {
+	Name     string
+	Services map[string]Service
+	Networks map[string]struct{}
+	Volumes  map[string]struct{}
+}
+
+// Service is one compose service plus the routing metadata the control
+// plane derives from it.
+type Service struct {
+	Name        string
+	Image       string
+	Build       string
+	Ports       []PortMapping
+	Expose      []int
+	Environment map[string]string
+	Labels      map[string]string
+	HealthCheck *HealthCheck
+
+	// InternalPort is the container port Traefik should route to: the
+	// first published port's target, falling back to the first exposed
+	// port. Zero if the service declares neither.
+	InternalPort int
+	// Domains is the hostnames pulled from the mdp.domain label, split on
+	// commas, e.g. mdp.domain=foo.example.com,www.foo.example.com.
+	Domains []string
+}
+
+// PortMapping is one entry of a service's `ports` list.
+type PortMapping struct {
+	Published int
+	Target    int
+}
+
+// HealthCheck is a service's `healthcheck` block.
+type HealthCheck struct {
+	Test     []string
+	Interval string
+	Timeout  string
+	Retries  int
+}
+
+// ValidationError points at the offending service/key so callers can
+// surface exactly what's wrong instead of a generic parse failure.
+type ValidationError struct {
+	Service string
+	Key     string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Service == "":
+		return e.Message
+	case e.Key == "":
+		return fmt.Sprintf("service %q: %s", e.Service, e.Message)
+	default:
+		return fmt.Sprintf("service %q: %s: %s", e.Service, e.Key, e.Message)
+	}
+}
+
+// rawDocument mirrors the subset of the Compose Specification this package
+// understands.
+type rawDocument struct {
+	Name     string                `yaml:"name"`
+	Services map[string]rawService `yaml:"services"`
+	Networks map[string]any        `yaml:"networks"`
+	Volumes  map[string]any        `yaml:"volumes"`
+}
+
+type rawService struct {
+	Image       string          `yaml:"image"`
+	Build       any             `yaml:"build"`
+	Ports       []string        `yaml:"ports"`
+	Expose      []string        `yaml:"expose"`
+	Environment any             `yaml:"environment"`
+	Labels      any             `yaml:"labels"`
+	HealthCheck *rawHealthCheck `yaml:"healthcheck"`
+}
+
+type rawHealthCheck struct {
+	Test     any    `yaml:"test"`
+	Interval string `yaml:"interval"`
+	Timeout  string `yaml:"timeout"`
+	Retries  int    `yaml:"retries"`
+}
+
+// Parse parses and validates compose YAML, interpolating ${VAR},
+// ${VAR:-default} and ${VAR-default} references against env before
+// unmarshalling, the same way docker compose resolves them against the
+// shell/.env.
+func Parse(raw string, env map[string]string) (*Project, error) {
+	var doc rawDocument
+	if err := yaml.Unmarshal([]byte(interpolate(raw, env)), &doc); err != nil {
+		return nil, &ValidationError{Message: fmt.Sprintf("invalid yaml: %v", err)}
+	}
+	if len(doc.Services) == 0 {
+		return nil, &ValidationError{Message: "no services defined"}
+	}
+
+	project := &Project{
+		Name:     doc.Name,
+		Services: make(map[string]Service, len(doc.Services)),
+		Networks: make(map[string]struct{}, len(doc.Networks)),
+		Volumes:  make(map[string]struct{}, len(doc.Volumes)),
+	}
+	for name := range doc.Networks {
+		project.Networks[name] = struct{}{}
+	}
+	for name := range doc.Volumes {
+		project.Volumes[name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(doc.Services))
+	for name := range doc.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		svc, err := parseService(name, doc.Services[name])
+		if err != nil {
+			return nil, err
+		}
+		project.Services[name] = svc
+	}
+	return project, nil
+}
+
+func parseService(name string, raw rawService) (Service, error) {
+	if raw.Image == "" && raw.Build == nil {
+		return Service{}, &ValidationError{Service: name, Key: "image", Message: "service must set image or build"}
+	}
+
+	ports, err := parsePortMappings(name, raw.Ports)
+	if err != nil {
+		return Service{}, err
+	}
+	expose, err := parseExposePorts(name, raw.Expose)
+	if err != nil {
+		return Service{}, err
+	}
+	env, err := parseStringMap(raw.Environment)
+	if err != nil {
+		return Service{}, &ValidationError{Service: name, Key: "environment", Message: err.Error()}
+	}
+	labels, err := parseStringMap(raw.Labels)
+	if err != nil {
+		return Service{}, &ValidationError{Service: name, Key: "labels", Message: err.Error()}
+	}
+
+	var health *HealthCheck
+	if raw.HealthCheck != nil {
+		test, err := parseStringList(raw.HealthCheck.Test)
+		if err != nil {
+			return Service{}, &ValidationError{Service: name, Key: "healthcheck.test", Message: err.Error()}
+		}
+		health = &HealthCheck{
+			Test:     test,
+			Interval: raw.HealthCheck.Interval,
+			Timeout:  raw.HealthCheck.Timeout,
+			Retries:  raw.HealthCheck.Retries,
+		}
+	}
+
+	svc := Service{
+		Name:        name,
+		Image:       raw.Image,
+		Build:       buildContext(raw.Build),
+		Ports:       ports,
+		Expose:      expose,
+		Environment: env,
+		Labels:      labels,
+		HealthCheck: health,
+	}
+	svc.InternalPort = derivePort(svc)
+	svc.Domains = deriveDomains(labels)
+	return svc, nil
+}
+
+func buildContext(raw any) string {
+	switch b := raw.(type) {
+	case string:
+		return b
+	case map[string]any:
+		if ctx, ok := b["context"].(string); ok {
+			return ctx
+		}
+	}
+	return ""
+}
+
+// derivePort picks the container port Traefik should route to: the target
+// of the first published port mapping, falling back to the first exposed
+// port.
+func derivePort(svc Service) int {
+	if len(svc.Ports) > 0 {
+		return svc.Ports[0].Target
+	}
+	if len(svc.Expose) > 0 {
+		return svc.Expose[0]
+	}
+	return 0
+}
+
+// deriveDomains reads the mdp.domain label, a comma-separated list of
+// hostnames this service should be routed to, e.g.
+// mdp.domain=foo.example.com,www.foo.example.com.
+func deriveDomains(labels map[string]string) []string {
+	raw, ok := labels["mdp.domain"]
+	if !ok || raw == "" {
+		return nil
+	}
+	var domains []string
+	for _, host := range strings.Split(raw, ",") {
+		host = strings.TrimSpace(host)
+		if host != "" {
+			domains = append(domains, host)
+		}
+	}
+	return domains
+}
+
+// parsePortMappings parses `ports` entries of the form
+// "[host_ip:][published:]target[/protocol]", e.g. "8080:80", "80",
+// "127.0.0.1:8080:80/tcp".
+func parsePortMappings(service string, raw []string) ([]PortMapping, error) {
+	var mappings []PortMapping
+	for _, entry := range raw {
+		spec := entry
+		if slash := strings.IndexByte(spec, '/'); slash != -1 {
+			spec = spec[:slash]
+		}
+		parts := strings.Split(spec, ":")
+		var published, target string
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		case 2:
+			published, target = parts[0], parts[1]
+		case 3:
+			published, target = parts[1], parts[2]
+		default:
+			return nil, &ValidationError{Service: service, Key: "ports", Message: fmt.Sprintf("invalid port mapping %q", entry)}
+		}
+
+		targetPort, err := parsePort(target)
+		if err != nil {
+			return nil, &ValidationError{Service: service, Key: "ports", Message: fmt.Sprintf("invalid port mapping %q: %v", entry, err)}
+		}
+		mapping := PortMapping{Target: targetPort}
+		if published != "" {
+			publishedPort, err := parsePort(published)
+			if err != nil {
+				return nil, &ValidationError{Service: service, Key: "ports", Message: fmt.Sprintf("invalid port mapping %q: %v", entry, err)}
+			}
+			mapping.Published = publishedPort
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// parseExposePorts parses `expose` entries of the form "port[/protocol]".
+func parseExposePorts(service string, raw []string) ([]int, error) {
+	var ports []int
+	for _, entry := range raw {
+		spec := entry
+		if slash := strings.IndexByte(spec, '/'); slash != -1 {
+			spec = spec[:slash]
+		}
+		port, err := parsePort(spec)
+		if err != nil {
+			return nil, &ValidationError{Service: service, Key: "expose", Message: fmt.Sprintf("invalid exposed port %q: %v", entry, err)}
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("not a number")
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("out of range")
+	}
+	return port, nil
+}
+
+// parseStringMap accepts either the mapping form (KEY: value) or the list
+// form (["KEY=value"]) compose allows for `environment` and `labels`.
+func parseStringMap(raw any) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	out := map[string]string{}
+	switch v := raw.(type) {
+	case map[string]any:
+		for key, value := range v {
+			out[key] = fmt.Sprintf("%v", value)
+		}
+	case []any:
+		for _, entry := range v {
+			s, ok := entry.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a string entry, got %v", entry)
+			}
+			key, value, _ := strings.Cut(s, "=")
+			out[key] = value
+		}
+	default:
+		return nil, fmt.Errorf("expected a mapping or list")
+	}
+	return out, nil
+}
+
+// parseStringList accepts either the shell form (a single string) or the
+// exec form (a list of strings) compose allows for `healthcheck.test`.
+func parseStringList(raw any) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	switch v := raw.(type) {
+	case string:
+		return []string{v}, nil
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, entry := range v {
+			s, ok := entry.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a string entry, got %v", entry)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("expected a string or list")
+	}
+}
+
+// interpVarPattern matches ${VAR}, ${VAR:-default}, ${VAR-default} and
+// bare $VAR references.
+var interpVarPattern = regexp.MustCompile(`\$\{(\w+)(:?-)([^}]*)\}|\$\{(\w+)\}|\$(\w+)`)
+
+// interpolate substitutes ${VAR}-style references against env, mirroring
+// the subset of envsubst/shell parameter expansion docker compose itself
+// supports: ${VAR:-default} falls back to default when VAR is unset or
+// empty, ${VAR-default} only when VAR is unset.
+func interpolate(raw string, env map[string]string) string {
+	return interpVarPattern.ReplaceAllStringFunc(raw, func(match string) string {
+		m := interpVarPattern.FindStringSubmatch(match)
+		name, op, def := m[1], m[2], m[3]
+		if name == "" {
+			name = m[4]
+		}
+		if name == "" {
+			name = m[5]
+		}
+		value, present := env[name]
+		switch {
+		case op == ":-":
+			if !present || value == "" {
+				return def
+			}
+			return value
+		case op == "-":
+			if !present {
+				return def
+			}
+			return value
+		default:
+			return value
+		}
+	})
+}
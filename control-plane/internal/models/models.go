@@ -12,74 +12,291 @@ type Project struct {
 
 // Service represents a deployable unit within a project.
 type Service struct {
-	ID           string       `json:"id"`
-	ProjectID    string       `json:"project_id"`
-	Name         string       `json:"name"`
-	Image        string       `json:"image"`
-	InternalPort int          `json:"internal_port"`
-	Compose      string       `json:"compose"`
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
-	Domains      []Domain     `json:"domains"`
-	Deployments  []Deployment `json:"deployments"`
+	ID              string              `json:"id"`
+	ProjectID       string              `json:"project_id"`
+	Name            string              `json:"name"`
+	Image           string              `json:"image"`
+	InternalPort    int                 `json:"internal_port"`
+	Compose         string              `json:"compose"`
+	ComposeServices []ComposeService    `json:"compose_services,omitempty"` // derived from Compose on validation; drives per-container Traefik routing
+	Secrets         map[string]string   `json:"secrets,omitempty"`          // build-time secrets, injected into build jobs and never returned by GET handlers
+	Middlewares     []Middleware        `json:"middlewares,omitempty"`      // named middleware chain; Domain.Middlewares references entries by Name
+	StickySessions  bool                `json:"sticky_sessions,omitempty"`
+	HealthCheck     *ServiceHealthCheck `json:"health_check,omitempty"`
+	TCPRoute        *TCPRoute           `json:"tcp_route,omitempty"` // non-HTTP passthrough, e.g. a database or message broker
+	UDPRoute        *UDPRoute           `json:"udp_route,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+	Domains         []Domain            `json:"domains"`
+	Deployments     []Deployment        `json:"deployments"`
+}
+
+// Middleware is a named Traefik middleware definition. Exactly one of its
+// fields should be set; Domain.Middlewares references these by Name to
+// build a router's middleware chain.
+type Middleware struct {
+	Name            string            `json:"name"`
+	RedirectToHTTPS bool              `json:"redirect_to_https,omitempty"`
+	RateLimit       *RateLimit        `json:"rate_limit,omitempty"`
+	BasicAuthUsers  []string          `json:"basic_auth_users,omitempty"` // htpasswd-style "user:hashed-password" entries
+	IPAllowList     []string          `json:"ip_allow_list,omitempty"`    // CIDRs permitted to reach the router
+	Compress        bool              `json:"compress,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+}
+
+// RateLimit is a token-bucket limit applied by a rate-limit Middleware.
+type RateLimit struct {
+	Average int `json:"average"` // sustained requests/s
+	Burst   int `json:"burst,omitempty"`
+}
+
+// ServiceHealthCheck drives Traefik's active backend health checks, so a
+// failing container is pulled out of the load balancer instead of eating
+// requests until the next deploy.
+type ServiceHealthCheck struct {
+	Path     string `json:"path"`
+	Interval string `json:"interval,omitempty"` // Traefik duration string, e.g. "10s"
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+// TCPRoute exposes a service on a raw TCP entrypoint instead of routing it
+// through the HTTP(S) routers, for protocols like Postgres or Redis.
+type TCPRoute struct {
+	EntryPoint string `json:"entry_point"` // Traefik static entrypoint name, e.g. "postgres"
+	Port       int    `json:"port"`        // container port to forward to
+}
+
+// UDPRoute exposes a service on a raw UDP entrypoint.
+type UDPRoute struct {
+	EntryPoint string `json:"entry_point"`
+	Port       int    `json:"port"`
+}
+
+// ComposeService is the routing metadata derived from one service in
+// Service.Compose: its internal port and the hostnames its mdp.domain
+// label requests. Traefik config rendering emits one service block per
+// ComposeService so multi-container stacks route to the right container.
+type ComposeService struct {
+	Name         string   `json:"name"`
+	InternalPort int      `json:"internal_port"`
+	Domains      []string `json:"domains,omitempty"`
 }
 
 // Domain ties a hostname to a service in an environment.
 type Domain struct {
-	ID          string    `json:"id"`
-	ServiceID   string    `json:"service_id"`
-	Environment string    `json:"environment"`
-	Hostname    string    `json:"hostname"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID           string    `json:"id"`
+	ServiceID    string    `json:"service_id"`
+	Environment  string    `json:"environment"`
+	Hostname     string    `json:"hostname"`
+	CertResolver string    `json:"cert_resolver,omitempty"` // overrides the control plane default, e.g. a DNS-01 resolver for wildcard hosts
+	Middlewares  []string  `json:"middlewares,omitempty"`   // Middleware.Name values, applied to this domain's router in order
+	CreatedAt    time.Time `json:"created_at"`
+	ClosedAt     time.Time `json:"closed_at,omitempty"` // set when the PR that owns this preview environment is closed; the preview sweeper reaps it once its TTL elapses
 }
 
-// Deployment expresses desired image in a specific environment.
+// Deployment expresses a build of a service in a specific environment as
+// it moves through the deploy lifecycle. Creating one (pending) never
+// mutates Service.Image on its own - only promote does that, after
+// whatever health gating the caller requires has passed.
 type Deployment struct {
 	ID          string    `json:"id"`
 	ServiceID   string    `json:"service_id"`
 	Environment string    `json:"environment"`
 	Image       string    `json:"image"`
+	Status      string    `json:"status"` // pending, deploying, healthy, failed, rolled_back, superseded
 	CreatedAt   time.Time `json:"created_at"`
+	PromotedAt  time.Time `json:"promoted_at,omitempty"`
+}
+
+// RepositoryService links one compose stack hosted in a Repository to a
+// Service. A single-service repo has exactly one entry with an empty
+// PathPrefix (matches every push); a monorepo adds one entry per
+// services/*/ directory, each scoped to the paths that should trigger
+// it, so a push touching only services/web/ doesn't rebuild services/api/.
+type RepositoryService struct {
+	ServiceID   string `json:"service_id"`
+	ComposePath string `json:"compose_path"`
+	// PathPrefix, when set, scopes this entry to pushes with at least
+	// one changed path under it (e.g. "services/api/"). Empty matches
+	// every push, regardless of what changed - the right value for a
+	// repo hosting a single service, and for any push whose changed
+	// paths couldn't be determined (see Event.ChangedPaths).
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Environment is the default environment a push to DefaultBranch
+	// deploys this entry to.
+	Environment string `json:"environment"`
 }
 
-// Repository represents a GitHub repository linked to the platform.
+// Repository represents a Git repository linked to the platform.
 type Repository struct {
-	ID            string    `json:"id"`
-	Owner         string    `json:"owner"`
-	Name          string    `json:"name"`
-	DefaultBranch string    `json:"default_branch"`
-	ComposePath   string    `json:"compose_path"`
-	Installation  string    `json:"installation_id"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            string `json:"id"`
+	Provider      string `json:"provider"` // github, gitlab, gitea, bitbucket, ssh
+	Owner         string `json:"owner"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"default_branch"`
+	Installation  string `json:"installation_id"`
+	// Services lists the compose stacks this repository builds. See
+	// RepositoryService.
+	Services []RepositoryService `json:"services,omitempty"`
+	// PushFilter, when set, gates which pushes enqueue a build job at
+	// all, superseding the DefaultBranch-only check. Nil means the old
+	// behavior: build only pushes to DefaultBranch. Like DefaultBranch,
+	// it's reset whenever an installation/repository-grant webhook
+	// re-registers this Repository, so re-apply it if an app
+	// reinstall wipes it.
+	PushFilter *PushFilter `json:"push_filter,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// PushFilter is a Drone/Woodpecker-style trigger filter evaluated against
+// a push event before it's allowed to enqueue a BuildJob. AllowBranches/
+// DenyBranches/AllowTags globs are matched against the ref with its
+// "refs/heads/"/"refs/tags/" prefix stripped. IgnorePaths globs are
+// matched against the pushed commits' changed files; a push is skipped
+// when every changed path matches one of them (e.g. ["docs/**"] to
+// ignore doc-only pushes) - it's evaluated only when the provider's
+// payload reports changed paths at all (see Event.ChangedPaths). An
+// empty list for any field means "no constraint from this field", not
+// "match nothing".
+type PushFilter struct {
+	AllowBranches []string `json:"allow_branches,omitempty"` // e.g. ["main", "release/*"]
+	DenyBranches  []string `json:"deny_branches,omitempty"`
+	AllowTags     []string `json:"allow_tags,omitempty"`
+	IgnorePaths   []string `json:"ignore_paths,omitempty"` // e.g. ["docs/**"]
 }
 
-// Installation tracks a GitHub App installation that grants access to repositories.
+// Installation tracks an app/webhook installation on a Git hosting
+// provider (GitHub App, GitLab group/project, Gitea org) that grants
+// access to repositories.
 type Installation struct {
-	ID            string    `json:"id"`
-	Account       string    `json:"account"`
-	ExternalID    string    `json:"external_id"`
-	WebhookSecret string    `json:"webhook_secret"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID         string `json:"id"`
+	Provider   string `json:"provider"` // github, gitlab, gitea, bitbucket
+	Account    string `json:"account"`
+	ExternalID string `json:"external_id"`
+	// WebhookSecret verifies inbound webhooks. Its role is provider
+	//-specific: an HMAC-SHA256 key for GitHub/Gitea, or the literal
+	// shared-secret value GitLab echoes back in X-Gitlab-Token.
+	WebhookSecret string `json:"webhook_secret"`
+	// AccessToken is a provider API credential used to list repositories,
+	// register webhooks, and read file contents at a ref. GitHub uses its
+	// own App-JWT/installation-token exchange instead and ignores this;
+	// GitLab and Gitea have no equivalent app-level credential, so this
+	// holds a personal/project access token directly.
+	AccessToken string `json:"access_token,omitempty"`
+	// AppID and AppPrivateKey let this installation mint tokens under its
+	// own GitHub App instead of the control plane's default one
+	// (configured via --github-app-private-key), for an operator managing
+	// installations under more than one App. Both empty falls back to the
+	// default App; GitLab/Gitea/Bitbucket ignore these fields entirely.
+	AppID         string `json:"app_id,omitempty"`
+	AppPrivateKey string `json:"app_private_key,omitempty"` // PEM, stored as provided
+	// PreviewBaseDomain and PreviewTTL override the server-wide preview
+	// defaults for repos under this installation. PreviewTTL is a Go
+	// duration string (e.g. "168h"); either may be left empty to fall
+	// back to the server default.
+	PreviewBaseDomain string    `json:"preview_base_domain,omitempty"`
+	PreviewTTL        string    `json:"preview_ttl,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// IdempotencyRecord caches the outcome of a POST/PUT/PATCH request against
+// a caller-supplied idempotency key - an Idempotency-Key header, or a
+// GitHub/Gitea webhook's own delivery ID - so a retried request presenting
+// the same key replays the original response instead of repeating its
+// side effects. This is what keeps a redelivered webhook from creating a
+// duplicate BuildJob and lets a worker safely retry a PATCH
+// /v1/build-jobs/{id} whose response it never saw.
+type IdempotencyRecord struct {
+	Key    string `json:"key"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// RequestSHA256 hashes the request body together with the caller's
+	// Authorization header (empty string for unauthenticated routes), so
+	// reusing the key for a different request - or without the original
+	// credential - is detected as a conflict rather than replayed.
+	RequestSHA256      string    `json:"request_sha256"`
+	Status             int       `json:"status"`
+	ResponseBody       string    `json:"response_body"`
+	ResponseBodySHA256 string    `json:"response_body_sha256"`
+	ContentType        string    `json:"content_type,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+// WebhookTask is a persisted record of one webhook delivery's dispatch
+// work - the repo upsert, BuildJob creation, and check-run reporting a
+// normalized event triggers - queued so the HTTP handler can return
+// immediately and a worker goroutine applies it off the request path.
+// EventJSON holds the normalized providers.Event, marshaled by the
+// caller and kept opaque here so this package doesn't need to import
+// providers. A process restart replays any row still "pending" instead
+// of losing it; see Server.ReplayPendingWebhookTasks.
+type WebhookTask struct {
+	ID                     string    `json:"id"`
+	Provider               string    `json:"provider"`
+	ExternalInstallationID string    `json:"external_installation_id"`
+	EventJSON              string    `json:"event_json"`
+	Status                 string    `json:"status"` // pending, done, failed
+	Error                  string    `json:"error,omitempty"`
+	CreatedAt              time.Time `json:"created_at"`
+	ProcessedAt            time.Time `json:"processed_at,omitempty"`
 }
 
 // BuildJob represents pending build/deploy work triggered by repo events.
 type BuildJob struct {
-	ID           string    `json:"id"`
-	Repository   string    `json:"repository"`   // owner/name
-	Ref          string    `json:"ref"`
-	Commit       string    `json:"commit"`
-	Installation string    `json:"installation"` // installation external id
-	Status       string    `json:"status"`       // pending, running, succeeded, failed
-	Reason       string    `json:"reason"`
-	WorkerID     string    `json:"worker_id"`
-	StartedAt    time.Time `json:"started_at"`
-	CompletedAt  time.Time `json:"completed_at"`
-	Artifacts    []string  `json:"artifacts"`
-	ServiceID    string    `json:"service_id"`
-	Environment  string    `json:"environment"`
-	ComposePath  string    `json:"compose_path"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              string    `json:"id"`
+	Repository      string    `json:"repository"` // owner/name (or group/subgroup/.../name)
+	Ref             string    `json:"ref"`
+	Commit          string    `json:"commit"`
+	Provider        string    `json:"provider"`     // github, gitlab, gitea, bitbucket, ssh
+	Installation    string    `json:"installation"` // installation external id
+	Status          string    `json:"status"`       // pending, running, succeeded, failed
+	Reason          string    `json:"reason"`
+	WorkerID        string    `json:"worker_id"`
+	StartedAt       time.Time `json:"started_at"`
+	CompletedAt     time.Time `json:"completed_at"`
+	LastHeartbeatAt time.Time `json:"last_heartbeat_at"`
+	// CancelRequested is set by CancelBuildJob and surfaced back to the
+	// worker in HeartbeatBuildJob's response, so a worker polling its own
+	// heartbeat can notice an operator-requested cancellation and abort its
+	// in-progress build instead of completing it.
+	CancelRequested bool     `json:"cancel_requested,omitempty"`
+	Artifacts       []string `json:"artifacts"`
+	ServiceID       string   `json:"service_id"`
+	Environment     string   `json:"environment"`
+	ComposePath     string   `json:"compose_path"`
+	Builder         string   `json:"builder"`              // docker, buildpacks, nixpacks
+	Language        string   `json:"language"`             // detected buildpack/nixpacks language
+	BuilderVersion  string   `json:"builder_version"`      // pack/nixpacks version used
+	Attempt         int      `json:"attempt"`              // bumped on every restart, folded into the image tag
+	Secrets         []string `json:"secrets,omitempty"`    // build-time secret values, copied from the service at claim time; redacted from logs by the worker
+	Directives      []string `json:"directives,omitempty"` // [deploy:<env>]/[compose:<path>] commit-message directives applied when this job was enqueued
+	// Kind distinguishes what the worker does with this job: "" (the
+	// zero value) and "build" both mean a normal build/deploy; "teardown"
+	// means tear the Environment's compose stack down instead of
+	// building, the job enqueued when a preview environment's PR closes.
+	Kind string `json:"kind,omitempty"`
+	// PullRequest is the PR/MR number this job was triggered by, 0 for a
+	// plain push. Environment is already set to previewEnvironment(PullRequest)
+	// in that case; this is carried alongside it so a caller doesn't have
+	// to parse the preview-pr-<n> environment string back apart.
+	PullRequest int `json:"pull_request,omitempty"`
+	// CheckRunID is the provider's check-run identifier once one has been
+	// created for this job (see providers.ChecksReporter), so later
+	// status changes PATCH the same check run instead of creating a new
+	// one per update.
+	CheckRunID string `json:"check_run_id,omitempty"`
+	// ImageRefs maps a RepositoryService's ServiceID to the fully-qualified
+	// image reference a build worker pushed for it, e.g.
+	// "<registry>/<repository name>/<service ID>:<short commit>". Set by the worker's
+	// completion PATCH alongside Status; empty until then.
+	ImageRefs map[string]string `json:"image_refs,omitempty"`
+	// LogsURL is where a caller can fetch/stream this job's build output,
+	// e.g. "/v1/build-jobs/<id>/logs". Set by the worker's completion PATCH
+	// so a caller that only has the final job doesn't have to reconstruct it.
+	LogsURL   string    `json:"logs_url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,133 @@
+// Package objectstore presigns S3-compatible URLs so build workers and
+// agents can push/pull build artifacts directly to a bucket (MinIO, AWS
+// S3, or anything else speaking SigV4) without proxying bytes through the
+// control plane.
+package objectstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config holds the bucket and credentials a Client presigns against.
+type Config struct {
+	// Endpoint is the host[:port] of the S3-compatible service, e.g.
+	// "minio.internal:9000" or "s3.us-east-1.amazonaws.com". Leave empty
+	// to disable the feature.
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// Client presigns PUT/GET URLs against path-style bucket addressing
+// (<endpoint>/<bucket>/<key>), which every S3-compatible target including
+// MinIO supports without virtual-hosted DNS.
+type Client struct {
+	cfg Config
+}
+
+// New returns a Client, or (nil, false) when cfg.Endpoint is empty so
+// callers can leave artifact storage disabled by omitting the endpoint
+// rather than branching on it.
+func New(cfg Config) (*Client, bool) {
+	if cfg.Endpoint == "" {
+		return nil, false
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &Client{cfg: cfg}, true
+}
+
+// PresignPUT returns a URL a caller can PUT object bytes to directly,
+// valid for expires.
+func (c *Client) PresignPUT(key string, expires time.Duration) (string, error) {
+	return c.presign("PUT", key, expires)
+}
+
+// PresignGET returns a URL a caller can GET object bytes from directly,
+// valid for expires.
+func (c *Client) PresignGET(key string, expires time.Duration) (string, error) {
+	return c.presign("GET", key, expires)
+}
+
+// presign implements SigV4 query-string signing (the scheme S3 calls
+// "presigned URLs"): https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+func (c *Client) presign(method, key string, expires time.Duration) (string, error) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", dateStamp, c.cfg.Region)
+
+	canonicalURI := "/" + c.cfg.Bucket + "/" + encodePath(key)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", c.cfg.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := query.Encode()
+
+	canonicalHeaders := "host:" + c.cfg.Endpoint + "\n"
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders,
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	signingKey := deriveSigningKey(c.cfg.SecretKey, dateStamp, c.cfg.Region)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	scheme := "https"
+	if !c.cfg.UseSSL {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", scheme, c.cfg.Endpoint, canonicalURI, canonicalQuery, signature), nil
+}
+
+func deriveSigningKey(secretKey, dateStamp, region string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, "s3")
+	return hmacSHA256(kService, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// encodePath percent-encodes key the way SigV4 expects for a canonical
+// URI: every path segment escaped, but "/" left intact.
+func encodePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,225 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// bitbucketAPIBase is Bitbucket Cloud's fixed API host; unlike GitLab and
+// Gitea, self-managed Bitbucket Server is a different product with its own
+// API shape, so there's no base-URL override here.
+const bitbucketAPIBase = "https://api.bitbucket.org/2.0"
+
+// BitbucketProvider talks to Bitbucket Cloud. Its webhooks carry the event
+// type in X-Event-Key (e.g. "repo:push", "pullrequest:created") rather
+// than a separate header plus payload field, and Bitbucket Cloud has no
+// HMAC/shared-secret signing for webhooks at all - VerifySignature is
+// therefore always a no-op, same as an installation with no secret
+// registered on the other providers.
+type BitbucketProvider struct {
+	httpClient *http.Client
+}
+
+// NewBitbucketProvider builds a provider for Bitbucket Cloud.
+func NewBitbucketProvider() *BitbucketProvider {
+	return &BitbucketProvider{httpClient: http.DefaultClient}
+}
+
+func (p *BitbucketProvider) Name() string { return "bitbucket" }
+
+// VerifySignature is a no-op: Bitbucket Cloud doesn't sign webhook
+// deliveries, so there is nothing to check against secret.
+func (p *BitbucketProvider) VerifySignature(headers http.Header, payload []byte, secret string) error {
+	return nil
+}
+
+func (p *BitbucketProvider) ParseEvent(eventType string, payload []byte) (Event, bool, error) {
+	switch eventType {
+	case "repo:push":
+		return parseBitbucketPush(payload)
+	case "pullrequest:created", "pullrequest:updated", "pullrequest:fulfilled", "pullrequest:rejected":
+		return parseBitbucketPullRequest(eventType, payload)
+	default:
+		return Event{}, false, nil
+	}
+}
+
+func parseBitbucketPush(payload []byte) (Event, bool, error) {
+	var body struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Push struct {
+			Changes []struct {
+				New struct {
+					Name   string `json:"name"`
+					Target struct {
+						Hash    string `json:"hash"`
+						Message string `json:"message"`
+					} `json:"target"`
+				} `json:"new"`
+			} `json:"changes"`
+		} `json:"push"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	if len(body.Push.Changes) == 0 {
+		return Event{}, false, nil
+	}
+	change := body.Push.Changes[len(body.Push.Changes)-1]
+	return Event{
+		Kind:       "push",
+		Repository: body.Repository.FullName,
+		Ref:        change.New.Name,
+		Commit:     change.New.Target.Hash,
+		Message:    change.New.Target.Message,
+		// ChangedPaths is left nil: Bitbucket Cloud's push payload carries
+		// no file-level diff, only the before/after hashes, so a
+		// paths-changed filter can't be evaluated against it.
+	}, true, nil
+}
+
+func parseBitbucketPullRequest(eventType string, payload []byte) (Event, bool, error) {
+	var body struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		PullRequest struct {
+			ID     int    `json:"id"`
+			Title  string `json:"title"`
+			Source struct {
+				Branch struct {
+					Name string `json:"name"`
+				} `json:"branch"`
+				Commit struct {
+					Hash string `json:"hash"`
+				} `json:"commit"`
+			} `json:"source"`
+		} `json:"pullrequest"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	return Event{
+		Kind:       "pull_request",
+		Action:     bitbucketPRAction(eventType),
+		PRNumber:   body.PullRequest.ID,
+		Repository: body.Repository.FullName,
+		HeadSHA:    body.PullRequest.Source.Commit.Hash,
+		HeadRef:    body.PullRequest.Source.Branch.Name,
+		Message:    body.PullRequest.Title,
+	}, true, nil
+}
+
+// bitbucketPRAction maps a pullrequest:* event key onto the GitHub
+// vocabulary NormalizePRAction's callers expect; "created"/"updated" both
+// mean "there's a new HEAD to build", same as GitHub's synchronize.
+func bitbucketPRAction(eventType string) string {
+	switch eventType {
+	case "pullrequest:created":
+		return "opened"
+	case "pullrequest:updated":
+		return "synchronize"
+	case "pullrequest:fulfilled", "pullrequest:rejected":
+		return "closed"
+	default:
+		return eventType
+	}
+}
+
+func (p *BitbucketProvider) ListRepos(ctx context.Context, token string) ([]RepoRef, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bitbucketAPIBase+"/repositories?role=member&pagelen=50", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("list repos: %s: %s", resp.Status, string(body))
+	}
+
+	var out struct {
+		Values []struct {
+			FullName   string `json:"full_name"`
+			Name       string `json:"name"`
+			Mainbranch struct {
+				Name string `json:"name"`
+			} `json:"mainbranch"`
+			Workspace struct {
+				Slug string `json:"slug"`
+			} `json:"workspace"`
+		} `json:"values"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	repos := make([]RepoRef, 0, len(out.Values))
+	for _, r := range out.Values {
+		branch := r.Mainbranch.Name
+		if branch == "" {
+			branch = "main"
+		}
+		repos = append(repos, RepoRef{
+			FullName:      r.FullName,
+			Owner:         r.Workspace.Slug,
+			Name:          r.Name,
+			DefaultBranch: branch,
+		})
+	}
+	return repos, nil
+}
+
+func (p *BitbucketProvider) RegisterWebhook(ctx context.Context, token, repo, callbackURL, secret string) error {
+	body, err := json.Marshal(map[string]any{
+		"description": "multi-domain-docker",
+		"url":         callbackURL,
+		"active":      true,
+		"events":      []string{"repo:push", "pullrequest:created", "pullrequest:updated", "pullrequest:fulfilled", "pullrequest:rejected"},
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/repositories/%s/hooks", bitbucketAPIBase, repo)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("register webhook: %s: %s", resp.Status, string(respBody))
+	}
+	return nil
+}
+
+// IssueCloneToken has nothing to exchange: like GitLab/Gitea, a Bitbucket
+// installation authenticates with a directly-stored workspace access
+// token, so this just hands it back to the caller.
+func (p *BitbucketProvider) IssueCloneToken(ctx context.Context, installationExternalID string) (string, error) {
+	if installationExternalID == "" {
+		return "", errors.New("bitbucket: no access token on file for this installation")
+	}
+	return installationExternalID, nil
+}
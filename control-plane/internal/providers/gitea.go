@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GiteaProvider talks to a Gitea (or Forgejo) instance. Unlike GitHub's
+// App model, a Gitea "installation" is just an org/user whose webhooks
+// were registered with a personal or org access token, so there is no
+// separate app-level credential to exchange: IssueCloneToken passes the
+// stored access token straight through.
+type GiteaProvider struct {
+	baseURL    string // e.g. "https://gitea.example.com", no trailing slash
+	httpClient *http.Client
+}
+
+// NewGiteaProvider builds a provider pointed at a Gitea instance's API
+// base URL.
+func NewGiteaProvider(baseURL string) *GiteaProvider {
+	return &GiteaProvider{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+}
+
+func (p *GiteaProvider) Name() string { return "gitea" }
+
+func (p *GiteaProvider) VerifySignature(headers http.Header, payload []byte, secret string) error {
+	if secret == "" {
+		return nil
+	}
+	sigHeader := headers.Get("X-Gitea-Signature")
+	if sigHeader == "" {
+		return errors.New("missing X-Gitea-Signature header")
+	}
+	sigBytes, err := hex.DecodeString(sigHeader)
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), sigBytes) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func (p *GiteaProvider) ParseEvent(eventType string, payload []byte) (Event, bool, error) {
+	switch eventType {
+	case "push":
+		return parseGitHubPush(payload)
+	case "pull_request":
+		event, ok, err := parseGitHubPullRequest(payload)
+		event.Action = NormalizePRAction(event.Action)
+		return event, ok, err
+	default:
+		return Event{}, false, nil
+	}
+}
+
+func (p *GiteaProvider) ListRepos(ctx context.Context, token string) ([]RepoRef, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/v1/user/repos?limit=50", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("list repos: %s: %s", resp.Status, string(body))
+	}
+
+	var out []ghRepoStub
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	repos := make([]RepoRef, 0, len(out))
+	for _, r := range out {
+		repos = append(repos, r.toRepoRef())
+	}
+	return repos, nil
+}
+
+func (p *GiteaProvider) RegisterWebhook(ctx context.Context, token, repo, callbackURL, secret string) error {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return fmt.Errorf("invalid repository name: %s", repo)
+	}
+	body, err := json.Marshal(map[string]any{
+		"type":   "gitea",
+		"active": true,
+		"events": []string{"push", "pull_request"},
+		"config": map[string]string{
+			"url":          callbackURL,
+			"content_type": "json",
+			"secret":       secret,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/hooks", p.baseURL, owner, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("register webhook: %s: %s", resp.Status, string(respBody))
+	}
+	return nil
+}
+
+// IssueCloneToken has nothing to exchange: Gitea installations authenticate
+// with a directly-stored personal/org access token, so this just hands
+// that token (passed as installationExternalID, the same way the access
+// token reaches ListRepos/RegisterWebhook) back to the caller.
+func (p *GiteaProvider) IssueCloneToken(ctx context.Context, installationExternalID string) (string, error) {
+	return installationExternalID, nil
+}
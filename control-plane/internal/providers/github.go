@@ -0,0 +1,684 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHubProvider talks to GitHub: HMAC-SHA256 webhook signatures, the
+// GitHub App JWT/installation-token exchange for API access, and the
+// REST API shapes for push/pull_request/installation* events.
+type GitHubProvider struct {
+	appID      string
+	privateKey *rsa.PrivateKey
+	httpClient *http.Client
+
+	tokenMu sync.Mutex
+	tokens  map[string]cachedInstallationToken
+}
+
+// cachedInstallationToken is one entry in GitHubProvider.tokens, keyed by
+// installation external ID (optionally suffixed with an overriding App ID -
+// see cacheKey). tokenRefreshSkew governs when a cached entry is treated
+// as expired.
+type cachedInstallationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// tokenRefreshSkew is how far before a cached installation token's actual
+// expiry it's treated as stale, so a request doesn't start a clone/API
+// call with a token GitHub might reject moments later.
+const tokenRefreshSkew = 5 * time.Minute
+
+// NewGitHubProvider parses a GitHub App's PEM-encoded private key. When
+// appID or pemBytes is empty it returns a provider with no App configured
+// and a nil error, so callers can leave
+// App-authenticated features (installation tokens, file fetches) disabled
+// by omitting the key rather than branching on it; the provider still
+// handles webhooks and manual repo/installation registration either way.
+func NewGitHubProvider(appID string, pemBytes []byte) (*GitHubProvider, error) {
+	if appID == "" || len(pemBytes) == 0 {
+		return &GitHubProvider{httpClient: http.DefaultClient, tokens: map[string]cachedInstallationToken{}}, nil
+	}
+	key, err := parseRSAPrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse github app private key: %w", err)
+	}
+	return &GitHubProvider{appID: appID, privateKey: key, httpClient: http.DefaultClient, tokens: map[string]cachedInstallationToken{}}, nil
+}
+
+func (p *GitHubProvider) Name() string { return "github" }
+
+func (p *GitHubProvider) VerifySignature(headers http.Header, payload []byte, secret string) error {
+	if secret == "" {
+		return nil
+	}
+	const prefix = "sha256="
+	sigHeader := headers.Get("X-Hub-Signature-256")
+	if sigHeader == "" {
+		return errors.New("missing X-Hub-Signature-256 header")
+	}
+	if !strings.HasPrefix(sigHeader, prefix) {
+		return fmt.Errorf("unexpected signature format")
+	}
+	sigBytes, err := hex.DecodeString(sigHeader[len(prefix):])
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), sigBytes) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func (p *GitHubProvider) ParseEvent(eventType string, payload []byte) (Event, bool, error) {
+	switch eventType {
+	case "push":
+		return parseGitHubPush(payload)
+	case "pull_request":
+		return parseGitHubPullRequest(payload)
+	case "installation":
+		return parseGitHubInstallation(payload)
+	case "installation_repositories":
+		return parseGitHubInstallationRepos(payload)
+	case "check_run":
+		return parseGitHubCheck(payload, "check_run")
+	case "check_suite":
+		return parseGitHubCheck(payload, "check_suite")
+	default:
+		return Event{}, false, nil
+	}
+}
+
+func repoFullName(fullName, owner, name string) string {
+	if fullName != "" {
+		return fullName
+	}
+	if owner != "" && name != "" {
+		return owner + "/" + name
+	}
+	return ""
+}
+
+func parseGitHubPush(payload []byte) (Event, bool, error) {
+	var body struct {
+		Ref        string `json:"ref"`
+		Before     string `json:"before"`
+		After      string `json:"after"`
+		HeadCommit struct {
+			Message  string   `json:"message"`
+			Added    []string `json:"added"`
+			Removed  []string `json:"removed"`
+			Modified []string `json:"modified"`
+		} `json:"head_commit"`
+		Repository struct {
+			FullName string `json:"full_name"`
+			Name     string `json:"name"`
+			Owner    struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	before := body.Before
+	if before == "0000000000000000000000000000000000000000" {
+		before = "" // new branch/tag push, nothing to diff against
+	}
+	return Event{
+		Kind:         "push",
+		Repository:   repoFullName(body.Repository.FullName, body.Repository.Owner.Login, body.Repository.Name),
+		Ref:          body.Ref,
+		Commit:       body.After,
+		BeforeSHA:    before,
+		Message:      body.HeadCommit.Message,
+		ChangedPaths: append(append(append([]string{}, body.HeadCommit.Added...), body.HeadCommit.Removed...), body.HeadCommit.Modified...),
+	}, true, nil
+}
+
+func parseGitHubPullRequest(payload []byte) (Event, bool, error) {
+	var body struct {
+		Action      string `json:"action"`
+		Number      int    `json:"number"`
+		PullRequest struct {
+			Title string `json:"title"`
+			Head  struct {
+				Sha string `json:"sha"`
+				Ref string `json:"ref"`
+			} `json:"head"`
+		} `json:"pull_request"`
+		Repository struct {
+			FullName string `json:"full_name"`
+			Name     string `json:"name"`
+			Owner    struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	return Event{
+		Kind:       "pull_request",
+		Action:     body.Action,
+		PRNumber:   body.Number,
+		Repository: repoFullName(body.Repository.FullName, body.Repository.Owner.Login, body.Repository.Name),
+		HeadSHA:    body.PullRequest.Head.Sha,
+		HeadRef:    body.PullRequest.Head.Ref,
+		Message:    body.PullRequest.Title,
+	}, true, nil
+}
+
+type ghRepoStub struct {
+	FullName      string `json:"full_name"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"default_branch"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+func (r ghRepoStub) toRepoRef() RepoRef {
+	branch := r.DefaultBranch
+	if branch == "" {
+		branch = "main"
+	}
+	return RepoRef{
+		FullName:      repoFullName(r.FullName, r.Owner.Login, r.Name),
+		Owner:         r.Owner.Login,
+		Name:          r.Name,
+		DefaultBranch: branch,
+	}
+}
+
+func parseGitHubInstallation(payload []byte) (Event, bool, error) {
+	var body struct {
+		Action       string `json:"action"`
+		Installation struct {
+			ID      int64 `json:"id"`
+			Account struct {
+				Login string `json:"login"`
+			} `json:"account"`
+		} `json:"installation"`
+		Repositories []ghRepoStub `json:"repositories"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	event := Event{
+		Kind:           "installation",
+		Action:         body.Action,
+		Account:        strings.TrimSpace(body.Installation.Account.Login),
+		InstallationID: strconv.FormatInt(body.Installation.ID, 10),
+	}
+	for _, repo := range body.Repositories {
+		event.Repos = append(event.Repos, repo.toRepoRef())
+	}
+	return event, true, nil
+}
+
+func parseGitHubInstallationRepos(payload []byte) (Event, bool, error) {
+	var body struct {
+		Action       string `json:"action"`
+		Installation struct {
+			ID      int64 `json:"id"`
+			Account struct {
+				Login string `json:"login"`
+			} `json:"account"`
+		} `json:"installation"`
+		Repositories        []ghRepoStub `json:"repositories"`
+		RepositoriesAdded   []ghRepoStub `json:"repositories_added"`
+		RepositoriesRemoved []ghRepoStub `json:"repositories_removed"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	event := Event{
+		Kind:           "installation",
+		Action:         body.Action,
+		Account:        strings.TrimSpace(body.Installation.Account.Login),
+		InstallationID: strconv.FormatInt(body.Installation.ID, 10),
+	}
+	for _, repo := range body.Repositories {
+		event.Repos = append(event.Repos, repo.toRepoRef())
+	}
+	for _, repo := range body.RepositoriesAdded {
+		event.Repos = append(event.Repos, repo.toRepoRef())
+	}
+	for _, repo := range body.RepositoriesRemoved {
+		event.RemovedRepos = append(event.RemovedRepos, repo.toRepoRef())
+	}
+	return event, true, nil
+}
+
+type ghCheckInfo struct {
+	HeadSHA      string `json:"head_sha"`
+	PullRequests []struct {
+		Number int `json:"number"`
+	} `json:"pull_requests"`
+}
+
+// parseGitHubCheck handles check_run and check_suite, which nest the same
+// head_sha/pull_requests shape under a field named after the event type.
+func parseGitHubCheck(payload []byte, field string) (Event, bool, error) {
+	var body struct {
+		Action     string `json:"action"`
+		Repository struct {
+			FullName string `json:"full_name"`
+			Name     string `json:"name"`
+			Owner    struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &wrapper); err != nil {
+		return Event{}, false, err
+	}
+	var check ghCheckInfo
+	if raw, ok := wrapper[field]; ok {
+		if err := json.Unmarshal(raw, &check); err != nil {
+			return Event{}, false, err
+		}
+	}
+
+	event := Event{
+		Kind:       "check",
+		Action:     body.Action,
+		Repository: repoFullName(body.Repository.FullName, body.Repository.Owner.Login, body.Repository.Name),
+		HeadSHA:    check.HeadSHA,
+	}
+	if len(check.PullRequests) > 0 {
+		event.PRNumber = check.PullRequests[0].Number
+	}
+	return event, true, nil
+}
+
+func (p *GitHubProvider) ListRepos(ctx context.Context, token string) ([]RepoRef, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/installation/repositories?per_page=100", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("list repos: %s: %s", resp.Status, string(body))
+	}
+
+	var out struct {
+		Repositories []ghRepoStub `json:"repositories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	repos := make([]RepoRef, 0, len(out.Repositories))
+	for _, r := range out.Repositories {
+		repos = append(repos, r.toRepoRef())
+	}
+	return repos, nil
+}
+
+func (p *GitHubProvider) RegisterWebhook(ctx context.Context, token, repo, callbackURL, secret string) error {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return fmt.Errorf("invalid repository name: %s", repo)
+	}
+	body, err := json.Marshal(map[string]any{
+		"name":   "web",
+		"active": true,
+		"events": []string{"push", "pull_request", "check_run", "check_suite"},
+		"config": map[string]string{
+			"url":          callbackURL,
+			"content_type": "json",
+			"secret":       secret,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/hooks", owner, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("register webhook: %s: %s", resp.Status, string(respBody))
+	}
+	return nil
+}
+
+// IssueCloneToken exchanges the App's JWT for a token scoped to a single
+// installation, per
+// https://docs.github.com/en/rest/apps/apps#create-an-installation-access-token-for-an-app.
+// Returns an error if no App is configured (empty appID), rather than
+// silently returning an empty token an API call would then fail on.
+func (p *GitHubProvider) IssueCloneToken(ctx context.Context, installationExternalID string) (string, error) {
+	token, _, err := p.cachedInstallationToken(ctx, installationExternalID, "", nil)
+	return token, err
+}
+
+// IssueInstallationToken implements the optional InstallationTokenIssuer
+// capability: it returns a cached-or-freshly-minted installation token
+// alongside its expiry and the repositories it grants access to, so a
+// caller (the /v1/github/installations/{id}/token and .../refresh
+// endpoints) can hand a build worker everything it needs to clone without
+// a second round trip. appID/privateKeyPEM override the provider's own
+// App when set, for an installation onboarded under a different App.
+func (p *GitHubProvider) IssueInstallationToken(ctx context.Context, installationExternalID, appID string, privateKeyPEM []byte) (string, time.Time, []RepoRef, error) {
+	token, expiresAt, err := p.cachedInstallationToken(ctx, installationExternalID, appID, privateKeyPEM)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	repos, err := p.ListRepos(ctx, token)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	return token, expiresAt, repos, nil
+}
+
+// cachedInstallationToken returns a still-fresh cached token for
+// installationExternalID if one exists, minting and caching a new one
+// otherwise. overrideAppID/overridePrivateKeyPEM, when non-empty, mint
+// under that App instead of the provider's default one and are folded
+// into the cache key so the same installation under two Apps doesn't
+// collide.
+func (p *GitHubProvider) cachedInstallationToken(ctx context.Context, installationExternalID, overrideAppID string, overridePrivateKeyPEM []byte) (string, time.Time, error) {
+	appID, key := p.appID, p.privateKey
+	if overrideAppID != "" && len(overridePrivateKeyPEM) > 0 {
+		parsed, err := parseRSAPrivateKeyPEM(overridePrivateKeyPEM)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("parse installation's github app private key: %w", err)
+		}
+		appID, key = overrideAppID, parsed
+	}
+	if appID == "" || key == nil {
+		return "", time.Time{}, errors.New("github app not configured")
+	}
+
+	cacheKey := installationExternalID
+	if overrideAppID != "" {
+		cacheKey = installationExternalID + "|" + overrideAppID
+	}
+
+	p.tokenMu.Lock()
+	if cached, ok := p.tokens[cacheKey]; ok && time.Until(cached.expiresAt) > tokenRefreshSkew {
+		p.tokenMu.Unlock()
+		return cached.token, cached.expiresAt, nil
+	}
+	p.tokenMu.Unlock()
+
+	token, expiresAt, err := p.exchangeInstallationToken(ctx, installationExternalID, appID, key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	p.tokenMu.Lock()
+	p.tokens[cacheKey] = cachedInstallationToken{token: token, expiresAt: expiresAt}
+	p.tokenMu.Unlock()
+
+	return token, expiresAt, nil
+}
+
+// exchangeInstallationToken calls GitHub's installation access token
+// endpoint directly, with no caching - see cachedInstallationToken for
+// the caching wrapper every caller should use instead.
+func (p *GitHubProvider) exchangeInstallationToken(ctx context.Context, installationExternalID, appID string, key *rsa.PrivateKey) (string, time.Time, error) {
+	jwt, err := appJWT(appID, key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	url := fmt.Sprintf("https://api.github.com/app/installations/%s/access_tokens", installationExternalID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", time.Time{}, fmt.Errorf("installation token exchange: %s: %s", resp.Status, string(body))
+	}
+
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", time.Time{}, err
+	}
+	return out.Token, out.ExpiresAt, nil
+}
+
+// FetchFile reads a file from a repository at an exact ref via the
+// contents API, so the webhook receiver can see what a commit's compose
+// file looks like without cloning it. Implements the optional
+// FileFetcher interface.
+func (p *GitHubProvider) FetchFile(ctx context.Context, token, owner, name, path, ref string) (string, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s?ref=%s", owner, name, path, ref)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("fetch %s@%s: %s: %s", path, ref, resp.Status, string(body))
+	}
+
+	var out struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if out.Encoding != "base64" {
+		return "", fmt.Errorf("unexpected content encoding %q", out.Encoding)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(out.Content, "\n", ""))
+	if err != nil {
+		return "", fmt.Errorf("decode content: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// ReportCheckRun creates (checkRunID == "") or updates (PATCHes) a
+// GitHub check run for headSHA, implementing the ChecksReporter optional
+// capability.
+func (p *GitHubProvider) ReportCheckRun(ctx context.Context, token, owner, name, headSHA, checkRunID string, update CheckRunUpdate) (string, error) {
+	body := map[string]any{
+		"name":     update.Name,
+		"head_sha": headSHA,
+		"status":   update.Status,
+	}
+	if update.DetailsURL != "" {
+		body["details_url"] = update.DetailsURL
+	}
+	if update.Summary != "" {
+		body["output"] = map[string]string{
+			"title":   update.Name,
+			"summary": update.Summary,
+		}
+	}
+	if update.Status == "completed" {
+		body["conclusion"] = update.Conclusion
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	method, url := http.MethodPost, fmt.Sprintf("https://api.github.com/repos/%s/%s/check-runs", owner, name)
+	if checkRunID != "" {
+		method, url = http.MethodPatch, fmt.Sprintf("https://api.github.com/repos/%s/%s/check-runs/%s", owner, name, checkRunID)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(string(payload)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("report check run: %s: %s", resp.Status, string(respBody))
+	}
+
+	var out struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if out.ID == 0 {
+		return checkRunID, nil
+	}
+	return strconv.FormatInt(out.ID, 10), nil
+}
+
+// ChangedFiles lists the file paths changed between base and head,
+// implementing the DiffFetcher optional capability via GitHub's
+// commits/compare API.
+func (p *GitHubProvider) ChangedFiles(ctx context.Context, token, owner, name, base, head string) ([]string, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/compare/%s...%s", owner, name, base, head)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("compare %s...%s: %s: %s", base, head, resp.Status, string(body))
+	}
+
+	var out struct {
+		Files []struct {
+			Filename string `json:"filename"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(out.Files))
+	for _, f := range out.Files {
+		paths = append(paths, f.Filename)
+	}
+	return paths, nil
+}
+
+func parseRSAPrivateKeyPEM(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return key, nil
+}
+
+// appJWT mints a short-lived (10 minute) RS256 JWT identifying the App
+// with the given appID/key, per GitHub's app authentication scheme. The
+// 60s-in-the-past `iat` guards against clock skew between us and
+// GitHub's servers. Takes appID/key as parameters rather than reading
+// them off a *GitHubProvider so a per-installation App override can
+// mint a JWT without mutating the provider's own configured App.
+func appJWT(appID string, key *rsa.PrivateKey) (string, error) {
+	now := time.Now().UTC()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims := fmt.Sprintf(`{"iat":%d,"exp":%d,"iss":%q}`, now.Add(-60*time.Second).Unix(), now.Add(9*time.Minute).Unix(), appID)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	signingInput := header + "." + payload
+
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil))
+	if err != nil {
+		return "", fmt.Errorf("sign app jwt: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,220 @@
+package providers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GitLabProvider talks to GitLab (gitlab.com or self-managed). GitLab
+// webhooks don't sign the body at all; instead the configured secret is
+// echoed back verbatim in X-Gitlab-Token for a literal comparison. Event
+// payloads are also shaped differently from GitHub/Gitea: dispatch is by
+// object_kind rather than an event-type header, and hook installs are
+// per-group/per-project rather than a single app-wide install.
+type GitLabProvider struct {
+	baseURL    string // e.g. "https://gitlab.com", no trailing slash
+	httpClient *http.Client
+}
+
+// NewGitLabProvider builds a provider pointed at a GitLab instance's API
+// base URL.
+func NewGitLabProvider(baseURL string) *GitLabProvider {
+	return &GitLabProvider{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+}
+
+func (p *GitLabProvider) Name() string { return "gitlab" }
+
+func (p *GitLabProvider) VerifySignature(headers http.Header, payload []byte, secret string) error {
+	if secret == "" {
+		return nil
+	}
+	token := headers.Get("X-Gitlab-Token")
+	if token == "" {
+		return errors.New("missing X-Gitlab-Token header")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return errors.New("token mismatch")
+	}
+	return nil
+}
+
+func (p *GitLabProvider) ParseEvent(eventType string, payload []byte) (Event, bool, error) {
+	var kind struct {
+		ObjectKind string `json:"object_kind"`
+	}
+	if err := json.Unmarshal(payload, &kind); err != nil {
+		return Event{}, false, err
+	}
+	switch kind.ObjectKind {
+	case "push":
+		return parseGitLabPush(payload)
+	case "merge_request":
+		return parseGitLabMergeRequest(payload)
+	default:
+		return Event{}, false, nil
+	}
+}
+
+func parseGitLabPush(payload []byte) (Event, bool, error) {
+	var body struct {
+		Ref     string `json:"ref"`
+		After   string `json:"after"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+		Commits []struct {
+			Message  string   `json:"message"`
+			Added    []string `json:"added"`
+			Removed  []string `json:"removed"`
+			Modified []string `json:"modified"`
+		} `json:"commits"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	var message string
+	changedPaths := []string{}
+	if len(body.Commits) > 0 {
+		message = body.Commits[len(body.Commits)-1].Message
+	}
+	for _, commit := range body.Commits {
+		changedPaths = append(changedPaths, commit.Added...)
+		changedPaths = append(changedPaths, commit.Removed...)
+		changedPaths = append(changedPaths, commit.Modified...)
+	}
+	return Event{
+		Kind:         "push",
+		Repository:   body.Project.PathWithNamespace,
+		Ref:          body.Ref,
+		Commit:       body.After,
+		Message:      message,
+		ChangedPaths: changedPaths,
+	}, true, nil
+}
+
+func parseGitLabMergeRequest(payload []byte) (Event, bool, error) {
+	var body struct {
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+		ObjectAttributes struct {
+			IID        int    `json:"iid"`
+			Action     string `json:"action"`
+			Title      string `json:"title"`
+			LastCommit struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+			SourceBranch string `json:"source_branch"`
+		} `json:"object_attributes"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return Event{}, false, err
+	}
+	return Event{
+		Kind:       "pull_request",
+		Action:     NormalizePRAction(body.ObjectAttributes.Action),
+		PRNumber:   body.ObjectAttributes.IID,
+		Repository: body.Project.PathWithNamespace,
+		HeadSHA:    body.ObjectAttributes.LastCommit.ID,
+		HeadRef:    body.ObjectAttributes.SourceBranch,
+		Message:    body.ObjectAttributes.Title,
+	}, true, nil
+}
+
+func (p *GitLabProvider) ListRepos(ctx context.Context, token string) ([]RepoRef, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/v4/projects?membership=true&per_page=50", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", token)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("list repos: %s: %s", resp.Status, string(body))
+	}
+
+	var out []struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		Namespace         struct {
+			FullPath string `json:"full_path"`
+		} `json:"namespace"`
+		Name          string `json:"name"`
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	repos := make([]RepoRef, 0, len(out))
+	for _, r := range out {
+		branch := r.DefaultBranch
+		if branch == "" {
+			branch = "main"
+		}
+		repos = append(repos, RepoRef{
+			FullName:      r.PathWithNamespace,
+			Owner:         r.Namespace.FullPath,
+			Name:          r.Name,
+			DefaultBranch: branch,
+		})
+	}
+	return repos, nil
+}
+
+func (p *GitLabProvider) RegisterWebhook(ctx context.Context, token, repo, callbackURL, secret string) error {
+	body, err := json.Marshal(map[string]any{
+		"url":                     callbackURL,
+		"token":                   secret,
+		"push_events":             true,
+		"merge_requests_events":   true,
+		"enable_ssl_verification": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/v4/projects/%s/hooks", p.baseURL, pathEscape(repo))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("register webhook: %s: %s", resp.Status, string(respBody))
+	}
+	return nil
+}
+
+// pathEscape percent-encodes a GitLab project path (e.g. "group/sub/repo")
+// for use as a single path segment, per GitLab's "namespaced path" API
+// convention of slash-encoding the whole thing.
+func pathEscape(repo string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(repo, "%", "%25"), "/", "%2F")
+}
+
+// IssueCloneToken has nothing to exchange: GitLab installations
+// authenticate with a directly-stored personal/project access token, so
+// this just hands that token back to the caller.
+func (p *GitLabProvider) IssueCloneToken(ctx context.Context, installationExternalID string) (string, error) {
+	return installationExternalID, nil
+}
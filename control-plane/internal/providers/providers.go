@@ -0,0 +1,224 @@
+// Package providers abstracts the parts of handling a Git hosting
+// backend that differ between GitHub, GitLab, Gitea, and Bitbucket:
+// webhook signature verification, decoding a webhook body into the
+// control plane's own event shape, listing repositories an installation
+// can see, registering a webhook on a repository, and minting a token to
+// read repo contents. The HTTP layer and build queue program against
+// the Provider interface so none of them need a per-backend switch.
+package providers
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Event is the normalized shape every provider's webhook payload is
+// decoded into, covering the handful of event kinds the control plane
+// acts on: a push to a branch, a pull/merge request lifecycle change,
+// an app/webhook installation change, and a check re-run request.
+type Event struct {
+	// Kind is one of "push", "pull_request", "installation" (an app/webhook
+	// install changed, or its repository grants changed), or "check" (a
+	// check run/suite was rerequested).
+	Kind       string
+	Action     string // provider-specific, e.g. "opened", "closed", "rerequested", "created", "added"
+	Repository string // "owner/name"
+	Ref        string
+	Commit     string
+	// Message is the pushed commit's message, or the pull/merge request's
+	// title - whichever the "push"/"pull_request" Kind carries - so callers
+	// can scan it for build directives like [ci skip] or [deploy:staging].
+	Message  string
+	PRNumber int
+	HeadSHA  string
+	HeadRef  string
+	// BeforeSHA is the commit a "push" Kind moved the ref from, when the
+	// provider's payload carries one (GitHub's "before"). Empty for a
+	// new branch/tag's first push, or for a provider/event kind that
+	// doesn't report it. Used as the compare base for a DiffFetcher
+	// fallback when ChangedPaths comes back nil.
+	BeforeSHA string
+	// ChangedPaths lists files added, modified, or removed by a "push"
+	// Kind. Populated from whatever file-level diff the provider's payload
+	// carries directly (GitHub/Gitea: head_commit's files only; GitLab:
+	// added/modified/removed unioned across every commit in the push);
+	// nil when the provider doesn't include one (Bitbucket
+	// Cloud's push payload has no file list without a separate diffstat
+	// call), so callers evaluating a paths-changed filter should treat
+	// nil as "unknown" rather than "no changes".
+	ChangedPaths []string
+
+	// InstallationID and Account describe the app/webhook installation a
+	// "installation" event is about. Repos lists repositories it grants
+	// access to (present for both an install and a repository-grant
+	// change); RemovedRepos lists ones a repository-grant change revoked.
+	InstallationID string
+	Account        string
+	Repos          []RepoRef
+	RemovedRepos   []RepoRef
+}
+
+// RepoRef identifies a repository as reported by a provider, either in
+// a webhook payload or a ListRepos response.
+type RepoRef struct {
+	FullName      string
+	Owner         string
+	Name          string
+	DefaultBranch string
+}
+
+// Provider is the seam between one Git hosting backend and the control
+// plane. Implementations must be safe for concurrent use.
+type Provider interface {
+	// Name is the provider key used in routes and stored on
+	// models.Repository.Provider / models.Installation.Provider, e.g.
+	// "github", "gitlab", "gitea".
+	Name() string
+
+	// VerifySignature checks a webhook request's authenticity against
+	// secret, using whatever header and scheme the provider uses (GitHub:
+	// HMAC-SHA256 in X-Hub-Signature-256; Gitea: HMAC-SHA256 in
+	// X-Gitea-Signature; GitLab: a literal shared-secret comparison
+	// against X-Gitlab-Token; Bitbucket Cloud: no signing at all, so this
+	// is always a no-op there). Returns nil when secret is empty, so
+	// installations that haven't configured one yet aren't locked out.
+	VerifySignature(headers http.Header, payload []byte, secret string) error
+
+	// ParseEvent decodes a webhook body into a normalized Event. eventType
+	// is the provider's event-type header value (X-GitHub-Event,
+	// X-Gitea-Event, X-Gitlab-Event, X-Event-Key). ok is false for event
+	// types this provider receives but the control plane doesn't act on
+	// (GitHub "ping", GitLab "Job Hook", ...), which callers should accept
+	// (HTTP 202) without further processing rather than treat as an error.
+	ParseEvent(eventType string, payload []byte) (event Event, ok bool, err error)
+
+	// ListRepos lists repositories reachable with token.
+	ListRepos(ctx context.Context, token string) ([]RepoRef, error)
+
+	// RegisterWebhook creates a webhook on repo (in "owner/name" form)
+	// pointed at callbackURL, configured with secret the way the provider
+	// authenticates deliveries (see VerifySignature); Bitbucket Cloud has no
+	// such setting and ignores secret.
+	RegisterWebhook(ctx context.Context, token, repo, callbackURL, secret string) error
+
+	// IssueCloneToken exchanges whatever long-lived credential the
+	// installation holds for a token suitable for API calls and cloning.
+	// For GitHub this is an App-JWT-for-installation-token exchange
+	// keyed by installationExternalID; for GitLab/Gitea/Bitbucket, which
+	// have no separate app-level credential, it's a passthrough of the
+	// stored access token.
+	IssueCloneToken(ctx context.Context, installationExternalID string) (string, error)
+}
+
+// FileFetcher is an optional capability a Provider may implement to read
+// a single file out of a repository at an exact ref. Only GitHub
+// implements it today; callers should type-assert and treat its absence
+// as "skip this, it's a freshness nicety" rather than an error, the same
+// way refreshServiceCompose already treats a disabled GitHub App.
+type FileFetcher interface {
+	FetchFile(ctx context.Context, token, owner, name, path, ref string) (string, error)
+}
+
+// CheckRunUpdate is the state a ChecksReporter reports for a BuildJob.
+// Status is one of "queued", "in_progress", "completed"; Conclusion is
+// only meaningful (and required by GitHub) once Status is "completed" -
+// "success", "failure", "cancelled".
+type CheckRunUpdate struct {
+	Name       string // check name shown on the PR, e.g. "infrctl build"
+	Status     string
+	Conclusion string
+	DetailsURL string
+	Summary    string
+}
+
+// ChecksReporter is an optional capability a Provider may implement to
+// surface BuildJob progress inline on a pull/merge request via the
+// host's check-run API. Only GitHub implements it today - GitLab/Gitea/
+// Bitbucket have no equivalent first-class concept, so callers should
+// type-assert and silently skip reporting when it's absent, the same way
+// FileFetcher is treated. checkRunID is empty to create a new check run
+// (the returned id should be persisted and passed back on the next call
+// for that job) and non-empty to update an existing one.
+type ChecksReporter interface {
+	ReportCheckRun(ctx context.Context, token, owner, name, headSHA, checkRunID string, update CheckRunUpdate) (newCheckRunID string, err error)
+}
+
+// InstallationTokenIssuer is an optional capability a Provider may
+// implement to mint a short-lived installation access token alongside its
+// expiry and the repositories it grants access to - richer than the
+// plain token string every Provider returns from IssueCloneToken. Only
+// GitHub implements it today. appID/privateKeyPEM override the
+// provider's own configured App when non-empty, so an installation under
+// a different GitHub App than the control plane's default one can still
+// mint tokens; callers should type-assert and fall back to
+// IssueCloneToken when absent, the same way FileFetcher is treated.
+type InstallationTokenIssuer interface {
+	IssueInstallationToken(ctx context.Context, installationExternalID, appID string, privateKeyPEM []byte) (token string, expiresAt time.Time, repos []RepoRef, err error)
+}
+
+// DiffFetcher is an optional capability a Provider may implement to look
+// up the file paths changed between two commits, for callers (monorepo
+// path-scoped builds) that need a changed-file set broader than what the
+// push payload itself carried - e.g. a push whose Event.ChangedPaths came
+// back nil. Only GitHub implements it today, via the commits/compare API;
+// callers should type-assert and treat its absence as "unknown changed
+// paths" the same way a nil Event.ChangedPaths is already treated.
+type DiffFetcher interface {
+	ChangedFiles(ctx context.Context, token, owner, name, base, head string) ([]string, error)
+}
+
+// NormalizePRAction maps a provider's pull/merge-request action value onto
+// the GitHub vocabulary ("opened", "reopened", "synchronize", "closed")
+// the control plane's dispatch logic is written against, so GitLab's
+// "open"/"update"/"merge" and Gitea's "synchronized" don't need their own
+// switch cases wherever an Event.Action is inspected.
+func NormalizePRAction(action string) string {
+	switch action {
+	case "open":
+		return "opened"
+	case "reopen":
+		return "reopened"
+	case "update", "synchronized":
+		return "synchronize"
+	case "merge", "close":
+		return "closed"
+	default:
+		return action
+	}
+}
+
+// Registry looks providers up by name for the /v1/{provider}/... routes.
+type Registry struct {
+	byName map[string]Provider
+}
+
+// NewRegistry builds a Registry from providers, keyed by each one's Name().
+func NewRegistry(providers ...Provider) *Registry {
+	reg := &Registry{byName: make(map[string]Provider, len(providers))}
+	for _, p := range providers {
+		reg.byName[p.Name()] = p
+	}
+	return reg
+}
+
+// Get returns the provider registered under name, if any.
+func (r *Registry) Get(name string) (Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	p, ok := r.byName[name]
+	return p, ok
+}
+
+// Names returns the registered provider names.
+func (r *Registry) Names() []string {
+	if r == nil {
+		return nil
+	}
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,785 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"  // postgres driver
+	_ "modernc.org/sqlite" // pure-Go sqlite driver
+
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/models"
+)
+
+// SQLStore is a database/sql backed Store. Rows for projects, services,
+// repos, installations, build jobs, idempotency keys, and webhook tasks each
+// carry a `data` JSON column holding the full model (build job logs are
+// stored one plain `line` per row instead), plus a handful of promoted columns
+// (id, status, created_at, ...) that the SQL layer needs to filter and
+// order on without deserializing every row.
+type SQLStore struct {
+	db     *sql.DB
+	driver string // "sqlite" or "postgres" - governs locking/RETURNING syntax
+
+	mu    sync.Mutex
+	lease time.Duration
+}
+
+// NewSQLite opens (creating if necessary) a SQLite-backed Store at path.
+func NewSQLite(path string) (*SQLStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("store: open sqlite: %w", err)
+	}
+	// SQLite only supports a single writer at a time; serialize through
+	// the standard library's connection pool rather than SKIP LOCKED.
+	db.SetMaxOpenConns(1)
+	return newSQLStore(db, "sqlite")
+}
+
+// NewPostgres opens a Postgres-backed Store using dsn.
+func NewPostgres(dsn string) (*SQLStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store: open postgres: %w", err)
+	}
+	return newSQLStore(db, "postgres")
+}
+
+func newSQLStore(db *sql.DB, driver string) (*SQLStore, error) {
+	s := &SQLStore{db: db, driver: driver, lease: defaultBuildJobLease}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLStore) migrate() error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS projects (id TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS services (id TEXT PRIMARY KEY, project_id TEXT NOT NULL, data TEXT NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS repos (id TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS installations (id TEXT PRIMARY KEY, external_id TEXT NOT NULL, data TEXT NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS build_jobs (
+			id TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			last_heartbeat_at TIMESTAMP,
+			claimed_at TIMESTAMP,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS build_jobs_status_idx ON build_jobs (status, created_at)`,
+		`CREATE TABLE IF NOT EXISTS build_job_logs (id INTEGER PRIMARY KEY AUTOINCREMENT, job_id TEXT NOT NULL, line TEXT NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (id TEXT PRIMARY KEY, expires_at TIMESTAMP NOT NULL, data TEXT NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS webhook_tasks (id TEXT PRIMARY KEY, status TEXT NOT NULL, created_at TIMESTAMP NOT NULL, data TEXT NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS webhook_tasks_status_idx ON webhook_tasks (status, created_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("store: migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) SetBuildJobLease(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lease = d
+}
+
+func (s *SQLStore) leaseDuration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lease
+}
+
+// --- projects ---
+
+func (s *SQLStore) ListProjects() ([]*models.Project, error) {
+	rows, err := s.db.Query(`SELECT data FROM projects`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.Project
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var p models.Project
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			return nil, err
+		}
+		out = append(out, &p)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLStore) CreateProject(p *models.Project) error {
+	p.CreatedAt = time.Now().UTC()
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO projects (id, data) VALUES ($1, $2)`, p.ID, string(data))
+	return err
+}
+
+func (s *SQLStore) GetProject(id string) (*models.Project, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM projects WHERE id = $1`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p models.Project
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// --- services ---
+
+func (s *SQLStore) ListServicesByProject(projectID string) ([]*models.Service, error) {
+	rows, err := s.db.Query(`SELECT data FROM services WHERE project_id = $1`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.Service
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var svc models.Service
+		if err := json.Unmarshal([]byte(data), &svc); err != nil {
+			return nil, err
+		}
+		out = append(out, &svc)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLStore) CreateService(service *models.Service) error {
+	now := time.Now().UTC()
+	service.CreatedAt = now
+	service.UpdatedAt = now
+	data, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO services (id, project_id, data) VALUES ($1, $2, $3)`, service.ID, service.ProjectID, string(data))
+	return err
+}
+
+func (s *SQLStore) UpdateService(service *models.Service) error {
+	service.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE services SET data = $1 WHERE id = $2`, string(data), service.ID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res)
+}
+
+func (s *SQLStore) GetService(id string) (*models.Service, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM services WHERE id = $1`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var svc models.Service
+	if err := json.Unmarshal([]byte(data), &svc); err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// --- repositories ---
+
+func (s *SQLStore) ListRepositories() ([]*models.Repository, error) {
+	rows, err := s.db.Query(`SELECT data FROM repos`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.Repository
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var repo models.Repository
+		if err := json.Unmarshal([]byte(data), &repo); err != nil {
+			return nil, err
+		}
+		out = append(out, &repo)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLStore) GetRepository(id string) (*models.Repository, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM repos WHERE id = $1`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var repo models.Repository
+	if err := json.Unmarshal([]byte(data), &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+func (s *SQLStore) UpsertRepository(repo *models.Repository) error {
+	now := time.Now().UTC()
+	if existing, err := s.GetRepository(repo.ID); err == nil {
+		repo.CreatedAt = existing.CreatedAt
+		if repo.Provider == "" {
+			repo.Provider = existing.Provider
+		}
+		if len(repo.Services) == 0 {
+			repo.Services = existing.Services
+		}
+		if existing.Installation != "" && repo.Installation == "" {
+			repo.Installation = existing.Installation
+		}
+	} else if err != ErrNotFound {
+		return err
+	} else {
+		repo.CreatedAt = now
+	}
+	repo.UpdatedAt = now
+
+	data, err := json.Marshal(repo)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO repos (id, data) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, repo.ID, string(data))
+	return err
+}
+
+func (s *SQLStore) DeleteRepository(id string) error {
+	res, err := s.db.Exec(`DELETE FROM repos WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res)
+}
+
+// --- installations ---
+
+func (s *SQLStore) ListInstallations() ([]*models.Installation, error) {
+	rows, err := s.db.Query(`SELECT data FROM installations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.Installation
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var inst models.Installation
+		if err := json.Unmarshal([]byte(data), &inst); err != nil {
+			return nil, err
+		}
+		out = append(out, &inst)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLStore) GetInstallation(id string) (*models.Installation, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM installations WHERE id = $1`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var inst models.Installation
+	if err := json.Unmarshal([]byte(data), &inst); err != nil {
+		return nil, err
+	}
+	return &inst, nil
+}
+
+func (s *SQLStore) UpsertInstallation(inst *models.Installation) error {
+	now := time.Now().UTC()
+	var existingData string
+	err := s.db.QueryRow(`SELECT data FROM installations WHERE id = $1`, inst.ID).Scan(&existingData)
+	switch {
+	case err == sql.ErrNoRows:
+		inst.CreatedAt = now
+	case err != nil:
+		return err
+	default:
+		var existing models.Installation
+		if err := json.Unmarshal([]byte(existingData), &existing); err != nil {
+			return err
+		}
+		inst.CreatedAt = existing.CreatedAt
+		if inst.Provider == "" {
+			inst.Provider = existing.Provider
+		}
+		if inst.WebhookSecret == "" {
+			inst.WebhookSecret = existing.WebhookSecret
+		}
+		if inst.AccessToken == "" {
+			inst.AccessToken = existing.AccessToken
+		}
+		if inst.AppID == "" {
+			inst.AppID = existing.AppID
+		}
+		if inst.AppPrivateKey == "" {
+			inst.AppPrivateKey = existing.AppPrivateKey
+		}
+		if inst.PreviewBaseDomain == "" {
+			inst.PreviewBaseDomain = existing.PreviewBaseDomain
+		}
+		if inst.PreviewTTL == "" {
+			inst.PreviewTTL = existing.PreviewTTL
+		}
+	}
+	inst.UpdatedAt = now
+
+	data, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO installations (id, external_id, data) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET external_id = excluded.external_id, data = excluded.data`,
+		inst.ID, inst.ExternalID, string(data))
+	return err
+}
+
+func (s *SQLStore) DeleteInstallation(id string) error {
+	res, err := s.db.Exec(`DELETE FROM installations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res)
+}
+
+func (s *SQLStore) FindInstallationByExternalID(externalID string) (*models.Installation, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM installations WHERE external_id = $1`, externalID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var inst models.Installation
+	if err := json.Unmarshal([]byte(data), &inst); err != nil {
+		return nil, err
+	}
+	return &inst, nil
+}
+
+// --- build jobs ---
+
+func (s *SQLStore) CreateBuildJob(job *models.BuildJob) error {
+	if job.Status == "" {
+		job.Status = "pending"
+	}
+	if job.ServiceID != "" && job.Environment == "" {
+		job.Environment = "production"
+	}
+	if job.ServiceID != "" {
+		if svc, err := s.GetService(job.ServiceID); err == nil {
+			job.Secrets = secretValues(svc.Secrets)
+		}
+	}
+	now := time.Now().UTC()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.StartedAt = time.Time{}
+	job.CompletedAt = time.Time{}
+	job.LastHeartbeatAt = time.Time{}
+	job.WorkerID = ""
+	job.CancelRequested = false
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO build_jobs (id, status, created_at, data) VALUES ($1, $2, $3, $4)`,
+		job.ID, job.Status, job.CreatedAt, string(data))
+	return err
+}
+
+func (s *SQLStore) ListBuildJobs() ([]*models.BuildJob, error) {
+	rows, err := s.db.Query(`SELECT data FROM build_jobs ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.BuildJob
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var job models.BuildJob
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			return nil, err
+		}
+		out = append(out, &job)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLStore) GetBuildJob(id string) (*models.BuildJob, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM build_jobs WHERE id = $1`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job models.BuildJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *SQLStore) UpdateBuildJob(job *models.BuildJob) error {
+	if _, err := s.GetBuildJob(job.ID); err != nil {
+		return err
+	}
+	job.UpdatedAt = time.Now().UTC()
+	if job.Status == "succeeded" || job.Status == "failed" {
+		if job.CompletedAt.IsZero() {
+			job.CompletedAt = job.UpdatedAt
+		}
+		var logCount int
+		if err := s.db.QueryRow(`SELECT COUNT(1) FROM build_job_logs WHERE job_id = $1`, job.ID).Scan(&logCount); err == nil && logCount > 0 {
+			job.Artifacts = appendLogArtifact(job.Artifacts, job.ID)
+		}
+	} else if !job.CompletedAt.IsZero() {
+		job.CompletedAt = time.Time{}
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE build_jobs SET status = $1, data = $2, last_heartbeat_at = $3 WHERE id = $4`,
+		job.Status, string(data), nullableTime(job.LastHeartbeatAt), job.ID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res)
+}
+
+func (s *SQLStore) RestartBuildJob(id string) (*models.BuildJob, error) {
+	job, err := s.GetBuildJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job.Status = "pending"
+	job.WorkerID = ""
+	job.StartedAt = time.Time{}
+	job.CompletedAt = time.Time{}
+	job.LastHeartbeatAt = time.Time{}
+	job.CancelRequested = false
+	job.Artifacts = nil
+	job.Attempt++
+	job.UpdatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.Exec(`UPDATE build_jobs SET status = $1, data = $2, last_heartbeat_at = NULL, claimed_at = NULL WHERE id = $3`,
+		job.Status, string(data), id)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ClaimNextPendingBuildJob atomically claims the oldest job that is either
+// pending or running-with-a-stale-heartbeat. On Postgres this uses
+// SELECT ... FOR UPDATE SKIP LOCKED so multiple workers/control-plane
+// replicas can race on the queue safely; SQLite serializes through a single
+// writer connection instead, so plain UPDATE...WHERE is sufficient there.
+func (s *SQLStore) ClaimNextPendingBuildJob(workerID string) (*models.BuildJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	staleBefore := now.Add(-s.leaseDuration())
+
+	selectQuery := `
+		SELECT id FROM build_jobs
+		WHERE status = 'pending'
+		   OR (status = 'running' AND (last_heartbeat_at IS NULL OR last_heartbeat_at < $1))
+		ORDER BY created_at ASC
+		LIMIT 1`
+	if s.driver == "postgres" {
+		selectQuery += " FOR UPDATE SKIP LOCKED"
+	}
+
+	var id string
+	if err := tx.QueryRow(selectQuery, staleBefore).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var data string
+	if err := tx.QueryRow(`SELECT data FROM build_jobs WHERE id = $1`, id).Scan(&data); err != nil {
+		return nil, err
+	}
+	var job models.BuildJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, err
+	}
+
+	job.Status = "running"
+	job.WorkerID = workerID
+	job.StartedAt = now
+	job.UpdatedAt = now
+	job.LastHeartbeatAt = now
+	job.CancelRequested = false
+
+	newData, err := json.Marshal(&job)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE build_jobs SET status = 'running', data = $1, last_heartbeat_at = $2, claimed_at = $2 WHERE id = $3`,
+		string(newData), now, id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *SQLStore) HeartbeatBuildJob(id string) (*models.BuildJob, error) {
+	job, err := s.GetBuildJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job.LastHeartbeatAt = time.Now().UTC()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db.Exec(`UPDATE build_jobs SET data = $1, last_heartbeat_at = $2 WHERE id = $3`, string(data), job.LastHeartbeatAt, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRowsAffected(res); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *SQLStore) CancelBuildJob(id string) (*models.BuildJob, error) {
+	job, err := s.GetBuildJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job.CancelRequested = true
+	job.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db.Exec(`UPDATE build_jobs SET data = $1 WHERE id = $2`, string(data), id)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRowsAffected(res); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *SQLStore) AppendBuildJobLogs(id string, lines []string) error {
+	if _, err := s.GetBuildJob(id); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := s.db.Exec(`INSERT INTO build_job_logs (job_id, line) VALUES ($1, $2)`, id, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) GetBuildJobLogs(id string) ([]string, error) {
+	lines, _, err := s.GetBuildJobLogsSince(id, 0)
+	return lines, err
+}
+
+// GetBuildJobLogsSince returns the log lines appended after sequence
+// number since, plus the sequence number of the last line returned (since
+// itself when there is none), to pass as since on the next call. Sequence
+// numbers are the build_job_logs table's own autoincrement id, shared by
+// every job, so unlike JSONStore's in-memory ring buffer there's
+// no eviction to clamp against - the table holds every line a job ever
+// logged.
+func (s *SQLStore) GetBuildJobLogsSince(id string, since int) ([]string, int, error) {
+	if _, err := s.GetBuildJob(id); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query(`SELECT id, line FROM build_job_logs WHERE job_id = $1 AND id > $2 ORDER BY id ASC`, id, since)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	next := since
+	var out []string
+	for rows.Next() {
+		var seq int
+		var line string
+		if err := rows.Scan(&seq, &line); err != nil {
+			return nil, 0, err
+		}
+		out = append(out, line)
+		next = seq
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return out, next, nil
+}
+
+// --- idempotency keys ---
+
+func (s *SQLStore) GetIdempotencyRecord(key string) (*models.IdempotencyRecord, error) {
+	var data string
+	var expiresAt time.Time
+	err := s.db.QueryRow(`SELECT data, expires_at FROM idempotency_keys WHERE id = $1`, key).Scan(&data, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().UTC().After(expiresAt) {
+		return nil, ErrNotFound
+	}
+	var rec models.IdempotencyRecord
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *SQLStore) SaveIdempotencyRecord(rec *models.IdempotencyRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO idempotency_keys (id, expires_at, data) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at, data = excluded.data`,
+		rec.Key, rec.ExpiresAt, string(data))
+	return err
+}
+
+// SaveWebhookTask persists a newly queued task (or an update to one's
+// Status/Error/ProcessedAt).
+func (s *SQLStore) SaveWebhookTask(task *models.WebhookTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO webhook_tasks (id, status, created_at, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET status = excluded.status, data = excluded.data`,
+		task.ID, task.Status, task.CreatedAt, string(data))
+	return err
+}
+
+// ListPendingWebhookTasks returns every task still awaiting a worker,
+// oldest first, so a restart replays deliveries in the order they arrived.
+func (s *SQLStore) ListPendingWebhookTasks() ([]*models.WebhookTask, error) {
+	rows, err := s.db.Query(`SELECT data FROM webhook_tasks WHERE status = 'pending' ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*models.WebhookTask, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var task models.WebhookTask
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, rows.Err()
+}
+
+// UpdateWebhookTask is an alias for SaveWebhookTask; tasks have no
+// existence check on update since a worker always saved one before
+// submitting it to the queue.
+func (s *SQLStore) UpdateWebhookTask(task *models.WebhookTask) error {
+	return s.SaveWebhookTask(task)
+}
+
+func requireRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
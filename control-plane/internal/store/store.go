@@ -16,32 +16,60 @@ import (
 // ErrNotFound represents missing records.
 var ErrNotFound = errors.New("store: not found")
 
+// defaultBuildJobLease is how long a claimed build job may run without a
+// heartbeat before it is considered abandoned and reclaimable.
+const defaultBuildJobLease = 2 * time.Minute
+
 // State contains persisted data.
 type State struct {
-	Projects map[string]*models.Project `json:"projects"`
-	Services map[string]*models.Service `json:"services"`
-	Repos    map[string]*models.Repository `json:"repos"`
+	Projects      map[string]*models.Project      `json:"projects"`
+	Services      map[string]*models.Service      `json:"services"`
+	Repos         map[string]*models.Repository   `json:"repos"`
 	Installations map[string]*models.Installation `json:"installations"`
-	BuildJobs map[string]*models.BuildJob `json:"build_jobs"`
+	BuildJobs     map[string]*models.BuildJob     `json:"build_jobs"`
+	BuildJobLogs  map[string][]string             `json:"build_job_logs"`
+	// BuildJobLogOffsets holds, per job ID, how many log lines have been
+	// evicted from the front of BuildJobLogs to enforce maxBuildJobLogLines.
+	// A line's sequence number is offset+index-in-slice, so GetBuildJobLogsSince
+	// can tell a caller's "since" apart from what's actually still buffered.
+	BuildJobLogOffsets map[string]int                       `json:"build_job_log_offsets"`
+	IdempotencyKeys    map[string]*models.IdempotencyRecord `json:"idempotency_keys"`
+	WebhookTasks       map[string]*models.WebhookTask       `json:"webhook_tasks"`
 }
 
+// maxBuildJobLogLines bounds how many log lines AppendBuildJobLogs keeps in
+// memory per job, so a chatty or runaway build can't grow the JSON state
+// file without limit. Lines beyond this are evicted oldest-first; a
+// reconnecting follower whose --since offset has aged out of the buffer
+// just gets replayed from the oldest line still held, same as a Kafka
+// consumer falling off the front of a topic's retention window.
+const maxBuildJobLogLines = 2000
+
 // Store provides synchronized access to state.
-type Store struct {
-	path string
-	mu   sync.RWMutex
-	data State
+// JSONStore is the default, dev-friendly backend: the whole State is kept
+// in memory and rewritten to disk on every mutation.
+type JSONStore struct {
+	path  string
+	mu    sync.RWMutex
+	data  State
+	lease time.Duration
 }
 
-// New instantiates a Store backed by a JSON file.
-func New(path string) (*Store, error) {
-	s := &Store{
-		path: path,
+// NewJSON instantiates a JSONStore backed by a JSON file.
+func NewJSON(path string) (*JSONStore, error) {
+	s := &JSONStore{
+		path:  path,
+		lease: defaultBuildJobLease,
 		data: State{
-			Projects: make(map[string]*models.Project),
-			Services: make(map[string]*models.Service),
-			Repos:    make(map[string]*models.Repository),
-			Installations: make(map[string]*models.Installation),
-			BuildJobs: make(map[string]*models.BuildJob),
+			Projects:           make(map[string]*models.Project),
+			Services:           make(map[string]*models.Service),
+			Repos:              make(map[string]*models.Repository),
+			Installations:      make(map[string]*models.Installation),
+			BuildJobs:          make(map[string]*models.BuildJob),
+			BuildJobLogs:       make(map[string][]string),
+			BuildJobLogOffsets: make(map[string]int),
+			IdempotencyKeys:    make(map[string]*models.IdempotencyRecord),
+			WebhookTasks:       make(map[string]*models.WebhookTask),
 		},
 	}
 	if err := s.load(); err != nil {
@@ -50,7 +78,18 @@ func New(path string) (*Store, error) {
 	return s, nil
 }
 
-func (s *Store) load() error {
+// SetBuildJobLease overrides the default heartbeat lease used when deciding
+// whether a running build job has been abandoned by its worker.
+func (s *JSONStore) SetBuildJobLease(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lease = d
+}
+
+func (s *JSONStore) load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -88,11 +127,23 @@ func (s *Store) load() error {
 	if state.BuildJobs == nil {
 		state.BuildJobs = make(map[string]*models.BuildJob)
 	}
+	if state.BuildJobLogs == nil {
+		state.BuildJobLogs = make(map[string][]string)
+	}
+	if state.BuildJobLogOffsets == nil {
+		state.BuildJobLogOffsets = make(map[string]int)
+	}
+	if state.IdempotencyKeys == nil {
+		state.IdempotencyKeys = make(map[string]*models.IdempotencyRecord)
+	}
+	if state.WebhookTasks == nil {
+		state.WebhookTasks = make(map[string]*models.WebhookTask)
+	}
 	s.data = state
 	return nil
 }
 
-func (s *Store) persistLocked() error {
+func (s *JSONStore) persistLocked() error {
 	bytes, err := json.MarshalIndent(s.data, "", "  ")
 	if err != nil {
 		return err
@@ -101,7 +152,7 @@ func (s *Store) persistLocked() error {
 }
 
 // ListProjects returns all projects.
-func (s *Store) ListProjects() ([]*models.Project, error) {
+func (s *JSONStore) ListProjects() ([]*models.Project, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -113,7 +164,7 @@ func (s *Store) ListProjects() ([]*models.Project, error) {
 }
 
 // CreateProject stores a new project.
-func (s *Store) CreateProject(p *models.Project) error {
+func (s *JSONStore) CreateProject(p *models.Project) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -127,7 +178,7 @@ func (s *Store) CreateProject(p *models.Project) error {
 }
 
 // GetProject fetches a project by ID.
-func (s *Store) GetProject(id string) (*models.Project, error) {
+func (s *JSONStore) GetProject(id string) (*models.Project, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -139,7 +190,7 @@ func (s *Store) GetProject(id string) (*models.Project, error) {
 }
 
 // ListServicesByProject returns services associated to a project.
-func (s *Store) ListServicesByProject(projectID string) ([]*models.Service, error) {
+func (s *JSONStore) ListServicesByProject(projectID string) ([]*models.Service, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -153,7 +204,7 @@ func (s *Store) ListServicesByProject(projectID string) ([]*models.Service, erro
 }
 
 // CreateService stores a new service.
-func (s *Store) CreateService(service *models.Service) error {
+func (s *JSONStore) CreateService(service *models.Service) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -169,7 +220,7 @@ func (s *Store) CreateService(service *models.Service) error {
 }
 
 // UpdateService persists updates to an existing service.
-func (s *Store) UpdateService(service *models.Service) error {
+func (s *JSONStore) UpdateService(service *models.Service) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -183,7 +234,7 @@ func (s *Store) UpdateService(service *models.Service) error {
 }
 
 // GetService fetches a service by ID.
-func (s *Store) GetService(id string) (*models.Service, error) {
+func (s *JSONStore) GetService(id string) (*models.Service, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -208,6 +259,12 @@ func cloneService(svc *models.Service) *models.Service {
 	}
 	copy := *svc
 	copy.Compose = svc.Compose
+	if svc.Secrets != nil {
+		copy.Secrets = make(map[string]string, len(svc.Secrets))
+		for k, v := range svc.Secrets {
+			copy.Secrets[k] = v
+		}
+	}
 	if svc.Domains != nil {
 		copy.Domains = append([]models.Domain(nil), svc.Domains...)
 	}
@@ -218,7 +275,7 @@ func cloneService(svc *models.Service) *models.Service {
 }
 
 // ListRepositories returns all registered repositories.
-func (s *Store) ListRepositories() ([]*models.Repository, error) {
+func (s *JSONStore) ListRepositories() ([]*models.Repository, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -230,7 +287,7 @@ func (s *Store) ListRepositories() ([]*models.Repository, error) {
 }
 
 // GetRepository returns a repository by ID.
-func (s *Store) GetRepository(id string) (*models.Repository, error) {
+func (s *JSONStore) GetRepository(id string) (*models.Repository, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	repo, ok := s.data.Repos[id]
@@ -241,21 +298,18 @@ func (s *Store) GetRepository(id string) (*models.Repository, error) {
 }
 
 // UpsertRepository inserts or updates repository metadata.
-func (s *Store) UpsertRepository(repo *models.Repository) error {
+func (s *JSONStore) UpsertRepository(repo *models.Repository) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	now := time.Now().UTC()
 	if existing, ok := s.data.Repos[repo.ID]; ok {
 		repo.CreatedAt = existing.CreatedAt
-		if repo.ServiceID == "" {
-			repo.ServiceID = existing.ServiceID
-		}
-		if repo.Environment == "" {
-			repo.Environment = existing.Environment
+		if repo.Provider == "" {
+			repo.Provider = existing.Provider
 		}
-		if repo.ComposePath == "" {
-			repo.ComposePath = existing.ComposePath
+		if len(repo.Services) == 0 {
+			repo.Services = existing.Services
 		}
 		if existing.Installation != "" && repo.Installation == "" {
 			repo.Installation = existing.Installation
@@ -273,11 +327,14 @@ func cloneRepository(repo *models.Repository) *models.Repository {
 		return nil
 	}
 	copy := *repo
+	if repo.Services != nil {
+		copy.Services = append([]models.RepositoryService(nil), repo.Services...)
+	}
 	return &copy
 }
 
 // DeleteRepository removes a repository record.
-func (s *Store) DeleteRepository(id string) error {
+func (s *JSONStore) DeleteRepository(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -289,7 +346,7 @@ func (s *Store) DeleteRepository(id string) error {
 }
 
 // ListInstallations returns recorded GitHub App installations.
-func (s *Store) ListInstallations() ([]*models.Installation, error) {
+func (s *JSONStore) ListInstallations() ([]*models.Installation, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -300,17 +357,47 @@ func (s *Store) ListInstallations() ([]*models.Installation, error) {
 	return result, nil
 }
 
+// GetInstallation retrieves an installation by its internal ID.
+func (s *JSONStore) GetInstallation(id string) (*models.Installation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inst, ok := s.data.Installations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneInstallation(inst), nil
+}
+
 // UpsertInstallation stores installation details.
-func (s *Store) UpsertInstallation(inst *models.Installation) error {
+func (s *JSONStore) UpsertInstallation(inst *models.Installation) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	now := time.Now().UTC()
 	if existing, ok := s.data.Installations[inst.ID]; ok {
 		inst.CreatedAt = existing.CreatedAt
+		if inst.Provider == "" {
+			inst.Provider = existing.Provider
+		}
 		if inst.WebhookSecret == "" {
 			inst.WebhookSecret = existing.WebhookSecret
 		}
+		if inst.AccessToken == "" {
+			inst.AccessToken = existing.AccessToken
+		}
+		if inst.AppID == "" {
+			inst.AppID = existing.AppID
+		}
+		if inst.AppPrivateKey == "" {
+			inst.AppPrivateKey = existing.AppPrivateKey
+		}
+		if inst.PreviewBaseDomain == "" {
+			inst.PreviewBaseDomain = existing.PreviewBaseDomain
+		}
+		if inst.PreviewTTL == "" {
+			inst.PreviewTTL = existing.PreviewTTL
+		}
 	} else {
 		inst.CreatedAt = now
 	}
@@ -327,8 +414,20 @@ func cloneInstallation(inst *models.Installation) *models.Installation {
 	return &copy
 }
 
+// DeleteInstallation removes an installation record.
+func (s *JSONStore) DeleteInstallation(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.Installations[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.data.Installations, id)
+	return s.persistLocked()
+}
+
 // FindInstallationByExternalID retrieves an installation by external ID.
-func (s *Store) FindInstallationByExternalID(externalID string) (*models.Installation, error) {
+func (s *JSONStore) FindInstallationByExternalID(externalID string) (*models.Installation, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -341,7 +440,7 @@ func (s *Store) FindInstallationByExternalID(externalID string) (*models.Install
 }
 
 // CreateBuildJob stores a new build job.
-func (s *Store) CreateBuildJob(job *models.BuildJob) error {
+func (s *JSONStore) CreateBuildJob(job *models.BuildJob) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -351,35 +450,60 @@ func (s *Store) CreateBuildJob(job *models.BuildJob) error {
 	if job.ServiceID != "" && job.Environment == "" {
 		job.Environment = "production"
 	}
+	if job.ServiceID != "" {
+		if svc, ok := s.data.Services[job.ServiceID]; ok {
+			job.Secrets = secretValues(svc.Secrets)
+		}
+	}
 	now := time.Now().UTC()
 	job.CreatedAt = now
 	job.UpdatedAt = now
 	job.StartedAt = time.Time{}
 	job.CompletedAt = time.Time{}
+	job.LastHeartbeatAt = time.Time{}
 	job.WorkerID = ""
+	job.CancelRequested = false
 	job.Artifacts = append([]string(nil), job.Artifacts...)
 	job.ComposePath = strings.TrimSpace(job.ComposePath)
 	s.data.BuildJobs[job.ID] = cloneBuildJob(job)
 	return s.persistLocked()
 }
 
+// secretValues flattens a service's secrets map into a sorted-by-key
+// slice of values for a BuildJob. It reads only its argument.
+func secretValues(secrets map[string]string) []string {
+	if len(secrets) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, secrets[name])
+	}
+	return values
+}
+
 // ListBuildJobs returns build jobs sorted by creation order.
-func (s *Store) ListBuildJobs() ([]*models.BuildJob, error) {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
+func (s *JSONStore) ListBuildJobs() ([]*models.BuildJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-    jobs := make([]*models.BuildJob, 0, len(s.data.BuildJobs))
-    for _, job := range s.data.BuildJobs {
-        jobs = append(jobs, cloneBuildJob(job))
-    }
-    sort.Slice(jobs, func(i, j int) bool {
-        return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
-    })
-    return jobs, nil
+	jobs := make([]*models.BuildJob, 0, len(s.data.BuildJobs))
+	for _, job := range s.data.BuildJobs {
+		jobs = append(jobs, cloneBuildJob(job))
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
 }
 
 // UpdateBuildJob updates status/reason for a job.
-func (s *Store) UpdateBuildJob(job *models.BuildJob) error {
+func (s *JSONStore) UpdateBuildJob(job *models.BuildJob) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -391,6 +515,9 @@ func (s *Store) UpdateBuildJob(job *models.BuildJob) error {
 		if job.CompletedAt.IsZero() {
 			job.CompletedAt = job.UpdatedAt
 		}
+		if len(s.data.BuildJobLogs[job.ID]) > 0 {
+			job.Artifacts = appendLogArtifact(job.Artifacts, job.ID)
+		}
 	} else if !job.CompletedAt.IsZero() {
 		job.CompletedAt = time.Time{}
 	}
@@ -400,6 +527,19 @@ func (s *Store) UpdateBuildJob(job *models.BuildJob) error {
 	return s.persistLocked()
 }
 
+// appendLogArtifact adds a logs:// pointer for jobID to artifacts, so a
+// client scanning Artifacts for this job finds its build log alongside any
+// produced image tags. It's a no-op if the pointer is already present.
+func appendLogArtifact(artifacts []string, jobID string) []string {
+	ref := "logs://" + jobID
+	for _, a := range artifacts {
+		if a == ref {
+			return artifacts
+		}
+	}
+	return append(artifacts, ref)
+}
+
 func cloneBuildJob(job *models.BuildJob) *models.BuildJob {
 	if job == nil {
 		return nil
@@ -408,19 +548,61 @@ func cloneBuildJob(job *models.BuildJob) *models.BuildJob {
 	if job.Artifacts != nil {
 		copy.Artifacts = append([]string(nil), job.Artifacts...)
 	}
+	if job.Secrets != nil {
+		copy.Secrets = append([]string(nil), job.Secrets...)
+	}
+	if job.ImageRefs != nil {
+		copy.ImageRefs = make(map[string]string, len(job.ImageRefs))
+		for k, v := range job.ImageRefs {
+			copy.ImageRefs[k] = v
+		}
+	}
 	return &copy
 }
 
-// ClaimNextPendingBuildJob marks the oldest pending job as running and returns it.
-func (s *Store) ClaimNextPendingBuildJob(workerID string) (*models.BuildJob, error) {
+// RestartBuildJob re-queues a build job for another attempt, clearing the
+// state left by its previous run while bumping Attempt so the worker can
+// produce a non-colliding image tag.
+func (s *JSONStore) RestartBuildJob(id string) (*models.BuildJob, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	job, ok := s.data.BuildJobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	job.Status = "pending"
+	job.WorkerID = ""
+	job.StartedAt = time.Time{}
+	job.CompletedAt = time.Time{}
+	job.LastHeartbeatAt = time.Time{}
+	job.CancelRequested = false
+	job.Artifacts = nil
+	job.Attempt++
+	job.UpdatedAt = time.Now().UTC()
+	s.data.BuildJobs[id] = cloneBuildJob(job)
+
+	if err := s.persistLocked(); err != nil {
+		return nil, err
+	}
+	return cloneBuildJob(job), nil
+}
+
+// ClaimNextPendingBuildJob marks the oldest pending job as running and returns
+// it. Running jobs whose heartbeat is older than the configured lease are
+// treated as abandoned and are reclaimable just like pending ones.
+func (s *JSONStore) ClaimNextPendingBuildJob(workerID string) (*models.BuildJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+
 	var selectedID string
 	var selectedJob *models.BuildJob
 
 	for id, job := range s.data.BuildJobs {
-		if job.Status != "pending" {
+		if !s.claimableLocked(job, now) {
 			continue
 		}
 		if selectedJob == nil || job.CreatedAt.Before(selectedJob.CreatedAt) {
@@ -437,8 +619,10 @@ func (s *Store) ClaimNextPendingBuildJob(workerID string) (*models.BuildJob, err
 	job := s.data.BuildJobs[selectedID]
 	job.Status = "running"
 	job.WorkerID = workerID
-	job.StartedAt = time.Now().UTC()
-	job.UpdatedAt = job.StartedAt
+	job.StartedAt = now
+	job.UpdatedAt = now
+	job.LastHeartbeatAt = now
+	job.CancelRequested = false
 	s.data.BuildJobs[selectedID] = cloneBuildJob(job)
 
 	if err := s.persistLocked(); err != nil {
@@ -448,14 +632,194 @@ func (s *Store) ClaimNextPendingBuildJob(workerID string) (*models.BuildJob, err
 	return cloneBuildJob(job), nil
 }
 
+func (s *JSONStore) claimableLocked(job *models.BuildJob, now time.Time) bool {
+	if job.Status == "pending" {
+		return true
+	}
+	if job.Status != "running" {
+		return false
+	}
+	last := job.LastHeartbeatAt
+	if last.IsZero() {
+		last = job.StartedAt
+	}
+	return now.Sub(last) > s.lease
+}
+
+// HeartbeatBuildJob extends a running job's lease, recording that its worker
+// is still alive.
+func (s *JSONStore) HeartbeatBuildJob(id string) (*models.BuildJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.data.BuildJobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	job.LastHeartbeatAt = time.Now().UTC()
+	s.data.BuildJobs[id] = cloneBuildJob(job)
+
+	if err := s.persistLocked(); err != nil {
+		return nil, err
+	}
+	return cloneBuildJob(job), nil
+}
+
+// CancelBuildJob flags a pending or running job as cancel-requested without
+// changing its status; the worker that next heartbeats it is expected to
+// notice CancelRequested and stop on its own, since the control plane has no
+// way to forcibly kill a worker's build. ClaimNextPendingBuildJob clears the
+// flag, so a job cancelled while still pending is claimed and built as usual.
+func (s *JSONStore) CancelBuildJob(id string) (*models.BuildJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.data.BuildJobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	job.CancelRequested = true
+	job.UpdatedAt = time.Now().UTC()
+	s.data.BuildJobs[id] = cloneBuildJob(job)
+
+	if err := s.persistLocked(); err != nil {
+		return nil, err
+	}
+	return cloneBuildJob(job), nil
+}
+
+// AppendBuildJobLogs appends a batch of log lines for a build job, keyed by
+// job ID, preserving submission order, evicting the oldest lines once the
+// buffer passes maxBuildJobLogLines.
+func (s *JSONStore) AppendBuildJobLogs(id string, lines []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.BuildJobs[id]; !ok {
+		return ErrNotFound
+	}
+	buffered := append(s.data.BuildJobLogs[id], lines...)
+	if overflow := len(buffered) - maxBuildJobLogLines; overflow > 0 {
+		s.data.BuildJobLogOffsets[id] += overflow
+		buffered = append([]string(nil), buffered[overflow:]...)
+	}
+	s.data.BuildJobLogs[id] = buffered
+	return s.persistLocked()
+}
+
+// GetBuildJobLogs returns the accumulated log lines for a build job still
+// held in the in-memory buffer.
+func (s *JSONStore) GetBuildJobLogs(id string) ([]string, error) {
+	lines, _, err := s.GetBuildJobLogsSince(id, 0)
+	return lines, err
+}
+
+// GetBuildJobLogsSince returns the log lines appended after sequence
+// number since, plus the sequence number the next appended line will
+// receive. A since below the oldest sequence still buffered (it aged out
+// under maxBuildJobLogLines) is clamped up to it, so a reconnecting
+// follower gets everything still available rather than an error.
+func (s *JSONStore) GetBuildJobLogsSince(id string, since int) ([]string, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.data.BuildJobs[id]; !ok {
+		return nil, 0, ErrNotFound
+	}
+	offset := s.data.BuildJobLogOffsets[id]
+	buffered := s.data.BuildJobLogs[id]
+	next := offset + len(buffered)
+	if since < offset {
+		since = offset
+	}
+	if since >= next {
+		return nil, next, nil
+	}
+	return append([]string(nil), buffered[since-offset:]...), next, nil
+}
+
 // GetBuildJob returns a build job by ID.
-func (s *Store) GetBuildJob(id string) (*models.BuildJob, error) {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
-
-    job, ok := s.data.BuildJobs[id]
-    if !ok {
-        return nil, ErrNotFound
-    }
-    return cloneBuildJob(job), nil
+func (s *JSONStore) GetBuildJob(id string) (*models.BuildJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.data.BuildJobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneBuildJob(job), nil
+}
+
+// GetIdempotencyRecord returns the cached record for key, or ErrNotFound if
+// there isn't one or it has expired.
+func (s *JSONStore) GetIdempotencyRecord(key string) (*models.IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.data.IdempotencyKeys[key]
+	if !ok || time.Now().UTC().After(rec.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return cloneIdempotencyRecord(rec), nil
+}
+
+// SaveIdempotencyRecord stores rec, replacing any existing record under the
+// same key.
+func (s *JSONStore) SaveIdempotencyRecord(rec *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.IdempotencyKeys[rec.Key] = cloneIdempotencyRecord(rec)
+	return s.persistLocked()
+}
+
+func cloneIdempotencyRecord(rec *models.IdempotencyRecord) *models.IdempotencyRecord {
+	if rec == nil {
+		return nil
+	}
+	copy := *rec
+	return &copy
+}
+
+// SaveWebhookTask persists a newly queued task (or an update to one's
+// Status/Error/ProcessedAt).
+func (s *JSONStore) SaveWebhookTask(task *models.WebhookTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.WebhookTasks[task.ID] = cloneWebhookTask(task)
+	return s.persistLocked()
+}
+
+// ListPendingWebhookTasks returns every task still awaiting a worker,
+// oldest first, so a restart replays deliveries in the order they arrived.
+func (s *JSONStore) ListPendingWebhookTasks() ([]*models.WebhookTask, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make([]*models.WebhookTask, 0)
+	for _, task := range s.data.WebhookTasks {
+		if task.Status == "pending" {
+			tasks = append(tasks, cloneWebhookTask(task))
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+	})
+	return tasks, nil
+}
+
+// UpdateWebhookTask is an alias for SaveWebhookTask; tasks have no
+// existence check on update since a worker always saved one before
+// submitting it to the queue.
+func (s *JSONStore) UpdateWebhookTask(task *models.WebhookTask) error {
+	return s.SaveWebhookTask(task)
+}
+
+func cloneWebhookTask(task *models.WebhookTask) *models.WebhookTask {
+	if task == nil {
+		return nil
+	}
+	copy := *task
+	return &copy
 }
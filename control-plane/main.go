@@ -8,35 +8,89 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/api"
+	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/objectstore"
 	"github.com/0xEdouard/multi-domain-infra/control-plane/internal/store"
 )
 
 func main() {
 	addr := flag.String("addr", ":8080", "HTTP listen address")
-	statePath := flag.String("state", "./data/state.json", "path to state file")
+	statePath := flag.String("state", "", "path to JSON state file (deprecated, use -store-dsn)")
+	storeDSN := flag.String("store-dsn", "file://./data/state.json", "store backend DSN: file://path, sqlite://path, or postgres://...")
 	apiToken := flag.String("api-token", "", "API bearer token (optional)")
 	leResolver := flag.String("le-resolver", "le", "Traefik cert resolver name")
+	buildLease := flag.Duration("build-job-lease", 2*time.Minute, "Max time a running build job may go without a heartbeat before it is reclaimed")
+	githubAppID := flag.String("github-app-id", "", "GitHub App ID, for installation token exchange (optional)")
+	githubAppPrivateKeyPath := flag.String("github-app-private-key", "", "path to the GitHub App's PEM private key (optional)")
+	gitlabBaseURL := flag.String("gitlab-base-url", "", "GitLab instance API base, e.g. https://gitlab.example.com (defaults to https://gitlab.com)")
+	giteaBaseURL := flag.String("gitea-base-url", "", "Gitea instance API base, e.g. https://git.example.com (optional, disables Gitea ListRepos/RegisterWebhook if empty)")
+	previewBaseDomain := flag.String("preview-base-domain", "", "base domain PR preview hostnames are cut from, e.g. preview.example.com (optional)")
+	previewTTL := flag.Duration("preview-ttl", 7*24*time.Hour, "how long a closed PR's preview environment survives before it is reaped; per-installation preview_ttl overrides this")
+	previewSweepInterval := flag.Duration("preview-sweep-interval", 10*time.Minute, "how often to scan for expired preview environments")
+	storageEndpoint := flag.String("storage-endpoint", "", "S3-compatible endpoint (host:port) build artifacts are presigned against, e.g. minio.internal:9000 (optional, disables /v1/build-jobs/{id}/artifacts if empty)")
+	storageBucket := flag.String("storage-bucket", "mdp-build-artifacts", "bucket build artifacts are stored in")
+	storageRegion := flag.String("storage-region", "us-east-1", "region to sign artifact storage requests for")
+	storageAccessKey := flag.String("storage-access-key", "", "object storage access key")
+	storageSecretKey := flag.String("storage-secret-key", "", "object storage secret key")
+	storageSSL := flag.Bool("storage-ssl", true, "use https for the object storage endpoint")
 	flag.Parse()
 
-	if err := os.MkdirAll(filepath.Dir(*statePath), 0755); err != nil {
-		log.Fatalf("failed to create state directory: %v", err)
+	dsn := *storeDSN
+	if *statePath != "" {
+		dsn = "file://" + *statePath
 	}
 
-	st, err := store.New(*statePath)
+	if scheme, rest, ok := strings.Cut(dsn, "://"); !ok || scheme == "file" || scheme == "" {
+		path := rest
+		if !ok {
+			path = dsn
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatalf("failed to create state directory: %v", err)
+		}
+	}
+
+	st, err := store.New(dsn)
 	if err != nil {
 		log.Fatalf("failed to init store: %v", err)
 	}
+	st.SetBuildJobLease(*buildLease)
+
+	var githubAppPrivateKey []byte
+	if *githubAppPrivateKeyPath != "" {
+		key, err := os.ReadFile(*githubAppPrivateKeyPath)
+		if err != nil {
+			log.Fatalf("failed to read github app private key: %v", err)
+		}
+		githubAppPrivateKey = key
+	}
 
 	server := api.New(api.Config{
-		Store:      st,
-		APIToken:   *apiToken,
-		LEResolver: *leResolver,
+		Store:               st,
+		APIToken:            *apiToken,
+		LEResolver:          *leResolver,
+		GitHubAppID:         *githubAppID,
+		GitHubAppPrivateKey: githubAppPrivateKey,
+		GitLabBaseURL:       *gitlabBaseURL,
+		GiteaBaseURL:        *giteaBaseURL,
+		PreviewBaseDomain:   *previewBaseDomain,
+		PreviewTTL:          *previewTTL,
+		Storage: objectstore.Config{
+			Endpoint:  *storageEndpoint,
+			Bucket:    *storageBucket,
+			Region:    *storageRegion,
+			AccessKey: *storageAccessKey,
+			SecretKey: *storageSecretKey,
+			UseSSL:    *storageSSL,
+		},
 	})
 
+	server.ReplayPendingWebhookTasks()
+
 	srv := &http.Server{
 		Addr:         *addr,
 		Handler:      server.Handler(),
@@ -52,11 +106,15 @@ func main() {
 		}
 	}()
 
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	server.StartPreviewSweeper(sweepCtx, *previewSweepInterval)
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
 	log.Println("shutting down...")
+	stopSweeper()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 